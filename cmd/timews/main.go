@@ -14,11 +14,29 @@ import (
 
 type TimeHandler struct {
 	Fanout *conc.QueuedFanOut[gohttp.OutgoingMessage[any]]
+
+	// Codec is shared by all connections so that a published message can be
+	// encoded once and fanned out as a prepared message.
+	Codec *gohttp.JSONCodec
 }
 
 // ... along with a corresponding New method
 func NewTimeHandler() *TimeHandler {
-	return &TimeHandler{Fanout: conc.NewQueuedFanOut[gohttp.OutgoingMessage[any]]()}
+	return &TimeHandler{
+		Fanout: conc.NewQueuedFanOut[gohttp.OutgoingMessage[any]](),
+		Codec:  &gohttp.JSONCodec{},
+	}
+}
+
+// Publish encodes the message once and sends the prepared frame to every
+// subscriber's Writer.
+func (t *TimeHandler) Publish(msg any) {
+	out, err := gohttp.PrepareOutgoing[any, any](t.Codec, msg)
+	if err != nil {
+		log.Println("Failed to encode message: ", err)
+		return
+	}
+	t.Fanout.Send(out)
 }
 
 // The Validate method gates the subscribe request to see if it should be upgraded
@@ -28,7 +46,7 @@ func NewTimeHandler() *TimeHandler {
 func (t *TimeHandler) Validate(w http.ResponseWriter, r *http.Request) (out *TimeConn, isValid bool) {
 	return &TimeConn{
 		JSONConn: gohttp.JSONConn{
-			Codec:   &gohttp.JSONCodec{},
+			Codec:   t.Codec,
 			NameStr: "TimeConn",
 		},
 		handler: t,
@@ -64,8 +82,7 @@ func (t *TimeConn) OnTimeout() bool {
 func (t *TimeConn) HandleMessage(msg any) error {
 	log.Println("Received Message To Handle: ", msg)
 	// sending to all listeners
-	var val any = msg
-	t.handler.Fanout.Send(gohttp.OutgoingMessage[any]{Data: &val})
+	t.handler.Publish(msg)
 	return nil
 }
 
@@ -74,8 +91,7 @@ func main() {
 	timeHandler := NewTimeHandler()
 	r.HandleFunc("/publish", func(w http.ResponseWriter, r *http.Request) {
 		msg := r.URL.Query().Get("msg")
-		var msgVal any = fmt.Sprintf("%s: %s", time.Now().String(), msg)
-		timeHandler.Fanout.Send(gohttp.OutgoingMessage[any]{Data: &msgVal})
+		timeHandler.Publish(fmt.Sprintf("%s: %s", time.Now().String(), msg))
 		fmt.Fprintf(w, "Published Message Successfully")
 	})
 
@@ -85,8 +101,7 @@ func main() {
 		defer t.Stop()
 		for {
 			<-t.C
-			var timeVal any = time.Now().String()
-			timeHandler.Fanout.Send(gohttp.OutgoingMessage[any]{Data: &timeVal})
+			timeHandler.Publish(time.Now().String())
 		}
 	}()
 
@@ -23,6 +23,11 @@ type OutgoingMessage[O any] struct {
 
 	// Error is an error message (mutually exclusive with Data/Ping)
 	Error error
+
+	// Prepared is a message that was encoded once and can be written to
+	// many connections without re-encoding or re-framing (mutually exclusive
+	// with Data/Ping/Error). See PrepareOutput and WSBroadcast.
+	Prepared *websocket.PreparedMessage
 }
 
 // PingData contains ping message metadata.
@@ -130,6 +135,8 @@ func (b *BaseConn[I, O]) OnStart(conn *websocket.Conn) error {
 				return nil
 			}
 			return b.writeError(conn, msg.Error)
+		} else if msg.Prepared != nil {
+			return conn.WritePreparedMessage(msg.Prepared)
 		} else if msg.Data != nil {
 			return b.writeMessage(conn, *msg.Data)
 		}
@@ -231,6 +238,15 @@ func (b *BaseConn[I, O]) SendOutput(msg O) {
 	}
 }
 
+// SendPrepared sends a pre-encoded message to the client. The same
+// PreparedMessage can be sent to any number of connections; it is encoded
+// and framed once, and each connection's Writer only copies the frame.
+func (b *BaseConn[I, O]) SendPrepared(pm *websocket.PreparedMessage) {
+	if b.Writer != nil {
+		b.Writer.Send(OutgoingMessage[O]{Prepared: pm})
+	}
+}
+
 // SendError sends an error to the client.
 func (b *BaseConn[I, O]) SendError(err error) {
 	if b.Writer != nil {
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// BearerVerifier is server middleware that requires an OAuth 2.0 bearer token
+// (RFC 6750) and answers failures with a WWW-Authenticate challenge, so
+// clients such as OAuthClient can discover the authorization server and
+// step up scopes:
+//
+//   - no bearer token → 401 with a challenge carrying realm, scope and
+//     resource_metadata, and no error code (RFC 6750 §3.1)
+//   - a token Validate rejects → 401 error="invalid_token"
+//   - a token missing a required scope → 403 error="insufficient_scope"
+//
+// Usage:
+//
+//	verifier := &gohttp.BearerVerifier{
+//	    Validate:         verifyJWT,
+//	    Scopes:           []string{"read"},
+//	    ResourceMetadata: "https://api.example/.well-known/oauth-protected-resource",
+//	}
+//	router.Handle("/api/", verifier.Middleware(apiHandler))
+type BearerVerifier struct {
+	// Validate checks a token and returns the scopes it grants. An error
+	// rejects the token; its message is sent as error_description.
+	Validate func(ctx context.Context, token string) (scopes []string, err error)
+
+	// Realm, if set, is sent as the challenge's realm parameter.
+	Realm string
+
+	// Scopes are required on every request.
+	Scopes []string
+
+	// ResourceMetadata, if set, is the URL of the RFC 9728 Protected
+	// Resource Metadata document, sent as the resource_metadata parameter.
+	ResourceMetadata string
+}
+
+type bearerScopesKey struct{}
+
+// BearerScopes returns the scopes granted to the token of the request
+// being handled, as returned by BearerVerifier.Validate.
+func BearerScopes(ctx context.Context) []string {
+	scopes, _ := ctx.Value(bearerScopesKey{}).([]string)
+	return scopes
+}
+
+// Middleware wraps next so it only runs for requests with a valid token
+// that grants Scopes.
+func (v *BearerVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			v.challenge(w, http.StatusUnauthorized, "", "")
+			return
+		}
+		granted, err := v.Validate(r.Context(), token)
+		if err != nil {
+			v.challenge(w, http.StatusUnauthorized, "invalid_token", err.Error())
+			return
+		}
+		for _, scope := range v.Scopes {
+			if !slices.Contains(granted, scope) {
+				v.challenge(w, http.StatusForbidden, "insufficient_scope", "token lacks scope "+scope)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), bearerScopesKey{}, granted)))
+	})
+}
+
+// challenge writes an error response with a Bearer WWW-Authenticate
+// challenge. errCode and description are omitted when empty.
+func (v *BearerVerifier) challenge(w http.ResponseWriter, status int, errCode, description string) {
+	ch := &AuthChallenge{Scheme: "Bearer"}
+	if v.Realm != "" {
+		ch.Set("realm", v.Realm)
+	}
+	if errCode != "" {
+		ch.Set("error", errCode)
+	}
+	if description != "" {
+		ch.Set("error_description", description)
+	}
+	if len(v.Scopes) > 0 {
+		ch.Set("scope", strings.Join(v.Scopes, " "))
+	}
+	if v.ResourceMetadata != "" {
+		ch.Set("resource_metadata", v.ResourceMetadata)
+	}
+	w.Header().Set("WWW-Authenticate", FormatWWWAuthenticate(*ch))
+	if description == "" {
+		description = http.StatusText(status)
+	}
+	http.Error(w, description, status)
+}
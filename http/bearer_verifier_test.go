@@ -0,0 +1,99 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBearerVerifier_Challenges verifies the status and WWW-Authenticate
+// challenge for a missing, rejected and under-scoped token, and that a
+// valid token reaches the handler with its scopes.
+func TestBearerVerifier_Challenges(t *testing.T) {
+	verifier := &BearerVerifier{
+		Validate: func(ctx context.Context, token string) ([]string, error) {
+			switch token {
+			case "reader":
+				return []string{"read"}, nil
+			case "writer":
+				return []string{"read", "write"}, nil
+			}
+			return nil, errors.New(`token "expired"`)
+		},
+		Realm:            "api",
+		Scopes:           []string{"read", "write"},
+		ResourceMetadata: "https://api.example/.well-known/oauth-protected-resource",
+	}
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join(BearerScopes(r.Context()), ",")))
+	}))
+
+	cases := []struct {
+		authorization string
+		status        int
+		errCode       string
+		description   string
+	}{
+		{"", http.StatusUnauthorized, "", ""},
+		{"Basic dXNlcjpwYXNz", http.StatusUnauthorized, "", ""},
+		{"Bearer bogus", http.StatusUnauthorized, "invalid_token", `token "expired"`},
+		{"Bearer reader", http.StatusForbidden, "insufficient_scope", "token lacks scope write"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%q: status = %d, want %d", tc.authorization, rec.Code, tc.status)
+			continue
+		}
+		challenges, err := ParseAuthChallenges(rec.Header().Get("WWW-Authenticate"))
+		if err != nil || len(challenges) != 1 || !challenges[0].HasScheme("Bearer") {
+			t.Errorf("%q: challenges = %+v, %v", tc.authorization, challenges, err)
+			continue
+		}
+		c := challenges[0]
+		if c.Realm() != "api" || c.ErrorCode() != tc.errCode || c.ErrorDescription() != tc.description ||
+			c.Param("scope") != "read write" || c.Param("resource_metadata") != verifier.ResourceMetadata {
+			t.Errorf("%q: challenge = %+v", tc.authorization, c)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer writer")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "read,write" {
+		t.Errorf("valid token: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+// TestBearerVerifier_ClientRoundTrip verifies that the emitted challenge is
+// understood by the client side: DoWithAuthRetry reports the required
+// scopes from a 403.
+func TestBearerVerifier_ClientRoundTrip(t *testing.T) {
+	verifier := &BearerVerifier{
+		Validate: func(ctx context.Context, token string) ([]string, error) { return []string{"read"}, nil },
+		Scopes:   []string{"read", "admin"},
+	}
+	srv := httptest.NewServer(verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer srv.Close()
+
+	_, err := DoWithAuthRetry(nil, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer t")
+		}
+		return req, err
+	}, http.DefaultClient.Do)
+	var authErr *AuthRetryError
+	if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusForbidden || len(authErr.RequiredScopes) != 2 {
+		t.Errorf("err = %#v", err)
+	}
+}
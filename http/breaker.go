@@ -0,0 +1,357 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of one circuit in a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through and counts failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests fast until OpenTimeout has passed.
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through; their outcome
+	// closes or reopens the circuit.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitOpenError is returned instead of sending a request while its
+// circuit is open, or half-open with all probe slots taken. HTTPErrorCode
+// reports it as 503 Service Unavailable.
+type CircuitOpenError struct {
+	// Key identifies the circuit, by default the request host.
+	Key string
+	// RetryAfter is how long until the circuit admits a probe. Zero while
+	// half-open.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s", e.Key)
+}
+
+// CircuitBreakerConfig controls when a CircuitBreaker trips and recovers.
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures trips the circuit after this many failures in a
+	// row. 0 disables the check.
+	ConsecutiveFailures int
+
+	// FailureRate trips the circuit when the fraction of failed requests
+	// in the current Window reaches it (0.5 = half), once at least
+	// MinRequests have completed. 0 disables the check.
+	FailureRate float64
+
+	// MinRequests is the number of requests a Window needs before
+	// FailureRate applies. Default: 1.
+	MinRequests int
+
+	// Window is the length of the fixed windows FailureRate is measured
+	// over. Default: 10s.
+	Window time.Duration
+
+	// OpenTimeout is how long the circuit stays open before admitting
+	// probes. Default: 30s.
+	OpenTimeout time.Duration
+
+	// HalfOpenProbes is the number of successful probes needed to close
+	// the circuit; at most this many run at once. Default: 1.
+	HalfOpenProbes int
+
+	// Key maps a request to its circuit. Default: the request host, so
+	// each upstream trips independently.
+	Key func(req *http.Request) string
+
+	// IsFailure classifies a completed request; err is a transport error
+	// and resp is nil when it is set. Default: transport errors, 429 and
+	// 5xx responses. Cancelled requests are never counted.
+	IsFailure func(resp *http.Response, err error) bool
+
+	// OnStateChange, if set, is called after a circuit changes state. It
+	// runs on the goroutine whose request caused the change.
+	OnStateChange func(key string, from, to CircuitState)
+}
+
+// DefaultCircuitBreakerConfig returns a config that trips after 5
+// consecutive failures or a 50% failure rate over 20+ requests in 10s, and
+// probes again after 30s.
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		ConsecutiveFailures: 5,
+		FailureRate:         0.5,
+		MinRequests:         20,
+		Window:              10 * time.Second,
+		OpenTimeout:         30 * time.Second,
+		HalfOpenProbes:      1,
+	}
+}
+
+// CircuitBreaker stops sending requests to an upstream that keeps failing,
+// so callers fail fast with *CircuitOpenError instead of waiting on
+// timeouts. Each key (by default each host) has its own circuit.
+//
+// Use it per call with WithCircuitBreaker, or for every request of a client
+// with RoundTripper:
+//
+//	breaker := gohttp.NewCircuitBreaker(gohttp.DefaultCircuitBreakerConfig())
+//	client := &http.Client{Transport: breaker.RoundTripper(nil)}
+type CircuitBreaker struct {
+	Config CircuitBreakerConfig
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+type circuit struct {
+	state CircuitState
+	// gen changes on every state change, so results of requests admitted
+	// under an earlier state are ignored.
+	gen       uint64
+	openUntil time.Time
+
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	probes         int // probes in flight
+	probeSuccesses int
+}
+
+// NewCircuitBreaker creates a CircuitBreaker, filling zero durations and
+// counts with their defaults.
+func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 1
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	return &CircuitBreaker{
+		Config:   cfg,
+		circuits: make(map[string]*circuit),
+		now:      time.Now,
+	}
+}
+
+// State returns the state of the circuit for key. An open circuit whose
+// OpenTimeout has passed still reports CircuitOpen until a request arrives.
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.circuits[key]; ok {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+// Allow asks whether a request on the circuit for key may proceed. If so,
+// the caller must call done with the outcome once the request completes.
+// Otherwise it returns a *CircuitOpenError.
+//
+// Allow is the building block for RoundTripper and WithCircuitBreaker;
+// use it directly to guard calls that are not HTTP requests.
+func (b *CircuitBreaker) Allow(key string) (done func(resp *http.Response, err error), err error) {
+	gen, probe, err := b.allow(key)
+	if err != nil {
+		return nil, err
+	}
+	return func(resp *http.Response, err error) {
+		b.record(key, gen, probe, resp, err)
+	}, nil
+}
+
+// RoundTripper wraps next (http.DefaultTransport if nil) so every request
+// goes through the breaker.
+func (b *CircuitBreaker) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &breakerTransport{breaker: b, next: next}
+}
+
+// WithCircuitBreaker guards the call with breaker. Combined with WithRetry,
+// each attempt goes through the breaker and a fast-fail ends the retries.
+func WithCircuitBreaker(breaker *CircuitBreaker) CallOption {
+	return func(cfg *callConfig) { cfg.breaker = breaker }
+}
+
+type breakerTransport struct {
+	breaker *CircuitBreaker
+	next    http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := t.breaker.Allow(t.breaker.key(req))
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	done(resp, err)
+	return resp, err
+}
+
+// guard runs one Call attempt through the breaker. HTTP error statuses
+// reach IsFailure as responses, not errors.
+func (b *CircuitBreaker) guard(req *http.Request, attempt func(*http.Request) ([]byte, *http.Response, error)) ([]byte, *http.Response, error) {
+	done, err := b.Allow(b.key(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	body, resp, err := attempt(req)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		done(resp, nil)
+	} else {
+		done(resp, err)
+	}
+	return body, resp, err
+}
+
+func (b *CircuitBreaker) key(req *http.Request) string {
+	if b.Config.Key != nil {
+		return b.Config.Key(req)
+	}
+	return req.URL.Host
+}
+
+func (b *CircuitBreaker) isFailure(resp *http.Response, err error) bool {
+	if b.Config.IsFailure != nil {
+		return b.Config.IsFailure(resp, err)
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+func (b *CircuitBreaker) allow(key string) (gen uint64, probe bool, err error) {
+	b.mu.Lock()
+	var changes []func()
+	defer func() {
+		b.mu.Unlock()
+		for _, f := range changes {
+			f()
+		}
+	}()
+
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{windowStart: b.now()}
+		b.circuits[key] = c
+	}
+	if c.state == CircuitOpen {
+		if wait := c.openUntil.Sub(b.now()); wait > 0 {
+			return 0, false, &CircuitOpenError{Key: key, RetryAfter: wait}
+		}
+		changes = append(changes, b.setState(key, c, CircuitHalfOpen))
+	}
+	if c.state == CircuitHalfOpen {
+		if c.probes+c.probeSuccesses >= b.Config.HalfOpenProbes {
+			return 0, false, &CircuitOpenError{Key: key}
+		}
+		c.probes++
+		return c.gen, true, nil
+	}
+	return c.gen, false, nil
+}
+
+func (b *CircuitBreaker) record(key string, gen uint64, probe bool, resp *http.Response, err error) {
+	if errors.Is(err, context.Canceled) {
+		err = nil
+		resp = nil // neither a success nor a failure
+	}
+	b.mu.Lock()
+	var changes []func()
+	defer func() {
+		b.mu.Unlock()
+		for _, f := range changes {
+			f()
+		}
+	}()
+
+	c := b.circuits[key]
+	if c == nil || c.gen != gen {
+		return
+	}
+	ignored := err == nil && resp == nil
+	failed := !ignored && b.isFailure(resp, err)
+
+	if probe {
+		c.probes--
+		switch {
+		case ignored:
+		case failed:
+			changes = append(changes, b.setState(key, c, CircuitOpen))
+		default:
+			if c.probeSuccesses++; c.probeSuccesses >= b.Config.HalfOpenProbes {
+				changes = append(changes, b.setState(key, c, CircuitClosed))
+			}
+		}
+		return
+	}
+	if ignored {
+		return
+	}
+
+	now := b.now()
+	if now.Sub(c.windowStart) >= b.Config.Window {
+		c.windowStart, c.requests, c.failures = now, 0, 0
+	}
+	c.requests++
+	if !failed {
+		c.consecutive = 0
+		return
+	}
+	c.failures++
+	c.consecutive++
+	cfg := b.Config
+	if (cfg.ConsecutiveFailures > 0 && c.consecutive >= cfg.ConsecutiveFailures) ||
+		(cfg.FailureRate > 0 && c.requests >= cfg.MinRequests && float64(c.failures)/float64(c.requests) >= cfg.FailureRate) {
+		changes = append(changes, b.setState(key, c, CircuitOpen))
+	}
+}
+
+// setState moves c to state and resets its counters. It returns the
+// OnStateChange call to make once the lock is released.
+func (b *CircuitBreaker) setState(key string, c *circuit, state CircuitState) func() {
+	from := c.state
+	now := b.now()
+	*c = circuit{state: state, gen: c.gen + 1, windowStart: now}
+	if state == CircuitOpen {
+		c.openUntil = now.Add(b.Config.OpenTimeout)
+	}
+	return func() {
+		if b.Config.OnStateChange != nil {
+			b.Config.OnStateChange(key, from, state)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for CircuitBreaker.now.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestBreaker(cfg CircuitBreakerConfig) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	b := NewCircuitBreaker(cfg)
+	b.now = clock.Now
+	return b, clock
+}
+
+// switchServer answers with the status in *status, counting requests.
+func switchServer(t *testing.T) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+	var status, calls atomic.Int32
+	status.Store(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &status, &calls
+}
+
+func TestCircuitBreaker_ConsecutiveFailuresAndRecovery(t *testing.T) {
+	srv, status, calls := switchServer(t)
+	var transitions []string
+	b, clock := newTestBreaker(CircuitBreakerConfig{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         time.Minute,
+		OnStateChange: func(key string, from, to CircuitState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	call := func() error {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		return CallVoid(context.Background(), req, WithCircuitBreaker(b))
+	}
+
+	status.Store(http.StatusInternalServerError)
+	for range 3 {
+		if HTTPErrorCode(call()) != 500 {
+			t.Fatal("expected 500 before the circuit trips")
+		}
+	}
+	err := call()
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || openErr.RetryAfter != time.Minute {
+		t.Fatalf("err = %v, want CircuitOpenError with RetryAfter 1m", err)
+	}
+	if HTTPErrorCode(err) != http.StatusServiceUnavailable {
+		t.Errorf("HTTPErrorCode = %d, want 503", HTTPErrorCode(err))
+	}
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want the open circuit to fail fast", calls.Load())
+	}
+
+	// After OpenTimeout a failing probe reopens the circuit...
+	clock.Advance(time.Minute)
+	if HTTPErrorCode(call()) != 500 || b.State(srv.Listener.Addr().String()) != CircuitOpen {
+		t.Fatal("failed probe did not reopen the circuit")
+	}
+	// ...and a successful one closes it.
+	clock.Advance(time.Minute)
+	status.Store(http.StatusOK)
+	if err := call(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := call(); err != nil {
+		t.Fatalf("after close: %v", err)
+	}
+	want := "closed->open open->half-open half-open->open open->half-open half-open->closed"
+	if got := strings.Join(transitions, " "); got != want {
+		t.Errorf("transitions = %s", got)
+	}
+}
+
+func TestCircuitBreaker_FailureRate(t *testing.T) {
+	b, clock := newTestBreaker(CircuitBreakerConfig{FailureRate: 0.5, MinRequests: 4, Window: time.Second})
+	ok := &http.Response{StatusCode: 200}
+	bad := &http.Response{StatusCode: 503}
+	record := func(resp *http.Response) {
+		done, err := b.Allow("k")
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		done(resp, nil)
+	}
+
+	// Alternating failures never reach a consecutive threshold. A new
+	// window starts the count again, and the rate is checked on failures:
+	// the fifth request makes it 3 of 5.
+	record(ok)
+	record(bad)
+	record(ok)
+	clock.Advance(time.Second)
+	record(bad)
+	record(ok)
+	record(bad)
+	if b.State("k") != CircuitClosed {
+		t.Fatal("tripped below MinRequests")
+	}
+	record(ok)
+	if b.State("k") != CircuitClosed {
+		t.Fatal("tripped on a success")
+	}
+	record(bad)
+	if b.State("k") != CircuitOpen {
+		t.Fatalf("state = %v, want open at 50%%", b.State("k"))
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbes(t *testing.T) {
+	b, clock := newTestBreaker(CircuitBreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Second, HalfOpenProbes: 2})
+	done, _ := b.Allow("k")
+	done(nil, errors.New("connection refused"))
+	clock.Advance(time.Second)
+
+	probe1, err1 := b.Allow("k")
+	probe2, err2 := b.Allow("k")
+	if err1 != nil || err2 != nil {
+		t.Fatalf("probes rejected: %v, %v", err1, err2)
+	}
+	var openErr *CircuitOpenError
+	if _, err := b.Allow("k"); !errors.As(err, &openErr) || openErr.RetryAfter != 0 {
+		t.Fatalf("third request while half-open = %v", err)
+	}
+
+	// A cancelled probe frees its slot without counting.
+	probe1(nil, context.Canceled)
+	probe3, err := b.Allow("k")
+	if err != nil {
+		t.Fatalf("slot not freed: %v", err)
+	}
+	probe2(&http.Response{StatusCode: 200}, nil)
+	if b.State("k") != CircuitHalfOpen {
+		t.Fatal("closed after one of two probes")
+	}
+	probe3(&http.Response{StatusCode: 204}, nil)
+	if b.State("k") != CircuitClosed {
+		t.Fatalf("state = %v, want closed", b.State("k"))
+	}
+}
+
+func TestCircuitBreaker_StaleResultsIgnored(t *testing.T) {
+	b, _ := newTestBreaker(CircuitBreakerConfig{ConsecutiveFailures: 1})
+	slow, _ := b.Allow("k")
+	fast, _ := b.Allow("k")
+	fast(&http.Response{StatusCode: 500}, nil)
+	slow(&http.Response{StatusCode: 200}, nil)
+	if b.State("k") != CircuitOpen {
+		t.Error("a request from before the trip changed the open circuit")
+	}
+}
+
+func TestCircuitBreaker_RoundTripperPerHost(t *testing.T) {
+	down, downStatus, downCalls := switchServer(t)
+	up, _, upCalls := switchServer(t)
+	downStatus.Store(http.StatusBadGateway)
+	b, _ := newTestBreaker(CircuitBreakerConfig{ConsecutiveFailures: 2})
+	client := &http.Client{Transport: b.RoundTripper(nil)}
+
+	for range 3 {
+		if resp, err := client.Get(down.URL); err == nil {
+			resp.Body.Close()
+		}
+	}
+	_, err := client.Get(down.URL)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("err = %v, want CircuitOpenError through url.Error", err)
+	}
+	if downCalls.Load() != 2 {
+		t.Errorf("down calls = %d, want 2", downCalls.Load())
+	}
+
+	resp, err := client.Get(up.URL)
+	if err != nil {
+		t.Fatalf("other host blocked: %v", err)
+	}
+	resp.Body.Close()
+	if upCalls.Load() != 1 {
+		t.Errorf("up calls = %d", upCalls.Load())
+	}
+}
+
+func TestCircuitBreaker_StopsRetries(t *testing.T) {
+	srv, status, calls := switchServer(t)
+	status.Store(http.StatusServiceUnavailable)
+	b, _ := newTestBreaker(CircuitBreakerConfig{ConsecutiveFailures: 2})
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+	err := CallVoid(context.Background(), req, WithRetry(policy), WithCircuitBreaker(b))
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Errorf("err = %v, want CircuitOpenError", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want retries to stop once the circuit opened", calls.Load())
+	}
+}
+
+func TestCircuitState_String(t *testing.T) {
+	if CircuitHalfOpen.String() != "half-open" || CircuitState(9).String() != "CircuitState(9)" {
+		t.Errorf("String = %q, %q", CircuitHalfOpen, CircuitState(9))
+	}
+}
@@ -0,0 +1,498 @@
+package http
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// CacheStore — storage for cached HTTP responses
+// ============================================================================
+
+// CachedResponse is a stored response, with what HTTPCache needs to judge
+// its freshness and revalidate it.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// VaryHeader holds the request's values of the headers named by the
+	// response's Vary header, to match later requests against.
+	VaryHeader http.Header
+
+	// StoredAt is when the response was received or last revalidated.
+	StoredAt time.Time
+}
+
+// CacheStore persists cached responses by key. Implementations must be
+// safe for concurrent use and may evict entries at any time. Stored
+// responses must be treated as immutable.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse)
+	Delete(key string)
+}
+
+// MemoryCacheStore is an in-memory CacheStore that evicts the least
+// recently used entries beyond a maximum count.
+type MemoryCacheStore struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	lru     *list.List // of *memoryCacheEntry, most recent first
+	entries map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key  string
+	resp *CachedResponse
+}
+
+// NewMemoryCacheStore creates a store holding up to maxEntries responses
+// (1000 if maxEntries <= 0).
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the response stored under key and marks it recently used.
+func (s *MemoryCacheStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	return el.Value.(*memoryCacheEntry).resp, true
+}
+
+// Set stores resp under key, evicting the least recently used entry if
+// the store is full.
+func (s *MemoryCacheStore) Set(key string, resp *CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		el.Value.(*memoryCacheEntry).resp = resp
+		s.lru.MoveToFront(el)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(&memoryCacheEntry{key: key, resp: resp})
+	for s.lru.Len() > s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+// Delete removes the response stored under key.
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.lru.Remove(el)
+		delete(s.entries, key)
+	}
+}
+
+// Len returns the number of stored responses.
+func (s *MemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// ============================================================================
+// HTTPCache — private HTTP cache (RFC 9111)
+// ============================================================================
+
+// HTTPCache is an opt-in private client cache for GET responses following
+// RFC 9111. It serves fresh responses from its store, revalidates stale
+// ones with If-None-Match / If-Modified-Since, and honours:
+//
+//   - Cache-Control max-age, no-cache, no-store and must-revalidate on
+//     responses, and no-cache, no-store and max-age=0 on requests
+//   - Expires, and a heuristic freshness of 10% of the time since
+//     Last-Modified when neither is given
+//   - Vary: a stored response is only used for requests with the same
+//     values of the varying headers; "Vary: *" is never stored
+//   - stale-while-revalidate: a stale response within the window is served
+//     immediately while it is revalidated in the background
+//
+// Successful unsafe requests (POST, PUT, ...) invalidate the cached
+// response for their URL. Requests with Range or their own conditional
+// headers bypass the cache.
+//
+// Entries are keyed by URL only, so responses to requests carrying an
+// Authorization header are stored only when marked Cache-Control: public.
+// Otherwise one caller's credentials could serve another caller's data.
+//
+// Use it per call with WithCache, or for a client with RoundTripper:
+//
+//	cache := gohttp.NewHTTPCache(nil)
+//	cfg, err := gohttp.Call[Config](ctx, req, gohttp.WithCache(cache))
+//
+// The zero value is usable and caches in a NewMemoryCacheStore(0).
+type HTTPCache struct {
+	// Store holds the responses. Default: NewMemoryCacheStore(0), created
+	// on first use.
+	Store CacheStore
+
+	// MaxBodySize is the largest body that is stored; larger responses
+	// pass through uncached. Default: 1 MB.
+	MaxBodySize int64
+
+	mu         sync.Mutex
+	revalidate map[string]bool // keys with a background revalidation running
+	now        func() time.Time
+}
+
+// NewHTTPCache creates a cache over store, or over a
+// NewMemoryCacheStore(0) if store is nil.
+func NewHTTPCache(store CacheStore) *HTTPCache {
+	if store == nil {
+		store = NewMemoryCacheStore(0)
+	}
+	return &HTTPCache{Store: store}
+}
+
+// cacheStore returns Store, creating the default memory store if unset.
+func (c *HTTPCache) cacheStore() CacheStore {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Store == nil {
+		c.Store = NewMemoryCacheStore(0)
+	}
+	return c.Store
+}
+
+func (c *HTTPCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// WithCache serves the call through cache.
+func WithCache(cache *HTTPCache) CallOption {
+	return WithClientMiddleware(cache.RoundTripper)
+}
+
+// RoundTripper wraps next (http.DefaultTransport if nil) with the cache.
+func (c *HTTPCache) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return c.roundTrip(req, next)
+	})
+}
+
+func (c *HTTPCache) roundTrip(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	key := req.URL.String()
+	if req.Method != http.MethodGet && req.Method != "" {
+		resp, err := next.RoundTrip(req)
+		if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions && resp.StatusCode < 400 {
+			c.cacheStore().Delete(key) // RFC 9111 §4.4
+		}
+		return resp, err
+	}
+	reqCC := parseCacheControl(req.Header.Get("Cache-Control"))
+	if _, ok := reqCC["no-store"]; ok || req.Header.Get("Range") != "" ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return next.RoundTrip(req)
+	}
+
+	cached, ok := c.cacheStore().Get(key)
+	if ok && !varyMatches(cached, req) {
+		ok = false
+	}
+	if ok {
+		now := c.clock()
+		age := cached.age(now)
+		lifetime := cached.freshnessLifetime()
+		respCC := parseCacheControl(cached.Header.Get("Cache-Control"))
+		_, reqNoCache := reqCC["no-cache"]
+		_, respNoCache := respCC["no-cache"]
+		_, mustRevalidate := respCC["must-revalidate"]
+		mustCheck := reqNoCache || respNoCache || reqCC["max-age"] == "0"
+		if maxAge, ok := directiveSeconds(reqCC, "max-age"); ok && age > maxAge {
+			mustCheck = true
+		}
+
+		if !mustCheck && age < lifetime {
+			return cached.response(req, age), nil
+		}
+		if !mustCheck && !mustRevalidate {
+			if swr, ok := directiveSeconds(respCC, "stale-while-revalidate"); ok && age < lifetime+swr {
+				c.revalidateInBackground(key, req, cached, next)
+				return cached.response(req, age), nil
+			}
+		}
+		return c.revalidateNow(key, req, cached, next)
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.store(key, req, resp)
+}
+
+// revalidateNow sends a conditional request for cached and returns the
+// cached body on 304, or the new response.
+func (c *HTTPCache) revalidateNow(key string, req *http.Request, cached *CachedResponse, next http.RoundTripper) (*http.Response, error) {
+	resp, err := next.RoundTrip(conditionalRequest(req, cached))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		updated := c.refresh(key, cached, resp)
+		return updated.response(req, 0), nil
+	}
+	return c.store(key, req, resp)
+}
+
+func (c *HTTPCache) revalidateInBackground(key string, req *http.Request, cached *CachedResponse, next http.RoundTripper) {
+	c.mu.Lock()
+	if c.revalidate[key] {
+		c.mu.Unlock()
+		return
+	}
+	if c.revalidate == nil {
+		c.revalidate = make(map[string]bool)
+	}
+	c.revalidate[key] = true
+	c.mu.Unlock()
+
+	bg := req.Clone(context.WithoutCancel(req.Context()))
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidate, key)
+			c.mu.Unlock()
+		}()
+		resp, err := c.revalidateNow(key, bg, cached, next)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+}
+
+// refresh updates cached with the headers of a 304 (RFC 9111 §4.3.4) and
+// stores the result.
+func (c *HTTPCache) refresh(key string, cached *CachedResponse, notModified *http.Response) *CachedResponse {
+	updated := &CachedResponse{
+		StatusCode: cached.StatusCode,
+		Header:     cached.Header.Clone(),
+		Body:       cached.Body,
+		VaryHeader: cached.VaryHeader,
+		StoredAt:   c.clock(),
+	}
+	for k, v := range notModified.Header {
+		if k == "Content-Length" {
+			continue
+		}
+		updated.Header[k] = v
+	}
+	c.cacheStore().Set(key, updated)
+	return updated
+}
+
+// store saves resp if it is cacheable and returns a response whose body
+// can still be read by the caller.
+func (c *HTTPCache) store(key string, req *http.Request, resp *http.Response) (*http.Response, error) {
+	if !isCacheable(resp) || !sharedAuthorized(req, resp) {
+		return resp, nil
+	}
+	maxBody := c.MaxBodySize
+	if maxBody <= 0 {
+		maxBody = 1 << 20
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > maxBody {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := &CachedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		VaryHeader: http.Header{},
+		StoredAt:   c.clock(),
+	}
+	for _, name := range varyNames(resp.Header) {
+		if v, ok := req.Header[http.CanonicalHeaderKey(name)]; ok {
+			entry.VaryHeader[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	c.cacheStore().Set(key, entry)
+	return resp, nil
+}
+
+// isCacheable reports whether a GET response may be stored: a cacheable
+// status, no no-store or Vary: *, and either explicit freshness or a
+// validator to revalidate with.
+func isCacheable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+	default:
+		return false
+	}
+	cc := parseCacheControl(resp.Header.Get("Cache-Control"))
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	for _, name := range varyNames(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	_, hasMaxAge := cc["max-age"]
+	return hasMaxAge || resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+// sharedAuthorized reports whether resp may be stored under its URL alone:
+// true unless req carried Authorization and resp is not marked public.
+func sharedAuthorized(req *http.Request, resp *http.Response) bool {
+	if req.Header.Get("Authorization") == "" {
+		return true
+	}
+	_, public := parseCacheControl(resp.Header.Get("Cache-Control"))["public"]
+	return public
+}
+
+func conditionalRequest(req *http.Request, cached *CachedResponse) *http.Request {
+	cond := req.Clone(req.Context())
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if lm := cached.Header.Get("Last-Modified"); lm != "" {
+		cond.Header.Set("If-Modified-Since", lm)
+	}
+	return cond
+}
+
+func varyMatches(cached *CachedResponse, req *http.Request) bool {
+	for _, name := range varyNames(cached.Header) {
+		key := http.CanonicalHeaderKey(name)
+		if strings.Join(cached.VaryHeader[key], ",") != strings.Join(req.Header[key], ",") {
+			return false
+		}
+	}
+	return true
+}
+
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for name := range strings.SplitSeq(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// freshnessLifetime implements RFC 9111 §4.2.1 for a private cache.
+func (r *CachedResponse) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(r.Header.Get("Cache-Control"))
+	if maxAge, ok := directiveSeconds(cc, "max-age"); ok {
+		return maxAge
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		date = r.StoredAt
+	}
+	if expires := r.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0 // invalid Expires means already expired
+		}
+		return t.Sub(date)
+	}
+	if lm, err := http.ParseTime(r.Header.Get("Last-Modified")); err == nil && date.After(lm) {
+		return min(date.Sub(lm)/10, 24*time.Hour)
+	}
+	return 0
+}
+
+// age is the current age of the response (RFC 9111 §4.2.3, simplified to
+// the Age header plus the time spent in this cache).
+func (r *CachedResponse) age(now time.Time) time.Duration {
+	age := now.Sub(r.StoredAt)
+	if initial, err := strconv.Atoi(r.Header.Get("Age")); err == nil && initial > 0 {
+		age += time.Duration(initial) * time.Second
+	}
+	return max(age, 0)
+}
+
+func (r *CachedResponse) response(req *http.Request, age time.Duration) *http.Response {
+	header := r.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(age/time.Second)))
+	return &http.Response{
+		Status:        strconv.Itoa(r.StatusCode) + " " + http.StatusText(r.StatusCode),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// parseCacheControl splits a Cache-Control value into lowercased
+// directives and their unquoted arguments.
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for part := range strings.SplitSeq(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+		directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+	}
+	return directives
+}
+
+func directiveSeconds(cc map[string]string, name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
@@ -0,0 +1,287 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cacheServer serves body with the given headers, answering conditional
+// requests for etag with 304, and counts the requests it receives.
+func cacheServer(t *testing.T, etag string, header map[string]string) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+	var hits, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		for k, v := range header {
+			w.Header().Set(k, v)
+		}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"n":` + r.Header.Get("X-N") + `1}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits, &notModified
+}
+
+func newTestCache() (*HTTPCache, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	c := NewHTTPCache(nil)
+	c.now = clock.Now
+	return c, clock
+}
+
+func cachedGet(t *testing.T, c *HTTPCache, url string, header ...string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := (&http.Client{Transport: c.RoundTripper(nil)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestHTTPCache_MaxAge(t *testing.T) {
+	srv, hits, _ := cacheServer(t, "", map[string]string{"Cache-Control": "max-age=60"})
+	c, clock := newTestCache()
+
+	for range 3 {
+		if code, body := cachedGet(t, c, srv.URL); code != 200 || body != `{"n":1}` {
+			t.Fatalf("got %d %s", code, body)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("hits = %d, want 1", hits.Load())
+	}
+	clock.Advance(61 * time.Second)
+	cachedGet(t, c, srv.URL)
+	if hits.Load() != 2 {
+		t.Errorf("hits = %d after expiry, want 2", hits.Load())
+	}
+
+	// Request no-cache forces a round trip.
+	cachedGet(t, c, srv.URL, "Cache-Control", "no-cache")
+	if hits.Load() != 3 {
+		t.Errorf("hits = %d after no-cache, want 3", hits.Load())
+	}
+}
+
+func TestHTTPCache_ETagRevalidation(t *testing.T) {
+	srv, hits, notModified := cacheServer(t, `"v1"`, map[string]string{"Cache-Control": "no-cache"})
+	c, _ := newTestCache()
+
+	for range 3 {
+		if code, body := cachedGet(t, c, srv.URL); code != 200 || body != `{"n":1}` {
+			t.Fatalf("got %d %s", code, body)
+		}
+	}
+	if hits.Load() != 3 || notModified.Load() != 2 {
+		t.Errorf("hits = %d, 304s = %d; want 3 and 2", hits.Load(), notModified.Load())
+	}
+}
+
+func TestHTTPCache_LastModified(t *testing.T) {
+	lastModified := time.Unix(1_000_000, 0).Add(-10 * time.Hour).UTC().Format(http.TimeFormat)
+	var conditional atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Unix(1_000_000, 0).UTC().Format(http.TimeFormat))
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("doc"))
+	}))
+	defer srv.Close()
+	c, clock := newTestCache()
+
+	cachedGet(t, c, srv.URL)
+	clock.Advance(30 * time.Minute) // within the 1h heuristic lifetime
+	cachedGet(t, c, srv.URL)
+	if conditional.Load() != 0 {
+		t.Fatal("revalidated within heuristic freshness")
+	}
+	clock.Advance(time.Hour)
+	if _, body := cachedGet(t, c, srv.URL); body != "doc" || conditional.Load() != 1 {
+		t.Errorf("body = %q, conditional = %d", body, conditional.Load())
+	}
+}
+
+func TestHTTPCache_Vary(t *testing.T) {
+	srv, hits, _ := cacheServer(t, "", map[string]string{"Cache-Control": "max-age=60", "Vary": "X-N"})
+	c, _ := newTestCache()
+
+	if _, body := cachedGet(t, c, srv.URL, "X-N", "1"); body != `{"n":11}` {
+		t.Fatalf("body = %s", body)
+	}
+	if _, body := cachedGet(t, c, srv.URL, "X-N", "1"); body != `{"n":11}` || hits.Load() != 1 {
+		t.Fatalf("same variant: body = %s, hits = %d", body, hits.Load())
+	}
+	if _, body := cachedGet(t, c, srv.URL, "X-N", "2"); body != `{"n":21}` || hits.Load() != 2 {
+		t.Errorf("other variant: body = %s, hits = %d", body, hits.Load())
+	}
+}
+
+func TestHTTPCache_NotStored(t *testing.T) {
+	for _, cc := range []string{"no-store", ""} {
+		srv, hits, _ := cacheServer(t, "", map[string]string{"Cache-Control": cc})
+		c, _ := newTestCache()
+		cachedGet(t, c, srv.URL)
+		cachedGet(t, c, srv.URL)
+		if hits.Load() != 2 {
+			t.Errorf("Cache-Control %q: hits = %d, want 2", cc, hits.Load())
+		}
+	}
+}
+
+func TestHTTPCache_StaleWhileRevalidate(t *testing.T) {
+	srv, hits, notModified := cacheServer(t, `"v1"`, map[string]string{"Cache-Control": "max-age=10, stale-while-revalidate=60"})
+	c, clock := newTestCache()
+
+	cachedGet(t, c, srv.URL)
+	clock.Advance(30 * time.Second)
+	if code, body := cachedGet(t, c, srv.URL); code != 200 || body != `{"n":1}` {
+		t.Fatalf("stale response = %d %s", code, body)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for notModified.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if notModified.Load() != 1 {
+		t.Fatal("no background revalidation")
+	}
+
+	// The revalidated entry is fresh again.
+	for c.revalidating() {
+		time.Sleep(time.Millisecond)
+	}
+	cachedGet(t, c, srv.URL)
+	if hits.Load() != 2 {
+		t.Errorf("hits = %d, want 2", hits.Load())
+	}
+}
+
+func (c *HTTPCache) revalidating() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.revalidate) > 0
+}
+
+func TestHTTPCache_UnsafeMethodInvalidates(t *testing.T) {
+	srv, hits, _ := cacheServer(t, "", map[string]string{"Cache-Control": "max-age=60"})
+	c, _ := newTestCache()
+	client := &http.Client{Transport: c.RoundTripper(nil)}
+
+	cachedGet(t, c, srv.URL)
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	cachedGet(t, c, srv.URL)
+	if hits.Load() != 3 {
+		t.Errorf("hits = %d, want 3", hits.Load())
+	}
+}
+
+func TestHTTPCache_LargeBodyPassesThrough(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+	c, _ := newTestCache()
+	c.MaxBodySize = 10
+
+	if _, body := cachedGet(t, c, srv.URL); len(body) != 100 {
+		t.Errorf("body length = %d, want 100", len(body))
+	}
+	if _, ok := c.Store.Get(srv.URL); ok {
+		t.Error("oversized body stored")
+	}
+}
+
+func TestHTTPCache_ZeroValue(t *testing.T) {
+	srv, hits, _ := cacheServer(t, `"v1"`, map[string]string{"Cache-Control": "max-age=0, stale-while-revalidate=60"})
+	c := &HTTPCache{}
+	for range 3 {
+		if code, body := cachedGet(t, c, srv.URL); code != 200 || body != `{"n":1}` {
+			t.Fatalf("got %d %s", code, body)
+		}
+	}
+	for c.revalidating() {
+		time.Sleep(time.Millisecond)
+	}
+	if c.Store == nil || hits.Load() < 2 {
+		t.Errorf("store = %v, hits = %d", c.Store, hits.Load())
+	}
+}
+
+func TestHTTPCache_Authorization(t *testing.T) {
+	for _, tc := range []struct {
+		cc       string
+		wantHits int32
+	}{
+		{"max-age=60", 2},
+		{"public, max-age=60", 1},
+	} {
+		srv, hits, _ := cacheServer(t, "", map[string]string{"Cache-Control": tc.cc})
+		c, _ := newTestCache()
+		cachedGet(t, c, srv.URL, "Authorization", "Bearer alice")
+		cachedGet(t, c, srv.URL, "Authorization", "Bearer bob")
+		if hits.Load() != tc.wantHits {
+			t.Errorf("Cache-Control %q: hits = %d, want %d", tc.cc, hits.Load(), tc.wantHits)
+		}
+	}
+}
+
+func TestCall_WithCache(t *testing.T) {
+	srv, hits, _ := cacheServer(t, "", map[string]string{"Cache-Control": "max-age=60"})
+	c := NewHTTPCache(nil)
+	for range 2 {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		got, err := Call[streamItem](context.Background(), req, WithCache(c))
+		if err != nil || got.N != 1 {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("hits = %d, want 1", hits.Load())
+	}
+}
+
+func TestMemoryCacheStore_LRU(t *testing.T) {
+	s := NewMemoryCacheStore(2)
+	s.Set("a", &CachedResponse{})
+	s.Set("b", &CachedResponse{})
+	s.Get("a")
+	s.Set("c", &CachedResponse{})
+	if _, ok := s.Get("b"); ok {
+		t.Error("least recently used entry not evicted")
+	}
+	if _, ok := s.Get("a"); !ok || s.Len() != 2 {
+		t.Errorf("a present = %v, len = %d", ok, s.Len())
+	}
+	s.Delete("a")
+	if s.Len() != 1 {
+		t.Errorf("len = %d after delete", s.Len())
+	}
+}
@@ -0,0 +1,374 @@
+package http
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Content types used by the request builders and response decoding.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeForm     = "application/x-www-form-urlencoded"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// ResponseDecoder decodes a 2xx response body for Call. out is a pointer
+// to the Call's T.
+type ResponseDecoder func(body []byte, header http.Header, out any) error
+
+// WithResponseDecoder replaces Call's default JSON/protobuf decoding, e.g.
+// with xml.Unmarshal:
+//
+//	WithResponseDecoder(func(body []byte, _ http.Header, out any) error {
+//	    return xml.Unmarshal(body, out)
+//	})
+func WithResponseDecoder(decoder ResponseDecoder) CallOption {
+	return func(cfg *callConfig) { cfg.decoder = decoder }
+}
+
+// WithQuery adds query parameters to the request URL, keeping existing
+// ones. v is anything EncodeQuery accepts; an encoding error fails the
+// call before it is sent.
+func WithQuery(v any) CallOption {
+	values, err := EncodeQuery(v)
+	return func(cfg *callConfig) {
+		if err != nil {
+			cfg.err = err
+			return
+		}
+		if cfg.query == nil {
+			cfg.query = url.Values{}
+		}
+		for k, vs := range values {
+			cfg.query[k] = append(cfg.query[k], vs...)
+		}
+	}
+}
+
+// WithResponseHeader stores the response headers in *dst once the call
+// completes, including for error responses.
+func WithResponseHeader(dst *http.Header) CallOption {
+	return func(cfg *callConfig) { cfg.header = dst }
+}
+
+// WithErrorBody decodes JSON error bodies of non-2xx responses into a *E,
+// stored in HTTPError.Detail. If *E implements error, errors.As reaches it
+// through the *HTTPError:
+//
+//	type APIError struct{ Code, Message string }
+//	func (e *APIError) Error() string { return e.Message }
+//
+//	_, err := Call[User](ctx, req, WithErrorBody[APIError]())
+//	var apiErr *APIError
+//	if errors.As(err, &apiErr) { ... }
+//
+// Bodies that do not decode leave Detail nil.
+func WithErrorBody[E any]() CallOption {
+	return func(cfg *callConfig) {
+		cfg.errorBody = func(body []byte) any {
+			detail := new(E)
+			if err := json.Unmarshal(body, detail); err != nil {
+				return nil
+			}
+			return detail
+		}
+	}
+}
+
+// HTTPErrorDetail returns the error body decoded by WithErrorBody[E] from
+// the *HTTPError in err's chain.
+func HTTPErrorDetail[E any](err error) (*E, bool) {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return nil, false
+	}
+	detail, ok := httpErr.Detail.(*E)
+	return detail, ok
+}
+
+// decodeResponse decodes body into a T. Proto messages are decoded with
+// proto.Unmarshal for protobuf content types and protojson otherwise.
+func decodeResponse[T any](body []byte, header http.Header, decoder ResponseDecoder) (T, error) {
+	var out T
+	if decoder != nil {
+		err := decoder(body, header, &out)
+		return out, err
+	}
+	if msg, ok := newProtoMessage[T](); ok {
+		var err error
+		if isProtobufContentType(header.Get("Content-Type")) {
+			err = proto.Unmarshal(body, msg)
+		} else {
+			err = protojson.Unmarshal(body, msg)
+		}
+		if err != nil {
+			return out, err
+		}
+		return msg.(T), nil
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		var zero T
+		return zero, err
+	}
+	return out, nil
+}
+
+// newProtoMessage allocates a T if T is a proto.Message pointer type.
+func newProtoMessage[T any]() (proto.Message, bool) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Pointer || !t.Implements(reflect.TypeFor[proto.Message]()) {
+		return nil, false
+	}
+	return reflect.New(t.Elem()).Interface().(proto.Message), true
+}
+
+func isProtobufContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case ContentTypeProtobuf, "application/protobuf", "application/vnd.google.protobuf":
+		return true
+	}
+	return false
+}
+
+// NewFormRequest builds a request with an application/x-www-form-urlencoded
+// body. form is anything EncodeQuery accepts.
+func NewFormRequest(method, endpoint string, form any) (*http.Request, error) {
+	values, err := EncodeQuery(form)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", ContentTypeForm)
+	return req, nil
+}
+
+// MultipartFile is a file part for NewMultipartRequest.
+type MultipartFile struct {
+	// Field is the form field name.
+	Field string
+	// Filename is sent in the part's Content-Disposition.
+	Filename string
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+	// Content is read fully when the request is built.
+	Content io.Reader
+}
+
+// NewMultipartRequest builds a multipart/form-data request from form fields
+// (anything EncodeQuery accepts, or nil) and files. The body is buffered so
+// the request can be retried.
+func NewMultipartRequest(method, endpoint string, fields any, files ...MultipartFile) (*http.Request, error) {
+	values, err := EncodeQuery(fields)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, vs := range values {
+		for _, v := range vs {
+			if err := mw.WriteField(k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, f := range files {
+		contentType := f.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := make(map[string][]string)
+		h["Content-Disposition"] = []string{mime.FormatMediaType("form-data", map[string]string{"name": f.Field, "filename": f.Filename})}
+		h["Content-Type"] = []string{contentType}
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(part, f.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, endpoint, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req, nil
+}
+
+// NewProtoRequest builds a request with msg in the protobuf binary
+// encoding, asking for a protobuf response.
+func NewProtoRequest(method, endpoint string, msg proto.Message) (*http.Request, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", ContentTypeProtobuf)
+	req.Header.Set("Accept", ContentTypeProtobuf)
+	return req, nil
+}
+
+// NewProtoJSONRequest builds a request with msg encoded by protojson.
+func NewProtoJSONRequest(method, endpoint string, msg proto.Message) (*http.Request, error) {
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return NewBytesRequest(method, endpoint, data)
+}
+
+// EncodeQuery converts v into url.Values. v may be nil, url.Values,
+// map[string]string, map[string][]string, or a struct (or pointer to one).
+//
+// Struct fields are named by their `url` tag, then their `json` tag, then
+// the field name; "-" skips a field and ",omitempty" skips zero values.
+// Supported field types are strings, bools, numbers, time.Time (RFC 3339),
+// encoding.TextMarshaler and fmt.Stringer values, pointers to these (nil
+// is skipped) and slices of these (one value per element). Embedded
+// structs are flattened.
+func EncodeQuery(v any) (url.Values, error) {
+	values := url.Values{}
+	switch v := v.(type) {
+	case nil:
+		return values, nil
+	case url.Values:
+		for k, vs := range v {
+			values[k] = append([]string(nil), vs...)
+		}
+		return values, nil
+	case map[string][]string:
+		for k, vs := range v {
+			values[k] = append([]string(nil), vs...)
+		}
+		return values, nil
+	case map[string]string:
+		for k, s := range v {
+			values.Set(k, s)
+		}
+		return values, nil
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return values, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("EncodeQuery: unsupported type %T", v)
+	}
+	return values, encodeStruct(values, rv)
+}
+
+func encodeStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("url") == "" {
+			if err := encodeStruct(values, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, omitEmpty := queryFieldName(field)
+		if name == "-" {
+			continue
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for j := range fv.Len() {
+				s, ok, err := formatQueryValue(fv.Index(j))
+				if err != nil {
+					return fmt.Errorf("EncodeQuery: field %s: %w", field.Name, err)
+				}
+				if ok {
+					values.Add(name, s)
+				}
+			}
+			continue
+		}
+		s, ok, err := formatQueryValue(fv)
+		if err != nil {
+			return fmt.Errorf("EncodeQuery: field %s: %w", field.Name, err)
+		}
+		if ok {
+			values.Add(name, s)
+		}
+	}
+	return nil
+}
+
+func queryFieldName(field reflect.StructField) (name string, omitEmpty bool) {
+	tag, ok := field.Tag.Lookup("url")
+	if !ok {
+		tag = field.Tag.Get("json")
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, opts == "omitempty" || strings.Contains(","+opts+",", ",omitempty,")
+}
+
+// formatQueryValue formats one value; ok is false for nil pointers.
+func formatQueryValue(v reflect.Value) (s string, ok bool, err error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false, nil
+		}
+		v = v.Elem()
+	}
+	switch x := v.Interface().(type) {
+	case time.Time:
+		return x.Format(time.RFC3339), true, nil
+	case encoding.TextMarshaler:
+		b, err := x.MarshalText()
+		return string(b), err == nil, err
+	case fmt.Stringer:
+		return x.String(), true, nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), true, nil
+	}
+	return "", false, fmt.Errorf("unsupported type %s", v.Type())
+}
@@ -0,0 +1,256 @@
+package http
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type querySearch struct {
+	Q       string    `url:"q"`
+	Page    int       `url:"page,omitempty"`
+	Tags    []string  `url:"tag"`
+	Since   time.Time `url:"since,omitempty"`
+	Limit   *int      `json:"limit"`
+	Skip    string    `url:"-"`
+	Verbose bool
+	queryEmbedded
+}
+
+type queryEmbedded struct {
+	Sort string `url:"sort,omitempty"`
+}
+
+func TestEncodeQuery(t *testing.T) {
+	limit := 5
+	v, err := EncodeQuery(&querySearch{
+		Q:             "go http",
+		Tags:          []string{"a", "b"},
+		Since:         time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Limit:         &limit,
+		Skip:          "x",
+		queryEmbedded: queryEmbedded{Sort: "asc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Verbose=false&limit=5&q=go+http&since=2025-01-02T03%3A04%3A05Z&sort=asc&tag=a&tag=b"
+	if got := v.Encode(); got != want {
+		t.Errorf("EncodeQuery = %s\nwant          %s", got, want)
+	}
+
+	if v, _ := EncodeQuery(map[string]string{"a": "1"}); v.Get("a") != "1" {
+		t.Errorf("map = %v", v)
+	}
+	if _, err := EncodeQuery(42); err == nil {
+		t.Error("EncodeQuery(int) should fail")
+	}
+	if _, err := EncodeQuery(struct{ C chan int }{}); err == nil {
+		t.Error("unsupported field type should fail")
+	}
+}
+
+func TestWithQuery(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.RawQuery
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"?keep=1", nil)
+	if err := CallVoid(context.Background(), req, WithQuery(querySearch{Q: "x", Page: 2})); err != nil {
+		t.Fatal(err)
+	}
+	if got != "Verbose=false&keep=1&page=2&q=x" {
+		t.Errorf("query = %s", got)
+	}
+	if req.URL.RawQuery != "keep=1" {
+		t.Errorf("caller's request modified: %s", req.URL.RawQuery)
+	}
+
+	if err := CallVoid(context.Background(), req, WithQuery(3.5)); err == nil {
+		t.Error("bad query value should fail the call")
+	}
+}
+
+func TestNewFormRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"` + r.PostForm.Get("name") + `","age":` + r.PostForm.Get("age") + `}`))
+	}))
+	defer srv.Close()
+
+	req, err := NewFormRequest("POST", srv.URL, struct {
+		Name string `url:"name"`
+		Age  int    `url:"age"`
+	}{"ann", 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Call[callTestUser](context.Background(), req)
+	if err != nil || got.Name != "ann" || got.Age != 7 {
+		t.Errorf("got %+v, %v", got, err)
+	}
+}
+
+func TestNewMultipartRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		f, hdr, err := r.FormFile("upload")
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		w.Write([]byte(r.FormValue("title") + "|" + hdr.Filename + "|" + hdr.Header.Get("Content-Type") + "|" + string(data)))
+	}))
+	defer srv.Close()
+
+	req, err := NewMultipartRequest("POST", srv.URL, map[string]string{"title": "report"},
+		MultipartFile{Field: "upload", Filename: "r.txt", ContentType: "text/plain", Content: strings.NewReader("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := CallRaw(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "report|r.txt|text/plain|hello" {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestCall_Proto(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		in := &wrapperspb.StringValue{}
+		if r.Header.Get("Content-Type") == ContentTypeProtobuf {
+			proto.Unmarshal(data, in)
+		} else {
+			protojson.Unmarshal(data, in)
+		}
+		out := wrapperspb.String("echo:" + in.GetValue())
+		if r.Header.Get("Accept") == ContentTypeProtobuf {
+			w.Header().Set("Content-Type", ContentTypeProtobuf)
+			data, _ = proto.Marshal(out)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			data, _ = protojson.Marshal(out)
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	req, _ := NewProtoRequest("POST", srv.URL, wrapperspb.String("bin"))
+	got, err := Call[*wrapperspb.StringValue](context.Background(), req)
+	if err != nil || got.GetValue() != "echo:bin" {
+		t.Errorf("binary: %v, %v", got, err)
+	}
+
+	req, _ = NewProtoJSONRequest("POST", srv.URL, wrapperspb.String("json"))
+	got, err = Call[*wrapperspb.StringValue](context.Background(), req)
+	if err != nil || got.GetValue() != "echo:json" {
+		t.Errorf("protojson: %v, %v", got, err)
+	}
+}
+
+func TestCall_ResponseDecoderAndHeader(t *testing.T) {
+	srv := newJSONServer(t, 200, `<user><name>xi</name></user>`, map[string]string{"Content-Type": "application/xml", "X-Rate": "9"})
+	defer srv.Close()
+	type xmlUser struct {
+		Name string `xml:"name"`
+	}
+	var header http.Header
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	got, err := Call[xmlUser](context.Background(), req,
+		WithResponseHeader(&header),
+		WithResponseDecoder(func(body []byte, h http.Header, out any) error {
+			return xml.Unmarshal(body, out)
+		}))
+	if err != nil || got.Name != "xi" {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	if header.Get("X-Rate") != "9" {
+		t.Errorf("captured header = %v", header)
+	}
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string { return e.Code + ": " + e.Message }
+
+func TestCall_ErrorBody(t *testing.T) {
+	srv := newJSONServer(t, 409, `{"code":"conflict","message":"exists"}`, nil)
+	defer srv.Close()
+	var header http.Header
+	req, _ := http.NewRequest("POST", srv.URL, nil)
+	_, err := Call[callTestUser](context.Background(), req, WithErrorBody[apiError](), WithResponseHeader(&header))
+
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.Code != "conflict" {
+		t.Fatalf("errors.As = %v", err)
+	}
+	if d, ok := HTTPErrorDetail[apiError](err); !ok || d.Message != "exists" {
+		t.Errorf("HTTPErrorDetail = %v, %v", d, ok)
+	}
+	if HTTPErrorCode(err) != 409 || header.Get("Content-Type") != "application/json" {
+		t.Errorf("code = %d, header = %v", HTTPErrorCode(err), header)
+	}
+
+	srv2 := newJSONServer(t, 500, `not json`, map[string]string{"Content-Type": "text/plain"})
+	defer srv2.Close()
+	req, _ = http.NewRequest("GET", srv2.URL, nil)
+	_, err = Call[callTestUser](context.Background(), req, WithErrorBody[apiError]())
+	if _, ok := HTTPErrorDetail[apiError](err); ok || HTTPErrorCode(err) != 500 {
+		t.Errorf("undecodable body: %v", err)
+	}
+}
+
+func TestCallRaw_Streams(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := CallRaw(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != "first\n" {
+		t.Errorf("read before the stream ended = %q, %v", buf, err)
+	}
+
+	errSrv := newJSONServer(t, 404, `{"missing":true}`, nil)
+	defer errSrv.Close()
+	req, _ = http.NewRequest("GET", errSrv.URL, nil)
+	if _, err := CallRaw(context.Background(), req); HTTPErrorCode(err) != 404 {
+		t.Errorf("CallRaw 404 err = %v", err)
+	}
+}
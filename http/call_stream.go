@@ -0,0 +1,183 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"reflect"
+)
+
+// ContentTypeNDJSON is the newline-delimited JSON media type.
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// StreamError is yielded by CallStream when an SSE stream ends with an
+// error event, as sent by StreamableServe for StreamResponse.Err.
+type StreamError struct {
+	Message string
+}
+
+func (e *StreamError) Error() string {
+	return "stream error: " + e.Message
+}
+
+// WithStreamErrorEvent sets the SSE event name CallStream treats as a
+// terminal error. Default: "error", matching StreamableConfig.ErrorEvent.
+func WithStreamErrorEvent(name string) CallOption {
+	return func(cfg *callConfig) { cfg.errorEvent = name }
+}
+
+// CallStream performs req and yields the items of a streamed response,
+// decoded into T like Call decodes its body. The response shape is chosen
+// by Content-Type:
+//
+//   - text/event-stream: one item per event with data. Comment-only events
+//     (keepalives) are skipped; an error event ends the stream with a
+//     *StreamError.
+//   - application/x-ndjson (or application/jsonl): one item per line.
+//   - anything else is decoded as JSON: an array yields its elements
+//     (the shape StreamableServe collects a stream into for clients that
+//     do not accept SSE) and any other value yields a single item.
+//
+// Without an Accept header, req accepts all three. Without WithClient,
+// a copy of DefaultHttpClient with no Timeout is used, since a client
+// timeout also covers reading the body and would cut long streams short;
+// bound the call with ctx instead. Request failures,
+// including non-2xx responses, are yielded once as the error. The response
+// is closed when iteration stops, the stream ends, or ctx is cancelled
+// (which yields ctx.Err()).
+//
+// Usage:
+//
+//	for ev, err := range gohttp.CallStream[Progress](ctx, req) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    handle(ev)
+//	}
+func CallStream[T any](ctx context.Context, req *http.Request, opts ...CallOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		streamClient := *DefaultHttpClient
+		streamClient.Timeout = 0
+		cfg := newCallConfig(append([]CallOption{WithClient(&streamClient)}, opts...))
+		cfg.raw = true
+		if req.Header.Get("Accept") == "" {
+			req = req.Clone(ctx)
+			req.Header.Set("Accept", "text/event-stream, "+ContentTypeNDJSON+", "+ContentTypeJSON)
+		}
+		_, resp, err := doCall(ctx, req, cfg)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		// Report ctx.Err() rather than the read error a cancelled ctx causes.
+		fail := func(err error) {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+			}
+			yield(zero, err)
+		}
+		item := func(data []byte) bool {
+			v, err := decodeResponse[T](data, resp.Header, cfg.decoder)
+			if err != nil {
+				yield(zero, err)
+				return false
+			}
+			return yield(v, nil)
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/event-stream":
+			errorEvent := cfg.errorEvent
+			if errorEvent == "" {
+				errorEvent = "error"
+			}
+			reader := NewSSEEventReader(resp.Body)
+			for {
+				ev, err := reader.ReadEvent()
+				if err != nil {
+					// An event cut off by EOF, with no terminating blank
+					// line, is not dispatched (as in SSEClient).
+					if !errors.Is(err, io.EOF) {
+						fail(err)
+					}
+					return
+				}
+				if ev.Event == errorEvent {
+					var body struct {
+						Error string `json:"error"`
+					}
+					if json.Unmarshal([]byte(ev.Data), &body) != nil || body.Error == "" {
+						body.Error = ev.Data
+					}
+					yield(zero, &StreamError{Message: body.Error})
+					return
+				}
+				if ev.Data != "" && !item([]byte(ev.Data)) {
+					return
+				}
+			}
+
+		case ContentTypeNDJSON, "application/jsonl", "application/x-jsonlines":
+			scanner := bufio.NewScanner(resp.Body)
+			scanner.Buffer(make([]byte, 64<<10), 16<<20)
+			for scanner.Scan() {
+				line := bytes.TrimSpace(scanner.Bytes())
+				if len(line) > 0 && !item(line) {
+					return
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				fail(err)
+			}
+
+		default:
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				fail(err)
+				return
+			}
+			body = bytes.TrimSpace(body)
+			if len(body) == 0 {
+				return
+			}
+			if body[0] == '[' && !isListType[T]() {
+				var items []json.RawMessage
+				if err := json.Unmarshal(body, &items); err != nil {
+					yield(zero, err)
+					return
+				}
+				for _, raw := range items {
+					if !item(raw) {
+						return
+					}
+				}
+				return
+			}
+			item(body)
+		}
+	}
+}
+
+// isListType reports whether T itself decodes from a JSON array, in which
+// case an array body is one item rather than a list of them.
+func isListType[T any]() bool {
+	t := reflect.TypeFor[T]()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type streamItem struct {
+	N int `json:"n"`
+}
+
+func collectStream[T any](t *testing.T, ctx context.Context, req *http.Request, opts ...CallOption) ([]T, error) {
+	t.Helper()
+	var items []T
+	for v, err := range CallStream[T](ctx, req, opts...) {
+		if err != nil {
+			return items, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// TestCallStream_StreamableShapes verifies that the same StreamableServe
+// stream decodes identically as SSE and as the collected JSON array.
+func TestCallStream_StreamableShapes(t *testing.T) {
+	srv := httptest.NewServer(StreamableServe(streamOf(nil, streamItem{1}, streamItem{2}, streamItem{3}), nil))
+	defer srv.Close()
+
+	for _, accept := range []string{"", "text/event-stream", "application/json"} {
+		req, _ := http.NewRequest("POST", srv.URL, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		items, err := collectStream[streamItem](t, context.Background(), req)
+		if err != nil || len(items) != 3 || items[2].N != 3 {
+			t.Errorf("Accept %q: items = %v, err = %v", accept, items, err)
+		}
+	}
+}
+
+func TestCallStream_SingleResponse(t *testing.T) {
+	srv := httptest.NewServer(StreamableServe(func(ctx context.Context, r *http.Request) StreamableResponse {
+		return SingleResponse{Body: streamItem{7}}
+	}, nil))
+	defer srv.Close()
+	req, _ := http.NewRequest("POST", srv.URL, nil)
+	items, err := collectStream[streamItem](t, context.Background(), req)
+	if err != nil || len(items) != 1 || items[0].N != 7 {
+		t.Errorf("items = %v, err = %v", items, err)
+	}
+
+	// A T that is itself a list takes the whole array as one item.
+	srv2 := newJSONServer(t, 200, `[1,2]`, nil)
+	defer srv2.Close()
+	req, _ = http.NewRequest("GET", srv2.URL, nil)
+	lists, err := collectStream[[]int](t, context.Background(), req)
+	if err != nil || len(lists) != 1 || len(lists[0]) != 2 {
+		t.Errorf("lists = %v, err = %v", lists, err)
+	}
+}
+
+func TestCallStream_ErrorEvent(t *testing.T) {
+	srv := httptest.NewServer(StreamableServe(streamOf(errors.New("disk full"), streamItem{1}), nil))
+	defer srv.Close()
+	req, _ := http.NewRequest("POST", srv.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	items, err := collectStream[streamItem](t, context.Background(), req)
+	var streamErr *StreamError
+	if len(items) != 1 || !errors.As(err, &streamErr) || streamErr.Message != "disk full" {
+		t.Errorf("items = %v, err = %v", items, err)
+	}
+}
+
+func TestCallStream_NDJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeNDJSON)
+		w.Write([]byte("{\"n\":1}\n\n{\"n\":2}\n{\"n\":3}"))
+	}))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+
+	// Stopping early closes the stream.
+	var got []int
+	for v, err := range CallStream[streamItem](context.Background(), req) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got = append(got, v.N); len(got) == 2 {
+			break
+		}
+	}
+	if len(got) != 2 || got[1] != 2 {
+		t.Errorf("got = %v", got)
+	}
+}
+
+// TestCallStream_SSETruncatedEvent verifies that an event cut off by EOF,
+// without its terminating blank line, is dropped as SSEClient drops it.
+func TestCallStream_SSETruncatedEvent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"n\":1}\n\ndata: {\"n\":2}\n"))
+	}))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	items, err := collectStream[streamItem](t, context.Background(), req)
+	if err != nil || len(items) != 1 || items[0].N != 1 {
+		t.Errorf("items = %v, err = %v", items, err)
+	}
+}
+
+func TestCallStream_HTTPError(t *testing.T) {
+	srv := newJSONServer(t, 503, `{"error":"down"}`, nil)
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if _, err := collectStream[streamItem](t, context.Background(), req); HTTPErrorCode(err) != 503 {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestCallStream_ContextCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": keepalive\n\ndata: {\"n\":1}\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	done := make(chan error, 1)
+	go func() {
+		for v, err := range CallStream[streamItem](ctx, req) {
+			if err != nil {
+				done <- err
+				return
+			}
+			if v.N == 1 {
+				cancel()
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream not closed on cancel")
+	}
+}
+
+// TestCallStream_OutlivesClientTimeout verifies that the default client's
+// Timeout does not end a stream that only ctx should end.
+func TestCallStream_OutlivesClientTimeout(t *testing.T) {
+	saved := DefaultHttpClient
+	DefaultHttpClient = &http.Client{Timeout: 50 * time.Millisecond}
+	defer func() { DefaultHttpClient = saved }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeNDJSON)
+		for i := range 5 {
+			w.Write([]byte(`{"n":` + strconv.Itoa(i) + "}\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	items, err := collectStream[streamItem](t, context.Background(), req)
+	if err != nil || len(items) != 5 {
+		t.Errorf("items = %v, err = %v", items, err)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -82,17 +84,34 @@ type HTTPError struct {
 	Code   int
 	Body   []byte
 	Header http.Header
+
+	// Detail is the error body decoded by WithErrorBody, or nil.
+	Detail any
 }
 
 func (e *HTTPError) Error() string {
 	return fmt.Sprintf("Status: %d, Body: %s", e.Code, string(e.Body))
 }
 
+// Unwrap returns Detail if it is an error, so errors.As can reach a typed
+// error body decoded by WithErrorBody.
+func (e *HTTPError) Unwrap() error {
+	if err, ok := e.Detail.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// HTTPErrorCode returns the status code of an *HTTPError in err's chain,
+// 503 for a *CircuitOpenError, or -1 otherwise.
 func HTTPErrorCode(err error) int {
-	if err != nil {
-		if e, ok := err.(*HTTPError); ok {
-			return e.Code
-		}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		return http.StatusServiceUnavailable
 	}
 	return -1
 }
@@ -101,7 +120,18 @@ func HTTPErrorCode(err error) int {
 type CallOption func(*callConfig)
 
 type callConfig struct {
-	client *http.Client
+	client  *http.Client
+	retry   *RetryPolicy
+	breaker *CircuitBreaker
+	chain   TransportChain
+
+	query      url.Values
+	raw        bool
+	header     *http.Header
+	decoder    ResponseDecoder
+	errorBody  func(body []byte) any
+	errorEvent string
+	err        error // set by options that fail
 }
 
 // WithClient overrides the *http.Client used to perform the request.
@@ -117,56 +147,128 @@ func WithInsecureTLS() CallOption {
 	return func(cfg *callConfig) { cfg.client = getInsecureDefaultHttpClient() }
 }
 
-// Call performs req, reads the entire response body, and JSON-decodes it into T.
+// Call performs req, reads the entire response body, and decodes it into T.
 //
 // Contract: this helper is for request/response endpoints whose body fits in
-// memory (JSON APIs, typed CRUD). For streaming/large bodies use client.Do
-// directly; for SSE see SSEReader.
+// memory (JSON APIs, typed CRUD). For streaming/large bodies use CallRaw;
+// for SSE see SSEReader.
 //
-// Non-2xx responses return a zero T and *HTTPError carrying the status,
-// raw body, and response headers. Empty bodies on 2xx return a zero T with
-// no error (handles 204 No Content).
+// Bodies are decoded as JSON, or as protobuf when T is a proto.Message (see
+// WithResponseDecoder to change this). Non-2xx responses return a zero T
+// and *HTTPError carrying the status, raw body, and response headers. Empty
+// bodies on 2xx return a zero T with no error (handles 204 No Content).
 func Call[T any](ctx context.Context, req *http.Request, opts ...CallOption) (T, error) {
 	var zero T
-	body, _, err := doCall(ctx, req, opts)
+	cfg := newCallConfig(opts)
+	body, resp, err := doCall(ctx, req, cfg)
 	if err != nil {
 		return zero, err
 	}
 	if len(body) == 0 {
 		return zero, nil
 	}
-	var out T
-	if err := json.Unmarshal(body, &out); err != nil {
-		return zero, err
-	}
-	return out, nil
+	return decodeResponse[T](body, resp.Header, cfg.decoder)
 }
 
 // CallVoid performs req and discards the response body. Use for endpoints
 // where the body is not needed (DELETE, ack-style POST). Non-2xx still
 // produces an *HTTPError with body and headers preserved.
 func CallVoid(ctx context.Context, req *http.Request, opts ...CallOption) error {
-	_, _, err := doCall(ctx, req, opts)
+	_, _, err := doCall(ctx, req, newCallConfig(opts))
 	return err
 }
 
-func doCall(ctx context.Context, req *http.Request, opts []CallOption) ([]byte, *http.Response, error) {
-	cfg := callConfig{client: DefaultHttpClient}
+// CallRaw performs req like Call but returns the response with its body
+// unread, for streaming or large downloads. The caller must close
+// resp.Body. Retries and circuit breaking apply up to the response
+// headers; non-2xx responses are read, closed and returned as *HTTPError.
+func CallRaw(ctx context.Context, req *http.Request, opts ...CallOption) (*http.Response, error) {
+	cfg := newCallConfig(opts)
+	cfg.raw = true
+	_, resp, err := doCall(ctx, req, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func newCallConfig(opts []CallOption) *callConfig {
+	cfg := &callConfig{client: DefaultHttpClient}
 	for _, o := range opts {
-		o(&cfg)
+		o(cfg)
 	}
 	if cfg.client == nil {
 		cfg.client = DefaultHttpClient
 	}
+	if len(cfg.chain.middlewares) > 0 {
+		client := *cfg.client
+		client.Transport = cfg.chain.Wrap(client.Transport)
+		cfg.client = &client
+	}
+	return cfg
+}
+
+func doCall(ctx context.Context, req *http.Request, cfg *callConfig) ([]byte, *http.Response, error) {
+	if cfg.err != nil {
+		return nil, nil, cfg.err
+	}
+	if cfg.query != nil {
+		req = req.Clone(ctx)
+		q := req.URL.Query()
+		for k, v := range cfg.query {
+			q[k] = append(q[k], v...)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+
+	attempt := func(req *http.Request) ([]byte, *http.Response, error) {
+		return doOnce(ctx, cfg, req)
+	}
+	if cfg.breaker != nil {
+		once := attempt
+		attempt = func(req *http.Request) ([]byte, *http.Response, error) {
+			return cfg.breaker.guard(req, once)
+		}
+	}
+	var (
+		body []byte
+		resp *http.Response
+		err  error
+	)
+	if cfg.retry != nil {
+		body, resp, err = cfg.retry.do(ctx, req, attempt)
+	} else {
+		body, resp, err = attempt(req)
+	}
+
+	if cfg.header != nil && resp != nil {
+		*cfg.header = resp.Header.Clone()
+	}
+	var httpErr *HTTPError
+	if cfg.errorBody != nil && errors.As(err, &httpErr) && len(httpErr.Body) > 0 {
+		httpErr.Detail = cfg.errorBody(httpErr.Body)
+	}
+	return body, resp, err
+}
 
+// doOnce performs a single attempt of req, reading the whole body unless
+// cfg.raw is set and the response succeeded.
+func doOnce(ctx context.Context, cfg *callConfig, req *http.Request) ([]byte, *http.Response, error) {
 	req = req.WithContext(ctx)
 	resp, err := cfg.client.Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
+	if cfg.raw && resp.StatusCode < 400 {
+		return nil, resp, nil
+	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	reader := io.Reader(resp.Body)
+	if cfg.raw {
+		reader = io.LimitReader(resp.Body, MaxErrorBodySize)
+	}
+	body, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, resp, err
 	}
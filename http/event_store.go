@@ -2,6 +2,8 @@ package http
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ============================================================================
@@ -57,95 +59,476 @@ type EventStore interface {
 // MemoryEventStore — bounded in-memory implementation
 // ============================================================================
 
-// MemoryEventStore is an in-memory EventStore backed by bounded per-stream
-// slices. When a stream exceeds maxPerStream events, the oldest events are
-// dropped (FIFO eviction).
+// MemoryEventStoreOptions configures a MemoryEventStore. Zero values disable
+// the corresponding limit.
+type MemoryEventStoreOptions struct {
+	// MaxPerStream caps the events retained per stream. When a stream is
+	// full, each Store overwrites its oldest event. Default: 1000.
+	MaxPerStream int
+
+	// TTL drops events older than this duration. Expired events are removed
+	// lazily when their stream is written or replayed, and during sweeps.
+	// Default: 0 (no TTL).
+	TTL time.Duration
+
+	// MaxTotalEvents caps the events retained across all streams. When
+	// exceeded, the oldest events of the least recently written streams are
+	// evicted until the total drops to 90% of the cap. Default: 0 (unlimited).
+	MaxTotalEvents int
+
+	// MaxTotalBytes caps the approximate memory held by events across all
+	// streams (ID, event type and data lengths plus a fixed per-event
+	// overhead). Eviction works as for MaxTotalEvents. Default: 0 (unlimited).
+	MaxTotalBytes int64
+
+	// IdleTimeout removes streams that have not been written or replayed
+	// for this long, so abandoned sessions do not hold memory until Trim is
+	// called. Default: 0 (streams live until trimmed or emptied).
+	IdleTimeout time.Duration
+}
+
+// MemoryEventStoreStats is a point-in-time snapshot of a MemoryEventStore.
+type MemoryEventStoreStats struct {
+	Streams int   // streams currently held
+	Events  int   // events currently retained across all streams
+	Bytes   int64 // approximate memory held by retained events
+
+	Stored         uint64 // events stored since creation
+	Overwritten    uint64 // events dropped because their stream was full
+	Expired        uint64 // events dropped by TTL
+	Evicted        uint64 // events dropped to honour the global caps
+	EvictedStreams uint64 // streams removed for being idle
+}
+
+// MemoryEventStore is an in-memory EventStore backed by a ring buffer per
+// stream. When a stream holds maxPerStream events, the oldest is overwritten
+// (FIFO eviction) in O(1) without copying.
+//
+// Each stream keeps an index from event ID to sequence number, so Replay
+// locates its anchor in O(1) instead of scanning. Streams are locked
+// individually: a slow Replay on one stream never blocks Store on another.
+//
+// Optional limits (see MemoryEventStoreOptions) add a TTL, global event and
+// byte caps across streams, and removal of idle streams. Stats reports
+// occupancy and eviction counters.
 //
 // This implementation is suitable for single-process deployments. For
-// multi-process or persistent resumption, use a Redis or database-backed
-// EventStore.
+// resumption that survives restarts, use FileEventStore; for multi-process
+// deployments, use a Redis or database-backed EventStore.
 //
-// Thread-safe: all methods are protected by a sync.RWMutex.
+// Thread-safe.
 type MemoryEventStore struct {
-	mu           sync.RWMutex
-	streams      map[string][]StoredEvent
+	mu           sync.RWMutex // guards streams (the map, not the streams)
+	streams      map[string]*memStream
 	maxPerStream int
+	opts         MemoryEventStoreOptions
+
+	// evictMu serializes global-cap eviction passes.
+	evictMu sync.Mutex
+
+	totalEvents atomic.Int64
+	totalBytes  atomic.Int64
+	lastSweep   atomic.Int64
+
+	stored         atomic.Uint64
+	overwritten    atomic.Uint64
+	expired        atomic.Uint64
+	evicted        atomic.Uint64
+	evictedStreams atomic.Uint64
+
+	// now is the clock used for TTL and idle checks. Overridable in tests.
+	now func() time.Time
+}
+
+// memEventOverhead approximates the per-event bookkeeping cost (ring slot,
+// index entry, slice and string headers) counted towards MaxTotalBytes.
+const memEventOverhead = 96
+
+// memStream is one stream's ring buffer. Events occupy buf[head],
+// buf[head+1], ... (mod len(buf)), oldest first, with consecutive sequence
+// numbers ending at nextSeq-1.
+type memStream struct {
+	mu      sync.Mutex
+	buf     []memEntry
+	head    int
+	n       int
+	nextSeq uint64
+	byID    map[string]uint64 // event ID → seq of the latest event with it
+	bytes   int64
+
+	// lastUsed (unix nanos) is read without mu when choosing eviction and
+	// idle victims.
+	lastUsed atomic.Int64
+
+	// removed is set once the stream has been dropped from the store map;
+	// a writer that raced with the removal retries with a fresh stream.
+	removed bool
+}
+
+type memEntry struct {
+	event    StoredEvent
+	seq      uint64
+	storedAt int64
+	size     int64
 }
 
 // NewMemoryEventStore creates a MemoryEventStore with the given maximum
 // events per stream. If maxPerStream <= 0, it defaults to 1000.
 func NewMemoryEventStore(maxPerStream int) *MemoryEventStore {
-	if maxPerStream <= 0 {
-		maxPerStream = 1000
+	return NewMemoryEventStoreWithOptions(&MemoryEventStoreOptions{MaxPerStream: maxPerStream})
+}
+
+// NewMemoryEventStoreWithOptions creates a MemoryEventStore with the given
+// limits. A nil opts is equivalent to NewMemoryEventStore(0).
+func NewMemoryEventStoreWithOptions(opts *MemoryEventStoreOptions) *MemoryEventStore {
+	s := &MemoryEventStore{
+		streams: make(map[string]*memStream),
+		now:     time.Now,
+	}
+	if opts != nil {
+		s.opts = *opts
 	}
-	return &MemoryEventStore{
-		streams:      make(map[string][]StoredEvent),
-		maxPerStream: maxPerStream,
+	if s.opts.MaxPerStream <= 0 {
+		s.opts.MaxPerStream = 1000
 	}
+	s.maxPerStream = s.opts.MaxPerStream
+	return s
 }
 
-// Store appends an event to the stream. If the stream exceeds maxPerStream,
-// the oldest event is dropped.
+// Store appends an event to the stream, overwriting the oldest event if the
+// stream is full, then enforces the TTL and global caps.
 func (s *MemoryEventStore) Store(streamID string, event StoredEvent) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	events := s.streams[streamID]
-	events = append(events, event)
-
-	// Evict oldest if over capacity
-	if len(events) > s.maxPerStream {
-		// Drop the oldest events to stay within bounds.
-		// Copy to avoid holding references to the old backing array.
-		excess := len(events) - s.maxPerStream
-		trimmed := make([]StoredEvent, s.maxPerStream)
-		copy(trimmed, events[excess:])
-		events = trimmed
+	now := s.now().UnixNano()
+	for {
+		st := s.stream(streamID, true)
+		st.mu.Lock()
+		if st.removed {
+			// Lost a race with a sweep or eviction; make sure the dead
+			// stream is gone from the map and retry with a fresh one.
+			st.mu.Unlock()
+			s.unlink(streamID, st)
+			continue
+		}
+		st.lastUsed.Store(now)
+		s.expire(st, now)
+		s.push(st, event, now)
+		st.mu.Unlock()
+		break
 	}
+	s.stored.Add(1)
 
-	s.streams[streamID] = events
+	s.maybeSweep(now)
+	s.enforceGlobalCaps()
 	return nil
 }
 
-// Replay returns all events after lastEventID by scanning for it in the
-// stream's insertion-ordered slice. If lastEventID is not found (e.g.,
-// evicted), all stored events are returned as a conservative fallback.
+// Replay returns all events after lastEventID, found via the stream's ID
+// index. If lastEventID is not found (e.g., evicted), all stored events are
+// returned as a conservative fallback.
 func (s *MemoryEventStore) Replay(streamID string, lastEventID string) ([]StoredEvent, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	events := s.streams[streamID]
-	if len(events) == 0 {
+	st := s.stream(streamID, false)
+	if st == nil {
 		return nil, nil
 	}
+	now := s.now().UnixNano()
 
-	// Scan for the anchor event
-	for i, ev := range events {
-		if ev.ID == lastEventID {
-			// Return everything after the anchor
-			if i+1 >= len(events) {
-				return nil, nil // anchor is the last event
-			}
-			result := make([]StoredEvent, len(events)-i-1)
-			copy(result, events[i+1:])
-			return result, nil
-		}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.removed {
+		return nil, nil
+	}
+	st.lastUsed.Store(now)
+	s.expire(st, now)
+	if st.n == 0 {
+		return nil, nil
 	}
 
-	// Anchor not found — return all events (conservative fallback)
-	result := make([]StoredEvent, len(events))
-	copy(result, events)
+	// Skip everything up to and including the anchor, if it is retained.
+	skip := 0
+	if seq, ok := st.byID[lastEventID]; ok {
+		skip = int(seq-st.oldestSeq()) + 1
+	}
+	if skip >= st.n {
+		return nil, nil // anchor is the last event
+	}
+	result := make([]StoredEvent, st.n-skip)
+	for i := range result {
+		result[i] = st.at(skip + i).event
+	}
 	return result, nil
 }
 
 // Trim removes all stored events for the given stream.
 func (s *MemoryEventStore) Trim(streamID string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	st := s.streams[streamID]
 	delete(s.streams, streamID)
+	s.mu.Unlock()
+	if st != nil {
+		st.mu.Lock()
+		s.release(st)
+		st.mu.Unlock()
+	}
 	return nil
 }
 
+// Stats returns a snapshot of the store's occupancy and eviction counters.
+func (s *MemoryEventStore) Stats() MemoryEventStoreStats {
+	s.mu.RLock()
+	streams := len(s.streams)
+	s.mu.RUnlock()
+	return MemoryEventStoreStats{
+		Streams:        streams,
+		Events:         int(s.totalEvents.Load()),
+		Bytes:          s.totalBytes.Load(),
+		Stored:         s.stored.Load(),
+		Overwritten:    s.overwritten.Load(),
+		Expired:        s.expired.Load(),
+		Evicted:        s.evicted.Load(),
+		EvictedStreams: s.evictedStreams.Load(),
+	}
+}
+
+// Sweep applies the TTL to every stream and removes idle and empty streams.
+// Store calls it periodically on its own; call it directly to reclaim
+// memory from a store that has stopped receiving writes.
+func (s *MemoryEventStore) Sweep() {
+	now := s.now().UnixNano()
+	s.lastSweep.Store(now)
+
+	s.mu.RLock()
+	ids := make([]string, 0, len(s.streams))
+	streams := make([]*memStream, 0, len(s.streams))
+	for id, st := range s.streams {
+		ids = append(ids, id)
+		streams = append(streams, st)
+	}
+	s.mu.RUnlock()
+
+	for i, st := range streams {
+		st.mu.Lock()
+		s.expire(st, now)
+		idle := s.opts.IdleTimeout > 0 && now-st.lastUsed.Load() > s.opts.IdleTimeout.Nanoseconds()
+		remove := !st.removed && (idle || (st.n == 0 && s.opts.TTL > 0))
+		if remove {
+			if idle {
+				s.evictedStreams.Add(1)
+			}
+			s.release(st)
+		}
+		st.mu.Unlock()
+		if remove {
+			s.unlink(ids[i], st)
+		}
+	}
+}
+
+// maybeSweep runs Sweep if the TTL or IdleTimeout is set and half of the
+// shorter of the two has passed since the last sweep.
+func (s *MemoryEventStore) maybeSweep(now int64) {
+	interval := s.opts.IdleTimeout
+	if s.opts.TTL > 0 && (interval == 0 || s.opts.TTL < interval) {
+		interval = s.opts.TTL
+	}
+	if interval <= 0 {
+		return
+	}
+	last := s.lastSweep.Load()
+	if now-last < (interval / 2).Nanoseconds() {
+		return
+	}
+	if s.lastSweep.CompareAndSwap(last, now) {
+		s.Sweep()
+	}
+}
+
+// enforceGlobalCaps evicts the oldest events of the least recently used
+// streams until the totals are back under 90% of the configured caps. The
+// low-water mark amortizes the O(streams) victim search over many Stores.
+func (s *MemoryEventStore) enforceGlobalCaps() {
+	if !s.overCap(1) {
+		return
+	}
+	s.evictMu.Lock()
+	defer s.evictMu.Unlock()
+
+	for s.overCap(0.9) {
+		id, victim := s.leastRecentlyUsed()
+		if victim == nil {
+			return
+		}
+		victim.mu.Lock()
+		for victim.n > 0 && s.overCap(0.9) {
+			victim.popOldest(s)
+			s.evicted.Add(1)
+		}
+		empty := victim.n == 0 && !victim.removed
+		if empty {
+			s.release(victim)
+		}
+		victim.mu.Unlock()
+		if empty {
+			s.unlink(id, victim)
+		}
+	}
+}
+
+// overCap reports whether the totals exceed the given fraction of the caps.
+func (s *MemoryEventStore) overCap(fraction float64) bool {
+	if max := s.opts.MaxTotalEvents; max > 0 && float64(s.totalEvents.Load()) > float64(max)*fraction {
+		return true
+	}
+	if max := s.opts.MaxTotalBytes; max > 0 && float64(s.totalBytes.Load()) > float64(max)*fraction {
+		return true
+	}
+	return false
+}
+
+// leastRecentlyUsed returns the non-empty stream with the oldest lastUsed.
+// Empty streams free nothing (and may be about to receive their first
+// event), so they are left to Sweep.
+func (s *MemoryEventStore) leastRecentlyUsed() (string, *memStream) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var victimID string
+	var victim *memStream
+	var oldest int64
+	for id, st := range s.streams {
+		used := st.lastUsed.Load()
+		if victim != nil && used >= oldest {
+			continue
+		}
+		st.mu.Lock() // lock order map → stream
+		empty := st.n == 0 || st.removed
+		st.mu.Unlock()
+		if !empty {
+			victimID, victim, oldest = id, st, used
+		}
+	}
+	return victimID, victim
+}
+
+// stream returns the stream for streamID, creating it if create is set.
+func (s *MemoryEventStore) stream(streamID string, create bool) *memStream {
+	s.mu.RLock()
+	st := s.streams[streamID]
+	s.mu.RUnlock()
+	if st != nil || !create {
+		return st
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st = s.streams[streamID]; st == nil {
+		st = &memStream{byID: make(map[string]uint64), nextSeq: 1}
+		st.lastUsed.Store(s.now().UnixNano())
+		s.streams[streamID] = st
+	}
+	return st
+}
+
+// unlink removes st from the map if it is still the stream for id. Called
+// after releasing st.mu to keep the lock order map → stream.
+func (s *MemoryEventStore) unlink(id string, st *memStream) {
+	s.mu.Lock()
+	if s.streams[id] == st {
+		delete(s.streams, id)
+	}
+	s.mu.Unlock()
+}
+
+// release marks st removed and subtracts its events from the global totals.
+// Caller holds st.mu.
+func (s *MemoryEventStore) release(st *memStream) {
+	if st.removed {
+		return
+	}
+	st.removed = true
+	s.totalEvents.Add(-int64(st.n))
+	s.totalBytes.Add(-st.bytes)
+	st.buf, st.byID, st.n, st.bytes = nil, nil, 0, 0
+}
+
+// push appends an event, growing the ring up to maxPerStream and then
+// overwriting the oldest entry. Caller holds st.mu.
+func (s *MemoryEventStore) push(st *memStream, event StoredEvent, now int64) {
+	if st.n == s.maxPerStream {
+		st.popOldest(s)
+		s.overwritten.Add(1)
+	}
+	if st.n == len(st.buf) {
+		st.grow(s.maxPerStream)
+	}
+	entry := memEntry{
+		event:    event,
+		seq:      st.nextSeq,
+		storedAt: now,
+		size:     int64(len(event.ID)+len(event.Event)+len(event.Data)) + memEventOverhead,
+	}
+	st.buf[(st.head+st.n)%len(st.buf)] = entry
+	st.n++
+	st.nextSeq++
+	if event.ID != "" {
+		st.byID[event.ID] = entry.seq
+	}
+	st.bytes += entry.size
+	s.totalEvents.Add(1)
+	s.totalBytes.Add(entry.size)
+}
+
+// expire drops events older than the TTL. Caller holds st.mu.
+func (s *MemoryEventStore) expire(st *memStream, now int64) {
+	if s.opts.TTL <= 0 {
+		return
+	}
+	cutoff := now - s.opts.TTL.Nanoseconds()
+	for st.n > 0 && st.buf[st.head].storedAt < cutoff {
+		st.popOldest(s)
+		s.expired.Add(1)
+	}
+}
+
+// popOldest removes the oldest event. Caller holds st.mu.
+func (st *memStream) popOldest(s *MemoryEventStore) {
+	entry := &st.buf[st.head]
+	if id := entry.event.ID; id != "" && st.byID[id] == entry.seq {
+		delete(st.byID, id)
+	}
+	st.bytes -= entry.size
+	s.totalEvents.Add(-1)
+	s.totalBytes.Add(-entry.size)
+	*entry = memEntry{} // drop references to the event data
+	st.head = (st.head + 1) % len(st.buf)
+	st.n--
+}
+
+// grow doubles the ring's capacity (starting at 16, capped at max),
+// linearizing the entries so head is 0.
+func (st *memStream) grow(max int) {
+	size := len(st.buf) * 2
+	if size < 16 {
+		size = 16
+	}
+	if size > max {
+		size = max
+	}
+	buf := make([]memEntry, size)
+	for i := 0; i < st.n; i++ {
+		buf[i] = st.buf[(st.head+i)%len(st.buf)]
+	}
+	st.buf, st.head = buf, 0
+}
+
+// oldestSeq returns the sequence number of the oldest retained event.
+func (st *memStream) oldestSeq() uint64 {
+	return st.nextSeq - uint64(st.n)
+}
+
+// at returns the i-th oldest retained entry.
+func (st *memStream) at(i int) *memEntry {
+	return &st.buf[(st.head+i)%len(st.buf)]
+}
+
 // ============================================================================
 // Compile-time interface compliance
 // ============================================================================
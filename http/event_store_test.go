@@ -3,7 +3,9 @@ package http
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // ============================================================================
@@ -308,3 +310,273 @@ func TestMemoryEventStoreReplayReturnsCopy(t *testing.T) {
 		t.Errorf("Store internal state was mutated via Replay result: got ID %q, want '1'", events2[0].ID)
 	}
 }
+
+// TestMemoryEventStoreRingWraparound verifies ID lookups stay correct after
+// the ring buffer has wrapped around several times.
+func TestMemoryEventStoreRingWraparound(t *testing.T) {
+	store := NewMemoryEventStore(5)
+	for i := 1; i <= 23; i++ {
+		store.Store("s1", StoredEvent{ID: fmt.Sprintf("%d", i), Data: []byte(`{}`)})
+	}
+
+	events, _ := store.Replay("s1", "20")
+	if len(events) != 3 || events[0].ID != "21" || events[2].ID != "23" {
+		t.Errorf("Replay from 20 = %v, want 21..23", events)
+	}
+	events, _ = store.Replay("s1", "19")
+	if len(events) != 4 || events[0].ID != "20" {
+		t.Errorf("Replay from oldest retained = %v, want 20..23", events)
+	}
+	if stats := store.Stats(); stats.Events != 5 || stats.Overwritten != 18 || stats.Stored != 23 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+// TestMemoryEventStoreTTL verifies that events older than the TTL are not
+// replayed and are counted as expired.
+func TestMemoryEventStoreTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryEventStoreWithOptions(&MemoryEventStoreOptions{TTL: time.Minute})
+	store.now = func() time.Time { return now }
+
+	store.Store("s1", StoredEvent{ID: "1", Data: []byte(`{}`)})
+	now = now.Add(30 * time.Second)
+	store.Store("s1", StoredEvent{ID: "2", Data: []byte(`{}`)})
+	now = now.Add(45 * time.Second)
+
+	events, _ := store.Replay("s1", "")
+	if len(events) != 1 || events[0].ID != "2" {
+		t.Errorf("Replay after TTL = %v, want only event 2", events)
+	}
+	if stats := store.Stats(); stats.Expired != 1 || stats.Events != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+// TestMemoryEventStoreGlobalEventCap verifies that MaxTotalEvents evicts
+// from the least recently written stream first, down to the low-water mark.
+func TestMemoryEventStoreGlobalEventCap(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryEventStoreWithOptions(&MemoryEventStoreOptions{MaxTotalEvents: 10})
+	store.now = func() time.Time { now = now.Add(time.Millisecond); return now }
+
+	for i := 1; i <= 6; i++ {
+		store.Store("old", StoredEvent{ID: fmt.Sprintf("%d", i), Data: []byte(`{}`)})
+	}
+	for i := 1; i <= 5; i++ {
+		store.Store("new", StoredEvent{ID: fmt.Sprintf("%d", i), Data: []byte(`{}`)})
+	}
+
+	// 11 events > 10 → evict from "old" down to 9.
+	stats := store.Stats()
+	if stats.Events != 9 || stats.Evicted != 2 {
+		t.Errorf("Unexpected stats after eviction: %+v", stats)
+	}
+	if events, _ := store.Replay("new", ""); len(events) != 5 {
+		t.Errorf("Most recently written stream lost events: %d left", len(events))
+	}
+	if events, _ := store.Replay("old", ""); len(events) != 4 || events[0].ID != "3" {
+		t.Errorf("Expected oldest events of 'old' evicted, got %v", events)
+	}
+}
+
+// TestMemoryEventStoreGlobalCapSkipsEmptyStreams verifies that eviction
+// picks the least recently used stream that holds events, not an older
+// empty one.
+func TestMemoryEventStoreGlobalCapSkipsEmptyStreams(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryEventStoreWithOptions(&MemoryEventStoreOptions{MaxTotalEvents: 10})
+	store.now = func() time.Time { now = now.Add(time.Millisecond); return now }
+
+	store.stream("empty", true)
+	for i := 1; i <= 6; i++ {
+		store.Store("old", StoredEvent{ID: fmt.Sprintf("%d", i), Data: []byte(`{}`)})
+	}
+	if id, _ := store.leastRecentlyUsed(); id != "old" {
+		t.Errorf("leastRecentlyUsed = %q, want old", id)
+	}
+	for i := 1; i <= 5; i++ {
+		store.Store("new", StoredEvent{ID: fmt.Sprintf("%d", i), Data: []byte(`{}`)})
+	}
+
+	stats := store.Stats()
+	if stats.Streams != 3 || stats.Events != 9 || stats.Evicted != 2 {
+		t.Errorf("Unexpected stats after eviction: %+v", stats)
+	}
+	if events, _ := store.Replay("old", ""); len(events) != 4 || events[0].ID != "3" {
+		t.Errorf("Expected oldest events of 'old' evicted, got %v", events)
+	}
+}
+
+// TestMemoryEventStoreGlobalByteCap verifies that MaxTotalBytes bounds the
+// approximate memory held across streams and drops emptied streams.
+func TestMemoryEventStoreGlobalByteCap(t *testing.T) {
+	data := make([]byte, 1000)
+	store := NewMemoryEventStoreWithOptions(&MemoryEventStoreOptions{MaxTotalBytes: 10_000})
+
+	for i := 0; i < 50; i++ {
+		store.Store(fmt.Sprintf("stream-%d", i), StoredEvent{ID: "1", Data: data})
+	}
+	stats := store.Stats()
+	if stats.Bytes > 10_000 {
+		t.Errorf("Bytes = %d, want <= 10000", stats.Bytes)
+	}
+	if stats.Streams != stats.Events {
+		t.Errorf("Expected emptied streams to be removed: %+v", stats)
+	}
+}
+
+// TestMemoryEventStoreIdleEviction verifies that streams unused for longer
+// than IdleTimeout are removed by Sweep, while active streams survive.
+func TestMemoryEventStoreIdleEviction(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryEventStoreWithOptions(&MemoryEventStoreOptions{IdleTimeout: time.Minute})
+	store.now = func() time.Time { return now }
+
+	store.Store("idle", StoredEvent{ID: "1", Data: []byte(`{}`)})
+	store.Store("active", StoredEvent{ID: "1", Data: []byte(`{}`)})
+	now = now.Add(50 * time.Second)
+	store.Replay("active", "")
+	now = now.Add(20 * time.Second)
+	store.Sweep()
+
+	stats := store.Stats()
+	if stats.Streams != 1 || stats.EvictedStreams != 1 || stats.Events != 1 {
+		t.Errorf("Unexpected stats after sweep: %+v", stats)
+	}
+	if events, _ := store.Replay("idle", ""); events != nil {
+		t.Errorf("Idle stream should be gone, got %v", events)
+	}
+
+	// A write after eviction starts a fresh stream.
+	store.Store("idle", StoredEvent{ID: "2", Data: []byte(`{}`)})
+	if events, _ := store.Replay("idle", ""); len(events) != 1 || events[0].ID != "2" {
+		t.Errorf("Expected fresh stream, got %v", events)
+	}
+}
+
+// ============================================================================
+// Benchmarks — ring buffer vs. the previous slice-based implementation
+// ============================================================================
+
+// sliceEventStore is the original MemoryEventStore implementation (a slice
+// per stream, reallocated on overflow, linear anchor scan, one global lock),
+// kept as a baseline for the benchmarks below.
+type sliceEventStore struct {
+	mu           sync.RWMutex
+	streams      map[string][]StoredEvent
+	maxPerStream int
+}
+
+func (s *sliceEventStore) Store(streamID string, event StoredEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := append(s.streams[streamID], event)
+	if len(events) > s.maxPerStream {
+		trimmed := make([]StoredEvent, s.maxPerStream)
+		copy(trimmed, events[len(events)-s.maxPerStream:])
+		events = trimmed
+	}
+	s.streams[streamID] = events
+	return nil
+}
+
+func (s *sliceEventStore) Replay(streamID string, lastEventID string) ([]StoredEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	events := s.streams[streamID]
+	for i, ev := range events {
+		if ev.ID == lastEventID {
+			result := make([]StoredEvent, len(events)-i-1)
+			copy(result, events[i+1:])
+			return result, nil
+		}
+	}
+	result := make([]StoredEvent, len(events))
+	copy(result, events)
+	return result, nil
+}
+
+func (s *sliceEventStore) Trim(streamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, streamID)
+	return nil
+}
+
+var benchEventStores = []struct {
+	name string
+	make func(max int) EventStore
+}{
+	{"Slice", func(max int) EventStore {
+		return &sliceEventStore{streams: map[string][]StoredEvent{}, maxPerStream: max}
+	}},
+	{"Ring", func(max int) EventStore { return NewMemoryEventStore(max) }},
+}
+
+// BenchmarkEventStoreStoreFull measures Store on a stream already at
+// capacity, where every write evicts the oldest event.
+func BenchmarkEventStoreStoreFull(b *testing.B) {
+	ids := make([]string, 4096)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%d", i)
+	}
+	data := []byte(`{"payload":"benchmark"}`)
+	for _, impl := range benchEventStores {
+		b.Run(impl.name, func(b *testing.B) {
+			store := impl.make(1000)
+			for i := 0; i < 1000; i++ {
+				store.Store("s", StoredEvent{ID: ids[i%len(ids)], Data: data})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.Store("s", StoredEvent{ID: ids[i%len(ids)], Data: data})
+			}
+		})
+	}
+}
+
+// BenchmarkEventStoreReplayRecent measures resuming near the head of a full
+// stream — the common reconnect case — where the slice store scans almost
+// the whole stream to find the anchor.
+func BenchmarkEventStoreReplayRecent(b *testing.B) {
+	data := []byte(`{"payload":"benchmark"}`)
+	for _, impl := range benchEventStores {
+		b.Run(impl.name, func(b *testing.B) {
+			store := impl.make(1000)
+			for i := 0; i < 1000; i++ {
+				store.Store("s", StoredEvent{ID: fmt.Sprintf("%d", i), Data: data})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.Replay("s", "990")
+			}
+		})
+	}
+}
+
+// BenchmarkEventStoreParallelStreams measures concurrent Stores to many
+// independent streams, where the slice store serializes on its global lock.
+func BenchmarkEventStoreParallelStreams(b *testing.B) {
+	data := []byte(`{"payload":"benchmark"}`)
+	streams := make([]string, 64)
+	for i := range streams {
+		streams[i] = fmt.Sprintf("stream-%d", i)
+	}
+	for _, impl := range benchEventStores {
+		b.Run(impl.name, func(b *testing.B) {
+			store := impl.make(100)
+			var next atomic.Int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				stream := streams[next.Add(1)%int64(len(streams))]
+				for i := 0; pb.Next(); i++ {
+					store.Store(stream, StoredEvent{ID: "x", Data: data})
+				}
+			})
+		})
+	}
+}
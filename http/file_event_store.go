@@ -0,0 +1,800 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// FileEventStore — durable, file-backed EventStore
+// ============================================================================
+
+// FileEventStoreOptions configures a FileEventStore. Zero values disable the
+// corresponding retention limit; a nil *FileEventStoreOptions uses defaults.
+type FileEventStoreOptions struct {
+	// MaxEventsPerStream caps the number of events retained per stream.
+	// Oldest events are dropped first. Default: 0 (unlimited).
+	MaxEventsPerStream int
+
+	// MaxAge drops events older than this duration. Evaluated on every
+	// Store, Replay and Compact. Default: 0 (no age limit).
+	MaxAge time.Duration
+
+	// MaxBytesPerStream caps the on-disk size of the retained events of a
+	// stream (record headers included). Default: 0 (unlimited).
+	MaxBytesPerStream int64
+
+	// SegmentSize is the size in bytes at which a stream's active segment
+	// file is closed and a new one started. Retention reclaims disk space a
+	// whole segment at a time, so smaller segments free space sooner at the
+	// cost of more files. Default: 4 MB.
+	SegmentSize int64
+
+	// Sync calls fsync after every Store. Without it, stored events survive
+	// a process crash (the OS still holds the writes) but not a power loss
+	// or kernel panic. Default: false.
+	Sync bool
+
+	// CompactInterval, if positive, runs Compact in the background at this
+	// interval until Close is called. Default: 0 (call Compact manually).
+	CompactInterval time.Duration
+}
+
+// FileEventStore is an EventStore that persists events to append-only
+// segment files, so stream history survives process restarts and deploys.
+// It needs nothing beyond a writable directory.
+//
+// Layout: each stream gets its own directory under the root, named by the
+// hex SHA-256 of the stream ID so that any ID fits in a file name. It holds
+// the stream ID itself and segment files named after the sequence number of
+// their first record:
+//
+//	<root>/<sha256(streamID)>/stream.id
+//	<root>/<sha256(streamID)>/00000000000000000001.seg
+//	<root>/<sha256(streamID)>/00000000000000004711.seg
+//
+// Directories named by the hex-encoded stream ID, as written by earlier
+// versions, are still loaded.
+//
+// Each record is length-prefixed and CRC32-checksummed. On open, every
+// segment is scanned to rebuild the in-memory index (ID → sequence →
+// segment offset); a torn or corrupt record — e.g., from a crash mid-write —
+// is truncated away along with anything after it in that segment, so a
+// crash never loses more than the record being written.
+//
+// Event data is kept on disk only; the index holds IDs, offsets and
+// timestamps, so memory use is proportional to the number of retained
+// events, not their size.
+//
+// Retention (count, age, bytes) is applied logically per event, and whole
+// segments are deleted once every event in them has expired. Compact
+// rewrites the partially expired head segment to reclaim the remainder.
+//
+// Thread-safe. A directory must be used by only one FileEventStore at a time.
+type FileEventStore struct {
+	dir  string
+	opts FileEventStoreOptions
+
+	mu      sync.RWMutex
+	streams map[string]*fileStream
+
+	// now is the clock used for timestamps and age retention. Overridable
+	// in tests.
+	now func() time.Time
+
+	stopCompact chan struct{}
+	compactDone chan struct{}
+	closeOnce   sync.Once
+}
+
+// fileStream is the per-stream state: its segment files, the index of
+// retained records, and the open handle of the active (last) segment.
+type fileStream struct {
+	mu       sync.Mutex
+	dir      string
+	segments []*fileSegment // ordered by baseSeq; the last one is active
+	index    []fileRecordRef
+	byID     map[string]uint64 // event ID → seq of the latest event with it
+	nextSeq  uint64
+	bytes    int64 // on-disk size of retained records
+	active   *os.File
+}
+
+// fileSegment describes one segment file.
+type fileSegment struct {
+	path    string
+	baseSeq uint64
+	size    int64
+	lastSeq uint64
+}
+
+// fileRecordRef locates a retained record on disk.
+type fileRecordRef struct {
+	seq    uint64
+	id     string
+	ts     int64 // unix nanoseconds
+	seg    *fileSegment
+	offset int64
+	size   int64 // full record size, header included
+}
+
+const (
+	defaultSegmentSize = 4 << 20 // 4 MB
+	segmentExt         = ".seg"
+	streamIDFile       = "stream.id"
+	fileRecordHeader   = 8        // uint32 payload length + uint32 CRC32
+	maxFileRecordSize  = 64 << 20 // sanity bound when scanning
+)
+
+// NewFileEventStore opens (or creates) a FileEventStore rooted at dir,
+// recovering any existing streams. If opts is nil, defaults are used.
+func NewFileEventStore(dir string, opts *FileEventStoreOptions) (*FileEventStore, error) {
+	s := &FileEventStore{
+		dir:     dir,
+		streams: make(map[string]*fileStream),
+		now:     time.Now,
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.SegmentSize <= 0 {
+		s.opts.SegmentSize = defaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating event store dir: %w", err)
+	}
+	if err := s.load(); err != nil {
+		s.closeStreams()
+		return nil, err
+	}
+	if s.opts.CompactInterval > 0 {
+		s.stopCompact = make(chan struct{})
+		s.compactDone = make(chan struct{})
+		go s.compactLoop()
+	}
+	return s, nil
+}
+
+// Store appends an event to the stream's active segment, then applies
+// retention.
+func (s *FileEventStore) Store(streamID string, event StoredEvent) error {
+	st, err := s.stream(streamID, true)
+	if err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	seg := st.activeSegment()
+	if st.active == nil || seg.size >= s.opts.SegmentSize {
+		if seg, err = st.rollover(); err != nil {
+			return err
+		}
+	}
+
+	now := s.now().UnixNano()
+	seq := st.nextSeq
+	rec := encodeFileRecord(seq, now, event)
+	if _, err := st.active.Write(rec); err != nil {
+		// Drop whatever part of the record made it to disk so the segment
+		// stays well-formed for the next append.
+		st.active.Truncate(seg.size)
+		return fmt.Errorf("writing event: %w", err)
+	}
+	if s.opts.Sync {
+		if err := st.active.Sync(); err != nil {
+			return fmt.Errorf("syncing event: %w", err)
+		}
+	}
+
+	size := int64(len(rec))
+	st.index = append(st.index, fileRecordRef{
+		seq: seq, id: event.ID, ts: now, seg: seg, offset: seg.size, size: size,
+	})
+	if event.ID != "" {
+		st.byID[event.ID] = seq
+	}
+	st.nextSeq++
+	seg.size += size
+	seg.lastSeq = seq
+	st.bytes += size
+
+	st.enforceRetention(now, &s.opts)
+	return nil
+}
+
+// Replay returns the retained events after lastEventID, reading their data
+// from disk. If lastEventID is unknown (never stored, or expired), all
+// retained events are returned.
+func (s *FileEventStore) Replay(streamID string, lastEventID string) ([]StoredEvent, error) {
+	st, err := s.stream(streamID, false)
+	if err != nil || st == nil {
+		return nil, err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.enforceRetention(s.now().UnixNano(), &s.opts)
+	start := 0
+	if seq, ok := st.byID[lastEventID]; ok {
+		start = st.position(seq) + 1
+	}
+	if start >= len(st.index) {
+		return nil, nil
+	}
+	return st.read(st.index[start:])
+}
+
+// Trim removes all stored events for the stream, deleting its directory.
+func (s *FileEventStore) Trim(streamID string) error {
+	s.mu.Lock()
+	st := s.streams[streamID]
+	delete(s.streams, streamID)
+	s.mu.Unlock()
+	if st == nil {
+		return nil
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.active != nil {
+		st.active.Close()
+		st.active = nil
+	}
+	st.segments, st.index, st.byID = nil, nil, map[string]uint64{}
+	return os.RemoveAll(st.dir)
+}
+
+// Compact applies retention to every stream and rewrites each stream's
+// partially expired head segment so that the space held by its expired
+// records is reclaimed. Safe to call concurrently with Store and Replay.
+func (s *FileEventStore) Compact() error {
+	s.mu.RLock()
+	streams := make([]*fileStream, 0, len(s.streams))
+	for _, st := range s.streams {
+		streams = append(streams, st)
+	}
+	s.mu.RUnlock()
+
+	var errs []error
+	now := s.now().UnixNano()
+	for _, st := range streams {
+		st.mu.Lock()
+		st.enforceRetention(now, &s.opts)
+		if err := st.compactHead(); err != nil {
+			errs = append(errs, err)
+		}
+		st.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops background compaction and closes all open segment files.
+// The store must not be used after Close.
+func (s *FileEventStore) Close() error {
+	s.closeOnce.Do(func() {
+		if s.stopCompact != nil {
+			close(s.stopCompact)
+			<-s.compactDone
+		}
+	})
+	return s.closeStreams()
+}
+
+func (s *FileEventStore) closeStreams() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, st := range s.streams {
+		st.mu.Lock()
+		if st.active != nil {
+			errs = append(errs, st.active.Close())
+			st.active = nil
+		}
+		st.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func (s *FileEventStore) compactLoop() {
+	defer close(s.compactDone)
+	ticker := time.NewTicker(s.opts.CompactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCompact:
+			return
+		case <-ticker.C:
+			if err := s.Compact(); err != nil {
+				log.Printf("FileEventStore: compaction failed: %v", err)
+			}
+		}
+	}
+}
+
+// stream returns the state for streamID, creating it if create is set.
+func (s *FileEventStore) stream(streamID string, create bool) (*fileStream, error) {
+	s.mu.RLock()
+	st := s.streams[streamID]
+	s.mu.RUnlock()
+	if st != nil || !create {
+		return st, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st = s.streams[streamID]; st != nil {
+		return st, nil
+	}
+	sum := sha256.Sum256([]byte(streamID))
+	dir := filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating stream dir: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, streamIDFile), []byte(streamID), 0o644); err != nil {
+		return nil, fmt.Errorf("writing stream id: %w", err)
+	}
+	st = &fileStream{dir: dir, byID: make(map[string]uint64), nextSeq: 1}
+	s.streams[streamID] = st
+	return st, nil
+}
+
+// load recovers every stream directory under the root.
+func (s *FileEventStore) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("reading event store dir: %w", err)
+	}
+	now := s.now().UnixNano()
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.dir, e.Name())
+		id, ok := readStreamID(dir)
+		if !ok {
+			continue // not ours
+		}
+		st, err := loadFileStream(dir)
+		if err != nil {
+			return err
+		}
+		if id == "" && len(st.segments) == 0 {
+			// Created but never written to before a crash.
+			os.RemoveAll(dir)
+			continue
+		}
+		st.enforceRetention(now, &s.opts)
+		s.streams[id] = st
+	}
+	return nil
+}
+
+// readStreamID returns the stream ID a directory holds, from its stream.id
+// file or, for the earlier layout, its hex-encoded name. A directory with
+// neither stream.id nor segments yields "" (a crash between creating it
+// and writing stream.id).
+func readStreamID(dir string) (string, bool) {
+	if data, err := os.ReadFile(filepath.Join(dir, streamIDFile)); err == nil {
+		return string(data), true
+	}
+	id, err := hex.DecodeString(filepath.Base(dir))
+	if err != nil {
+		return "", false
+	}
+	if !hasSegments(dir) {
+		return "", true
+	}
+	return string(id), true
+}
+
+func hasSegments(dir string) bool {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if _, ok := parseSegmentName(e.Name()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFileStream scans a stream's segments in order, truncating any torn or
+// corrupt tail, and reopens the last segment for appending.
+func loadFileStream(dir string) (*fileStream, error) {
+	st := &fileStream{dir: dir, byID: make(map[string]uint64), nextSeq: 1}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading stream dir: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, segmentExt+".tmp") {
+			// Leftover from an interrupted compaction; the original
+			// segment is still intact.
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		base, ok := parseSegmentName(name)
+		if !ok {
+			continue
+		}
+		st.segments = append(st.segments, &fileSegment{path: filepath.Join(dir, name), baseSeq: base})
+	}
+	sort.Slice(st.segments, func(i, j int) bool { return st.segments[i].baseSeq < st.segments[j].baseSeq })
+
+	var lastSeq uint64
+	kept := st.segments[:0]
+	for i, seg := range st.segments {
+		if err := st.scanSegment(seg, &lastSeq); err != nil {
+			return nil, err
+		}
+		// Drop segments that hold nothing new, except the last, which
+		// stays as the append target.
+		if seg.size == 0 && i < len(st.segments)-1 {
+			os.Remove(seg.path)
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	st.segments = kept
+	if lastSeq > 0 {
+		st.nextSeq = lastSeq + 1
+	}
+
+	if seg := st.activeSegment(); seg != nil {
+		f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening segment: %w", err)
+		}
+		st.active = f
+	}
+	return st, nil
+}
+
+// scanSegment indexes the valid records of seg. Records whose seq is not
+// beyond *lastSeq are skipped — they are copies left behind when a crash
+// interrupted compaction after the rewritten segment was renamed into place.
+// The first invalid record ends the scan and the file is truncated there.
+func (st *fileStream) scanSegment(seg *fileSegment, lastSeq *uint64) error {
+	data, err := os.ReadFile(seg.path)
+	if err != nil {
+		return fmt.Errorf("reading segment: %w", err)
+	}
+
+	var off int64
+	for off < int64(len(data)) {
+		rec, size, ok := decodeFileRecord(data[off:])
+		if !ok {
+			log.Printf("FileEventStore: truncating %s at offset %d (torn or corrupt record)", seg.path, off)
+			if err := os.Truncate(seg.path, off); err != nil {
+				return fmt.Errorf("truncating segment: %w", err)
+			}
+			break
+		}
+		if rec.seq > *lastSeq {
+			st.index = append(st.index, fileRecordRef{
+				seq: rec.seq, id: rec.event.ID, ts: rec.ts, seg: seg, offset: off, size: size,
+			})
+			if rec.event.ID != "" {
+				st.byID[rec.event.ID] = rec.seq
+			}
+			st.bytes += size
+			seg.lastSeq = rec.seq
+			*lastSeq = rec.seq
+		}
+		off += size
+	}
+	seg.size = off
+	return nil
+}
+
+func (st *fileStream) activeSegment() *fileSegment {
+	if len(st.segments) == 0 {
+		return nil
+	}
+	return st.segments[len(st.segments)-1]
+}
+
+// rollover closes the active segment and starts a new one named after the
+// next sequence number.
+func (st *fileStream) rollover() (*fileSegment, error) {
+	if st.active != nil {
+		st.active.Close()
+		st.active = nil
+	}
+	// An empty active segment (fresh stream, or everything expired) is
+	// reused rather than leaving an empty file behind.
+	if seg := st.activeSegment(); seg != nil && seg.size == 0 {
+		os.Remove(seg.path)
+		st.segments = st.segments[:len(st.segments)-1]
+	}
+	seg := &fileSegment{path: filepath.Join(st.dir, segmentName(st.nextSeq)), baseSeq: st.nextSeq}
+	f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("creating segment: %w", err)
+	}
+	st.active = f
+	st.segments = append(st.segments, seg)
+	return seg, nil
+}
+
+// enforceRetention drops the oldest records that exceed the count, age or
+// byte limits, then deletes segments left with no retained records.
+func (st *fileStream) enforceRetention(now int64, opts *FileEventStoreOptions) {
+	n := len(st.index)
+	drop := 0
+	if opts.MaxEventsPerStream > 0 && n > opts.MaxEventsPerStream {
+		drop = n - opts.MaxEventsPerStream
+	}
+	if opts.MaxAge > 0 {
+		cutoff := now - opts.MaxAge.Nanoseconds()
+		for drop < n && st.index[drop].ts < cutoff {
+			drop++
+		}
+	}
+	var dropped int64
+	for i := 0; i < drop; i++ {
+		dropped += st.index[i].size
+	}
+	if opts.MaxBytesPerStream > 0 {
+		for drop < n && st.bytes-dropped > opts.MaxBytesPerStream {
+			dropped += st.index[drop].size
+			drop++
+		}
+	}
+	if drop == 0 {
+		return
+	}
+
+	for _, ref := range st.index[:drop] {
+		if ref.id != "" && st.byID[ref.id] == ref.seq {
+			delete(st.byID, ref.id)
+		}
+	}
+	st.index = st.index[drop:]
+	st.bytes -= dropped
+
+	// Delete fully expired segments. The active segment is kept as the
+	// append target even when empty of retained records.
+	firstRetained := st.nextSeq
+	if len(st.index) > 0 {
+		firstRetained = st.index[0].seq
+	}
+	kept := st.segments[:0]
+	for i, seg := range st.segments {
+		if i < len(st.segments)-1 && seg.lastSeq < firstRetained {
+			if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+				log.Printf("FileEventStore: removing %s: %v", seg.path, err)
+			}
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	st.segments = kept
+}
+
+// compactHead rewrites the oldest segment if some of its records have
+// expired, copying the retained ones to a new segment file named after the
+// first of them. The copy is written to a .tmp file and renamed into place
+// before the original is removed, so a crash at any point leaves at least
+// one complete copy of every retained record.
+func (st *fileStream) compactHead() error {
+	if len(st.segments) == 0 || len(st.index) == 0 {
+		return nil
+	}
+	seg := st.segments[0]
+	first := st.index[0]
+	if first.seg != seg || first.offset == 0 {
+		return nil // head segment has no expired records
+	}
+
+	var refs []*fileRecordRef
+	for i := range st.index {
+		if st.index[i].seg != seg {
+			break
+		}
+		refs = append(refs, &st.index[i])
+	}
+
+	src, err := os.Open(seg.path)
+	if err != nil {
+		return fmt.Errorf("opening segment: %w", err)
+	}
+	defer src.Close()
+
+	newPath := filepath.Join(st.dir, segmentName(first.seq))
+	tmp, err := os.OpenFile(newPath+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("creating compacted segment: %w", err)
+	}
+	offsets := make([]int64, len(refs))
+	var off int64
+	for i, ref := range refs {
+		buf := make([]byte, ref.size)
+		if _, err := src.ReadAt(buf, ref.offset); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return fmt.Errorf("reading record %d: %w", ref.seq, err)
+		}
+		if _, err := tmp.Write(buf); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return fmt.Errorf("writing compacted segment: %w", err)
+		}
+		offsets[i] = off
+		off += ref.size
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("syncing compacted segment: %w", err)
+	}
+	tmp.Close()
+
+	isActive := seg == st.activeSegment()
+	if isActive && st.active != nil {
+		st.active.Close()
+		st.active = nil
+	}
+	if err := os.Rename(tmp.Name(), newPath); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("installing compacted segment: %w", err)
+	}
+	if err := os.Remove(seg.path); err != nil {
+		log.Printf("FileEventStore: removing compacted segment %s: %v", seg.path, err)
+	}
+
+	seg.path, seg.baseSeq, seg.size = newPath, first.seq, off
+	for i, ref := range refs {
+		ref.offset = offsets[i]
+	}
+	if isActive {
+		f, err := os.OpenFile(newPath, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("reopening segment: %w", err)
+		}
+		st.active = f
+	}
+	return nil
+}
+
+// position returns the index position of the record with the given seq.
+func (st *fileStream) position(seq uint64) int {
+	return sort.Search(len(st.index), func(i int) bool { return st.index[i].seq >= seq })
+}
+
+// read loads the events for refs from disk, opening each segment once.
+func (st *fileStream) read(refs []fileRecordRef) ([]StoredEvent, error) {
+	result := make([]StoredEvent, 0, len(refs))
+	var f *os.File
+	var fseg *fileSegment
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	for _, ref := range refs {
+		if ref.seg != fseg {
+			if f != nil {
+				f.Close()
+			}
+			var err error
+			if f, err = os.Open(ref.seg.path); err != nil {
+				return nil, fmt.Errorf("opening segment: %w", err)
+			}
+			fseg = ref.seg
+		}
+		buf := make([]byte, ref.size)
+		if _, err := f.ReadAt(buf, ref.offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("reading record %d: %w", ref.seq, err)
+		}
+		rec, _, ok := decodeFileRecord(buf)
+		if !ok {
+			return nil, fmt.Errorf("corrupt record %d in %s", ref.seq, ref.seg.path)
+		}
+		result = append(result, rec.event)
+	}
+	return result, nil
+}
+
+// ============================================================================
+// Record encoding
+// ============================================================================
+
+// fileRecord is a decoded segment record.
+type fileRecord struct {
+	seq   uint64
+	ts    int64
+	event StoredEvent
+}
+
+// encodeFileRecord builds the on-disk form of an event:
+//
+//	uint32 payload length | uint32 CRC32(payload) | payload
+//	payload = uint64 seq | int64 unix nanos | uvarint len, ID | uvarint len, Event | Data
+func encodeFileRecord(seq uint64, ts int64, ev StoredEvent) []byte {
+	payloadLen := 16 + 2*binary.MaxVarintLen64 + len(ev.ID) + len(ev.Event) + len(ev.Data)
+	buf := make([]byte, fileRecordHeader, fileRecordHeader+payloadLen)
+	buf = binary.BigEndian.AppendUint64(buf, seq)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(ts))
+	buf = binary.AppendUvarint(buf, uint64(len(ev.ID)))
+	buf = append(buf, ev.ID...)
+	buf = binary.AppendUvarint(buf, uint64(len(ev.Event)))
+	buf = append(buf, ev.Event...)
+	buf = append(buf, ev.Data...)
+
+	payload := buf[fileRecordHeader:]
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	return buf
+}
+
+// decodeFileRecord decodes the record at the start of data, returning its
+// full size. ok is false if the record is truncated or fails its checksum.
+func decodeFileRecord(data []byte) (rec fileRecord, size int64, ok bool) {
+	if len(data) < fileRecordHeader {
+		return rec, 0, false
+	}
+	n := int64(binary.BigEndian.Uint32(data[0:4]))
+	if n < 16 || n > maxFileRecordSize || int64(len(data)) < fileRecordHeader+n {
+		return rec, 0, false
+	}
+	payload := data[fileRecordHeader : fileRecordHeader+n]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:8]) {
+		return rec, 0, false
+	}
+
+	rec.seq = binary.BigEndian.Uint64(payload[0:8])
+	rec.ts = int64(binary.BigEndian.Uint64(payload[8:16]))
+	rest := payload[16:]
+	id, rest, ok := readUvarintString(rest)
+	if !ok {
+		return rec, 0, false
+	}
+	event, rest, ok := readUvarintString(rest)
+	if !ok {
+		return rec, 0, false
+	}
+	rec.event = StoredEvent{ID: id, Event: event, Data: append([]byte(nil), rest...)}
+	return rec, fileRecordHeader + n, true
+}
+
+func readUvarintString(b []byte) (string, []byte, bool) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < l {
+		return "", nil, false
+	}
+	return string(b[n : n+int(l)]), b[n+int(l):], true
+}
+
+func segmentName(baseSeq uint64) string {
+	return fmt.Sprintf("%020d%s", baseSeq, segmentExt)
+}
+
+func parseSegmentName(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, segmentExt) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+	return n, err == nil
+}
+
+// ============================================================================
+// Compile-time interface compliance
+// ============================================================================
+
+var _ EventStore = (*FileEventStore)(nil)
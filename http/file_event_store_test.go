@@ -0,0 +1,363 @@
+package http
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// FileEventStore Tests
+// ============================================================================
+
+// openTestFileStore opens a FileEventStore in dir and registers cleanup.
+func openTestFileStore(t *testing.T, dir string, opts *FileEventStoreOptions) *FileEventStore {
+	t.Helper()
+	store, err := NewFileEventStore(dir, opts)
+	if err != nil {
+		t.Fatalf("NewFileEventStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// storeSeq stores events with IDs from..to (inclusive) on stream s1.
+func storeSeq(t *testing.T, store EventStore, from, to int) {
+	t.Helper()
+	for i := from; i <= to; i++ {
+		ev := StoredEvent{ID: fmt.Sprintf("%d", i), Event: "message", Data: []byte(fmt.Sprintf(`{"seq":%d}`, i))}
+		if err := store.Store("s1", ev); err != nil {
+			t.Fatalf("Store %d: %v", i, err)
+		}
+	}
+}
+
+// replayIDs replays s1 from lastEventID and returns the event IDs.
+func replayIDs(t *testing.T, store EventStore, lastEventID string) []string {
+	t.Helper()
+	events, err := store.Replay("s1", lastEventID)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	ids := make([]string, len(events))
+	for i, ev := range events {
+		ids[i] = ev.ID
+	}
+	return ids
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, _ := filepath.Glob(filepath.Join(dir, "*", "*"+segmentExt))
+	return matches
+}
+
+// TestFileEventStoreStoreAndReplay verifies the basic round-trip, including
+// event type and data, and replay from a mid-stream anchor.
+func TestFileEventStoreStoreAndReplay(t *testing.T) {
+	store := openTestFileStore(t, t.TempDir(), nil)
+	storeSeq(t, store, 1, 5)
+
+	events, err := store.Replay("s1", "2")
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events after ID '2', got %d", len(events))
+	}
+	if events[0].ID != "3" || events[0].Event != "message" || string(events[0].Data) != `{"seq":3}` {
+		t.Errorf("Unexpected first event: %+v", events[0])
+	}
+	if ids := replayIDs(t, store, "5"); len(ids) != 0 {
+		t.Errorf("Expected nothing after last event, got %v", ids)
+	}
+	if ids := replayIDs(t, store, "unknown"); len(ids) != 5 {
+		t.Errorf("Expected all 5 events for unknown anchor, got %v", ids)
+	}
+	if events, _ := store.Replay("nonexistent", "1"); events != nil {
+		t.Errorf("Expected nil for nonexistent stream, got %v", events)
+	}
+}
+
+// TestFileEventStoreSurvivesReopen verifies that events written by one
+// store instance are replayable from a new instance on the same directory,
+// and that appends continue after the recovered events.
+func TestFileEventStoreSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileEventStore(dir, &FileEventStoreOptions{SegmentSize: 64})
+	storeSeq(t, store, 1, 10)
+	store.Close()
+
+	store = openTestFileStore(t, dir, &FileEventStoreOptions{SegmentSize: 64})
+	if ids := replayIDs(t, store, "7"); fmt.Sprint(ids) != "[8 9 10]" {
+		t.Errorf("After reopen, replay from 7 = %v, want [8 9 10]", ids)
+	}
+	storeSeq(t, store, 11, 12)
+	if ids := replayIDs(t, store, "10"); fmt.Sprint(ids) != "[11 12]" {
+		t.Errorf("Replay from 10 = %v, want [11 12]", ids)
+	}
+}
+
+// TestFileEventStoreLongStreamID verifies that stream IDs longer than a
+// file name allows are stored and recovered, and that directories from the
+// earlier hex-named layout still load.
+func TestFileEventStoreLongStreamID(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("/very/long/url/path", 16)[:300]
+	store, err := NewFileEventStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Store(long, StoredEvent{ID: "1", Data: []byte(`{}`)}); err != nil {
+		t.Fatalf("Store with a 300-byte stream ID: %v", err)
+	}
+	store.Close()
+
+	legacy := filepath.Join(dir, hex.EncodeToString([]byte("old")))
+	os.MkdirAll(legacy, 0o755)
+	os.WriteFile(filepath.Join(legacy, segmentName(1)), encodeFileRecord(1, time.Now().UnixNano(), StoredEvent{ID: "a"}), 0o644)
+
+	store = openTestFileStore(t, dir, nil)
+	if events, err := store.Replay(long, ""); err != nil || len(events) != 1 || events[0].ID != "1" {
+		t.Errorf("long stream after reopen = %v, %v", events, err)
+	}
+	if events, err := store.Replay("old", ""); err != nil || len(events) != 1 || events[0].ID != "a" {
+		t.Errorf("legacy stream = %v, %v", events, err)
+	}
+}
+
+// TestFileEventStoreRecoversTornWrite verifies that a partially written
+// record at the end of a segment (a crash mid-write) is truncated on open,
+// preserving every complete record before it and leaving the segment
+// appendable.
+func TestFileEventStoreRecoversTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileEventStore(dir, nil)
+	storeSeq(t, store, 1, 3)
+	store.Close()
+
+	segs := segmentFiles(t, dir)
+	if len(segs) != 1 {
+		t.Fatalf("Expected 1 segment, got %d", len(segs))
+	}
+	info, _ := os.Stat(segs[0])
+	goodSize := info.Size()
+
+	// Append the first half of a valid record.
+	rec := encodeFileRecord(4, time.Now().UnixNano(), StoredEvent{ID: "4", Data: []byte(`{"seq":4}`)})
+	f, _ := os.OpenFile(segs[0], os.O_WRONLY|os.O_APPEND, 0o644)
+	f.Write(rec[:len(rec)/2])
+	f.Close()
+
+	store = openTestFileStore(t, dir, nil)
+	if ids := replayIDs(t, store, ""); fmt.Sprint(ids) != "[1 2 3]" {
+		t.Errorf("After recovery, events = %v, want [1 2 3]", ids)
+	}
+	if info, _ := os.Stat(segs[0]); info.Size() != goodSize {
+		t.Errorf("Segment size = %d, want truncated to %d", info.Size(), goodSize)
+	}
+	storeSeq(t, store, 4, 4)
+	if ids := replayIDs(t, store, "3"); fmt.Sprint(ids) != "[4]" {
+		t.Errorf("Replay from 3 after append = %v, want [4]", ids)
+	}
+}
+
+// TestFileEventStoreRecoversCorruptRecord verifies that a record failing
+// its checksum ends the valid portion of the segment.
+func TestFileEventStoreRecoversCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileEventStore(dir, nil)
+	storeSeq(t, store, 1, 3)
+	store.Close()
+
+	// Flip the last byte of the file, which belongs to record 3's data.
+	seg := segmentFiles(t, dir)[0]
+	data, _ := os.ReadFile(seg)
+	data[len(data)-1] ^= 0xFF
+	os.WriteFile(seg, data, 0o644)
+
+	store = openTestFileStore(t, dir, nil)
+	if ids := replayIDs(t, store, ""); fmt.Sprint(ids) != "[1 2]" {
+		t.Errorf("After recovery, events = %v, want [1 2]", ids)
+	}
+}
+
+// TestFileEventStoreRetentionByCount verifies that MaxEventsPerStream drops
+// the oldest events and deletes segments that no longer hold any.
+func TestFileEventStoreRetentionByCount(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestFileStore(t, dir, &FileEventStoreOptions{MaxEventsPerStream: 3, SegmentSize: 64})
+	storeSeq(t, store, 1, 20)
+
+	if ids := replayIDs(t, store, ""); fmt.Sprint(ids) != "[18 19 20]" {
+		t.Errorf("Retained events = %v, want [18 19 20]", ids)
+	}
+	// 3 records of ~40 bytes span at most 3 segments of 64 bytes.
+	if n := len(segmentFiles(t, dir)); n > 3 {
+		t.Errorf("Expected expired segments to be deleted, %d remain", n)
+	}
+	// The evicted anchor falls back to all retained events.
+	if ids := replayIDs(t, store, "2"); len(ids) != 3 {
+		t.Errorf("Replay from evicted ID = %v, want all 3 retained", ids)
+	}
+}
+
+// TestFileEventStoreRetentionByAge verifies that events older than MaxAge
+// are no longer replayed, including after reopening.
+func TestFileEventStoreRetentionByAge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1000, 0)
+	store := openTestFileStore(t, dir, &FileEventStoreOptions{MaxAge: time.Minute})
+	store.now = func() time.Time { return now }
+
+	storeSeq(t, store, 1, 2)
+	now = now.Add(2 * time.Minute)
+	storeSeq(t, store, 3, 3)
+
+	if ids := replayIDs(t, store, ""); fmt.Sprint(ids) != "[3]" {
+		t.Errorf("Retained events = %v, want [3]", ids)
+	}
+	now = now.Add(2 * time.Minute)
+	if ids := replayIDs(t, store, ""); len(ids) != 0 {
+		t.Errorf("Expected all events expired, got %v", ids)
+	}
+}
+
+// TestFileEventStoreRetentionByBytes verifies that MaxBytesPerStream keeps
+// the newest events whose total on-disk size fits the limit.
+func TestFileEventStoreRetentionByBytes(t *testing.T) {
+	store := openTestFileStore(t, t.TempDir(), nil)
+	recSize := int64(len(encodeFileRecord(1, 0, StoredEvent{ID: "1", Event: "message", Data: []byte(`{"seq":1}`)})))
+	store.opts.MaxBytesPerStream = 2 * recSize
+
+	storeSeq(t, store, 1, 5)
+	if ids := replayIDs(t, store, ""); fmt.Sprint(ids) != "[4 5]" {
+		t.Errorf("Retained events = %v, want [4 5]", ids)
+	}
+}
+
+// TestFileEventStoreCompact verifies that Compact rewrites a partially
+// expired segment so that its expired records no longer use disk, and that
+// replay and appends keep working afterwards and across a reopen.
+func TestFileEventStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	opts := &FileEventStoreOptions{MaxEventsPerStream: 2}
+	store, _ := NewFileEventStore(dir, opts)
+	storeSeq(t, store, 1, 10)
+
+	before, _ := os.Stat(segmentFiles(t, dir)[0])
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	segs := segmentFiles(t, dir)
+	if len(segs) != 1 {
+		t.Fatalf("Expected 1 segment after compaction, got %v", segs)
+	}
+	after, _ := os.Stat(segs[0])
+	if after.Size() >= before.Size() {
+		t.Errorf("Segment size %d not reduced from %d", after.Size(), before.Size())
+	}
+	if filepath.Base(segs[0]) != segmentName(9) {
+		t.Errorf("Compacted segment = %s, want %s", filepath.Base(segs[0]), segmentName(9))
+	}
+
+	storeSeq(t, store, 11, 11)
+	if ids := replayIDs(t, store, "9"); fmt.Sprint(ids) != "[10 11]" {
+		t.Errorf("Replay after compaction = %v, want [10 11]", ids)
+	}
+	store.Close()
+
+	store = openTestFileStore(t, dir, opts)
+	if ids := replayIDs(t, store, ""); fmt.Sprint(ids) != "[10 11]" {
+		t.Errorf("Replay after reopen = %v, want [10 11]", ids)
+	}
+}
+
+// TestFileEventStoreInterruptedCompaction verifies that a leftover .tmp file
+// and a duplicate segment (crash after rename, before removing the original)
+// do not produce duplicate events on reopen.
+func TestFileEventStoreInterruptedCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileEventStore(dir, nil)
+	storeSeq(t, store, 1, 4)
+	store.Close()
+
+	seg := segmentFiles(t, dir)[0]
+	data, _ := os.ReadFile(seg)
+	streamDir := filepath.Dir(seg)
+	// Duplicate of records 3-4, as compaction would have written it.
+	_, size1, _ := decodeFileRecord(data)
+	_, size2, _ := decodeFileRecord(data[size1:])
+	os.WriteFile(filepath.Join(streamDir, segmentName(3)), data[size1+size2:], 0o644)
+	os.WriteFile(filepath.Join(streamDir, segmentName(3)+".tmp"), data[:5], 0o644)
+
+	store = openTestFileStore(t, dir, nil)
+	if ids := replayIDs(t, store, ""); fmt.Sprint(ids) != "[1 2 3 4]" {
+		t.Errorf("Events = %v, want [1 2 3 4]", ids)
+	}
+	if _, err := os.Stat(filepath.Join(streamDir, segmentName(3)+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("Expected leftover .tmp file to be removed")
+	}
+}
+
+// TestFileEventStoreTrim verifies that Trim removes the stream's files and
+// that the stream can be written again afterwards.
+func TestFileEventStoreTrim(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestFileStore(t, dir, nil)
+	storeSeq(t, store, 1, 3)
+
+	if err := store.Trim("s1"); err != nil {
+		t.Fatalf("Trim: %v", err)
+	}
+	if events, _ := store.Replay("s1", ""); events != nil {
+		t.Errorf("Expected no events after Trim, got %v", events)
+	}
+	if n := len(segmentFiles(t, dir)); n != 0 {
+		t.Errorf("Expected no segment files after Trim, got %d", n)
+	}
+	storeSeq(t, store, 4, 4)
+	if ids := replayIDs(t, store, ""); fmt.Sprint(ids) != "[4]" {
+		t.Errorf("Events after re-store = %v, want [4]", ids)
+	}
+}
+
+// TestFileEventStoreConcurrentAccess verifies thread safety under
+// concurrent Store and Replay across streams (run with -race).
+func TestFileEventStoreConcurrentAccess(t *testing.T) {
+	store := openTestFileStore(t, t.TempDir(), &FileEventStoreOptions{MaxEventsPerStream: 50, SegmentSize: 512})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(2)
+		stream := fmt.Sprintf("stream-%d", g%2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				store.Store(stream, StoredEvent{ID: fmt.Sprintf("%d", i), Data: []byte(`{}`)})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				store.Replay(stream, fmt.Sprintf("%d", i))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, stream := range []string{"stream-0", "stream-1"} {
+		events, err := store.Replay(stream, "")
+		if err != nil {
+			t.Fatalf("Replay: %v", err)
+		}
+		if len(events) != 50 {
+			t.Errorf("%s: expected 50 retained events, got %d", stream, len(events))
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	conc "github.com/panyam/gocurrent"
+	gut "github.com/panyam/goutils/utils"
+)
+
+// FramedStreamConn is a bidirectional connection over a Content-Length
+// framed byte stream (see WriteFrame and ReadFrame). It is the framed-stream
+// counterpart of WSConn: the same lifecycle hooks, run by FramedHandleConn
+// instead of WSHandleConn.
+//
+// Implementations typically embed FramedConn[I, O] and override
+// HandleMessage.
+type FramedStreamConn[I any] interface {
+	BiDirStreamConn[I]
+
+	// ReadMessage reads and decodes the next frame. Decoding failures are
+	// returned as *FrameDecodeError, which does not end the connection
+	// unless OnError says so; any other error does.
+	ReadMessage(r *bufio.Reader) (I, error)
+
+	// OnStart is called once the stream is ready. Use it to set up the
+	// writer. Return an error to close the stream.
+	OnStart(rw io.ReadWriteCloser) error
+}
+
+// FrameDecodeError reports a frame that was read intact but could not be
+// decoded by the Codec. The stream is still in sync, so the connection can
+// continue.
+type FrameDecodeError struct {
+	Err error
+}
+
+func (e *FrameDecodeError) Error() string {
+	return fmt.Sprintf("decoding frame: %v", e.Err)
+}
+
+func (e *FrameDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// FramedConnConfig controls FramedHandleConn. Pings are only useful when
+// the peer understands them; the default FramedConn.SendPing sends nothing
+// and its OnTimeout never closes an idle connection.
+type FramedConnConfig struct {
+	*BiDirStreamConfig
+}
+
+// DefaultFramedConnConfig returns a FramedConnConfig with the
+// DefaultBiDirStreamConfig timings.
+func DefaultFramedConnConfig() *FramedConnConfig {
+	return &FramedConnConfig{BiDirStreamConfig: DefaultBiDirStreamConfig()}
+}
+
+// FramedConn is a generic framed-stream connection that separates transport
+// from encoding, like BaseConn does for WebSockets. Outgoing messages are
+// encoded with Codec and written as frames by a single Writer goroutine, so
+// SendOutput is safe from any goroutine.
+//
+// Usage, e.g. a language-server-like tool on stdio:
+//
+//	type MyConn struct {
+//	    gohttp.FramedConn[MyRequest, MyResponse]
+//	}
+//
+//	func (c *MyConn) HandleMessage(msg MyRequest) error {
+//	    c.SendOutput(handle(msg))
+//	    return nil
+//	}
+//
+//	conn := &MyConn{FramedConn: gohttp.FramedConn[MyRequest, MyResponse]{
+//	    Codec: &gohttp.TypedJSONCodec[MyRequest, MyResponse]{},
+//	}}
+//	err := gohttp.FramedHandleConn(ctx, gohttp.NewReadWriteCloser(os.Stdin, os.Stdout), conn, nil)
+type FramedConn[I any, O any] struct {
+	// Codec handles message encoding/decoding.
+	// Must be set before the connection is used.
+	Codec Codec[I, O]
+
+	// Writer serializes outgoing messages. Initialized in OnStart.
+	Writer *conc.Writer[O]
+
+	// NameStr is an optional human-readable name for this connection.
+	NameStr string
+
+	// ConnIdStr is a unique identifier for this connection.
+	// Auto-generated if not set.
+	ConnIdStr string
+}
+
+// Name returns the connection name.
+func (f *FramedConn[I, O]) Name() string {
+	if f.NameStr == "" {
+		f.NameStr = "FramedConn"
+	}
+	return f.NameStr
+}
+
+// ConnId returns the connection ID, generating one if not set.
+func (f *FramedConn[I, O]) ConnId() string {
+	if f.ConnIdStr == "" {
+		f.ConnIdStr = gut.RandString(10, "")
+	}
+	return f.ConnIdStr
+}
+
+// ReadMessage reads the next frame and decodes it with the Codec.
+func (f *FramedConn[I, O]) ReadMessage(r *bufio.Reader) (I, error) {
+	var zero I
+	frame, err := ReadFrame(r)
+	if err != nil {
+		return zero, err
+	}
+	msg, err := f.Codec.Decode(frame, TextMessage)
+	if err != nil {
+		return zero, &FrameDecodeError{Err: err}
+	}
+	return msg, nil
+}
+
+// OnStart creates the Writer that encodes and frames outgoing messages.
+func (f *FramedConn[I, O]) OnStart(rw io.ReadWriteCloser) error {
+	log.Printf("Starting %s connection: %s", f.Name(), f.ConnId())
+	f.Writer = conc.NewWriter(func(msg O) error {
+		data, _, err := f.Codec.Encode(msg)
+		if err != nil {
+			log.Printf("%s: failed to encode message: %v", f.Name(), err)
+			return nil
+		}
+		return WriteFrame(rw, data)
+	})
+	return nil
+}
+
+// SendPing does nothing: framed protocols such as LSP have no ping message.
+// Override it to send an application-level heartbeat.
+func (f *FramedConn[I, O]) SendPing() error {
+	return nil
+}
+
+// HandleMessage processes an incoming message.
+// Default implementation just logs; override in embedding struct.
+func (f *FramedConn[I, O]) HandleMessage(msg I) error {
+	log.Println("Received message:", msg)
+	return nil
+}
+
+// OnError handles connection errors.
+// Return nil to suppress the error and continue, or return the error to close.
+func (f *FramedConn[I, O]) OnError(err error) error {
+	return err
+}
+
+// OnClose stops the writer.
+func (f *FramedConn[I, O]) OnClose() {
+	if f.Writer != nil {
+		f.Writer.Stop()
+	}
+	log.Printf("Closed %s connection: %s", f.Name(), f.ConnId())
+}
+
+// OnTimeout keeps the connection open: the default SendPing sends nothing,
+// so an idle peer has had no way to show it is alive. Override it together
+// with SendPing to enforce a heartbeat; return true to close.
+func (f *FramedConn[I, O]) OnTimeout() bool {
+	return false
+}
+
+// SendOutput queues a message to be encoded and written as a frame.
+func (f *FramedConn[I, O]) SendOutput(msg O) {
+	if f.Writer != nil {
+		f.Writer.Send(msg)
+	}
+}
+
+// FramedHandleConn runs the lifecycle of conn over rw: OnStart, then
+// HandleMessage for each frame read, periodic SendPing, OnTimeout when
+// nothing has been read for PongPeriod, OnError for failures, and finally
+// OnClose. rw is closed on return.
+//
+// It blocks until rw reaches EOF (returning nil), ctx is done, or an error
+// ends the connection (returned). Errors from HandleMessage go to OnError;
+// a nil result keeps the connection open.
+func FramedHandleConn[I any, S FramedStreamConn[I]](ctx context.Context, rw io.ReadWriteCloser, conn S, config *FramedConnConfig) error {
+	if config == nil {
+		config = DefaultFramedConnConfig()
+	}
+	if config.BiDirStreamConfig == nil {
+		config = &FramedConnConfig{BiDirStreamConfig: DefaultBiDirStreamConfig()}
+	}
+	defer rw.Close()
+
+	// Read in a goroutine so pings, timeouts and ctx can be handled while a
+	// read blocks. Unlike conc.Reader, it keeps going after decode errors.
+	reads := make(chan conc.Message[I])
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		buffered := bufio.NewReader(rw)
+		for {
+			msg, err := conn.ReadMessage(buffered)
+			select {
+			case reads <- conc.Message[I]{Value: msg, Error: err}:
+			case <-stop:
+				return
+			}
+			var decodeErr *FrameDecodeError
+			if err != nil && !errors.As(err, &decodeErr) {
+				return
+			}
+		}
+	}()
+
+	lastReadAt := time.Now()
+	pingTimer := time.NewTicker(config.PingPeriod)
+	pongChecker := time.NewTicker(config.PongPeriod)
+	defer pingTimer.Stop()
+	defer pongChecker.Stop()
+
+	defer conn.OnClose()
+	if err := conn.OnStart(rw); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-pingTimer.C:
+			conn.SendPing()
+		case <-pongChecker.C:
+			if time.Since(lastReadAt) > config.PongPeriod && conn.OnTimeout() {
+				log.Printf("%s: nothing read for %v, closing", conn.Name(), config.PongPeriod)
+				return nil
+			}
+		case result := <-reads:
+			lastReadAt = time.Now()
+			if result.Error != nil {
+				var decodeErr *FrameDecodeError
+				if errors.As(result.Error, &decodeErr) {
+					if err := conn.OnError(result.Error); err != nil {
+						return err
+					}
+					continue
+				}
+				if errors.Is(result.Error, io.EOF) {
+					return nil
+				}
+				conn.OnError(result.Error)
+				return result.Error
+			}
+			if err := conn.HandleMessage(result.Value); err != nil {
+				if err := conn.OnError(err); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// readWriteCloser joins a reader and a writer into one io.ReadWriteCloser.
+type readWriteCloser struct {
+	io.Reader
+	io.Writer
+	closers []io.Closer
+}
+
+func (s *readWriteCloser) Close() error {
+	var errs []error
+	for _, c := range s.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// NewReadWriteCloser joins a reader and a writer, such as a subprocess's
+// stdout and stdin pipes, into an io.ReadWriteCloser for FramedHandleConn.
+// Close closes whichever of r and w are io.Closers.
+func NewReadWriteCloser(r io.Reader, w io.Writer) io.ReadWriteCloser {
+	s := &readWriteCloser{Reader: r, Writer: w}
+	for _, v := range []any{w, r} {
+		if c, ok := v.(io.Closer); ok {
+			s.closers = append(s.closers, c)
+		}
+	}
+	return s
+}
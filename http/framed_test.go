@@ -0,0 +1,178 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type framedMsg struct {
+	Text string `json:"text"`
+}
+
+// echoFramedConn echoes each message back and counts lifecycle calls.
+type echoFramedConn struct {
+	FramedConn[framedMsg, framedMsg]
+	errors atomic.Int32
+	closed chan struct{}
+}
+
+func newEchoFramedConn() *echoFramedConn {
+	return &echoFramedConn{
+		FramedConn: FramedConn[framedMsg, framedMsg]{Codec: &TypedJSONCodec[framedMsg, framedMsg]{}},
+		closed:     make(chan struct{}),
+	}
+}
+
+func (c *echoFramedConn) HandleMessage(msg framedMsg) error {
+	if msg.Text == "quit" {
+		return errors.New("quit requested")
+	}
+	c.SendOutput(framedMsg{Text: "echo:" + msg.Text})
+	return nil
+}
+
+func (c *echoFramedConn) OnError(err error) error {
+	c.errors.Add(1)
+	var decodeErr *FrameDecodeError
+	if errors.As(err, &decodeErr) {
+		return nil
+	}
+	return err
+}
+
+func (c *echoFramedConn) OnClose() {
+	c.FramedConn.OnClose()
+	close(c.closed)
+}
+
+// startFramedConn runs conn over one end of a pipe and returns the other.
+func startFramedConn(t *testing.T, ctx context.Context, conn *echoFramedConn, config ...*FramedConnConfig) (net.Conn, *bufio.Reader, chan error) {
+	t.Helper()
+	server, client := net.Pipe()
+	done := make(chan error, 1)
+	var cfg *FramedConnConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	go func() { done <- FramedHandleConn(ctx, server, conn, cfg) }()
+	t.Cleanup(func() { client.Close() })
+	return client, bufio.NewReader(client), done
+}
+
+func readFrameWithin(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	ch := make(chan string, 1)
+	go func() {
+		frame, err := ReadFrame(r)
+		if err != nil {
+			ch <- "error: " + err.Error()
+			return
+		}
+		ch <- string(frame)
+	}()
+	select {
+	case s := <-ch:
+		return s
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out reading frame")
+		return ""
+	}
+}
+
+// TestFramedConnEcho verifies messages are decoded, handled and answered
+// through the serialized writer, that decode errors go to OnError without
+// closing the stream, and that EOF ends the connection cleanly.
+func TestFramedConnEcho(t *testing.T) {
+	conn := newEchoFramedConn()
+	client, reader, done := startFramedConn(t, context.Background(), conn)
+
+	go func() {
+		WriteFrame(client, []byte(`{"text":"one"}`))
+		WriteFrame(client, []byte(`{not json`))
+		WriteFrame(client, []byte(`{"text":"two"}`))
+	}()
+	if got := readFrameWithin(t, reader); got != `{"text":"echo:one"}` {
+		t.Errorf("first reply = %s", got)
+	}
+	if got := readFrameWithin(t, reader); got != `{"text":"echo:two"}` {
+		t.Errorf("second reply = %s", got)
+	}
+	if conn.errors.Load() != 1 {
+		t.Errorf("OnError calls = %d, want 1 for the bad frame", conn.errors.Load())
+	}
+
+	client.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("FramedHandleConn on EOF = %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("FramedHandleConn did not return on EOF")
+	}
+	<-conn.closed
+}
+
+// TestFramedConnHandlerError verifies that a HandleMessage error kept by
+// OnError closes the connection and is returned.
+func TestFramedConnHandlerError(t *testing.T) {
+	conn := newEchoFramedConn()
+	client, _, done := startFramedConn(t, context.Background(), conn)
+	go WriteFrame(client, []byte(`{"text":"quit"}`))
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "quit requested" {
+			t.Errorf("FramedHandleConn = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("FramedHandleConn did not return")
+	}
+	<-conn.closed
+}
+
+// TestFramedConnContextCancel verifies that cancelling ctx ends the
+// connection and closes the stream.
+func TestFramedConnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := newEchoFramedConn()
+	client, reader, done := startFramedConn(t, ctx, conn)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("FramedHandleConn = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("FramedHandleConn did not return on cancel")
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := ReadFrame(reader); err == nil {
+		t.Error("stream still open after cancel")
+	}
+}
+
+// TestFramedConnIdleStaysOpen verifies that an idle connection outlives
+// PongPeriod, since the default SendPing gives the peer nothing to answer.
+func TestFramedConnIdleStaysOpen(t *testing.T) {
+	cfg := &FramedConnConfig{BiDirStreamConfig: &BiDirStreamConfig{
+		PingPeriod: 5 * time.Millisecond,
+		PongPeriod: 20 * time.Millisecond,
+	}}
+	conn := newEchoFramedConn()
+	client, reader, done := startFramedConn(t, context.Background(), conn, cfg)
+
+	select {
+	case err := <-done:
+		t.Fatalf("idle connection closed: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	go WriteFrame(client, []byte(`{"text":"still here"}`))
+	if got := readFrameWithin(t, reader); got != `{"text":"echo:still here"}` {
+		t.Errorf("reply after idle = %s", got)
+	}
+}
@@ -29,3 +29,58 @@ func SplitBatch(body []byte) ([]json.RawMessage, error) {
 	}
 	return batch, nil
 }
+
+// JSONRPCVersion is the value of the "jsonrpc" member of every message.
+const JSONRPCVersion = "2.0"
+
+// Standard JSON-RPC 2.0 error codes (Section 5.1). Codes from -32000 to
+// -32099 are reserved for implementation-defined server errors.
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+)
+
+// JSONRPCRequest is a JSON-RPC 2.0 request or notification. A request
+// without an "id" member is a notification and gets no response.
+type JSONRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// IsNotification reports whether the request has no ID. Note that an
+// explicit "id": null is a (discouraged) request, not a notification.
+func (r *JSONRPCRequest) IsNotification() bool {
+	return len(r.ID) == 0
+}
+
+// JSONRPCResponse is a JSON-RPC 2.0 response. Exactly one of Result and
+// Error is set.
+type JSONRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+}
+
+// JSONRPCError is the error object of a JSON-RPC 2.0 response. It
+// implements error, so method handlers can return one to control the code
+// and data sent to the client.
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// NewJSONRPCError creates a JSONRPCError with the given code and message.
+func NewJSONRPCError(code int, message string) *JSONRPCError {
+	return &JSONRPCError{Code: code, Message: message}
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
@@ -0,0 +1,667 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrJSONRPCClosed is returned for calls that cannot complete because the
+// client or its transport has closed.
+var ErrJSONRPCClosed = errors.New("jsonrpc: client closed")
+
+// ErrJSONRPCNoResponse is returned when a request/response transport (such
+// as HTTP) completed without a reply to a call.
+var ErrJSONRPCNoResponse = errors.New("jsonrpc: no response for call")
+
+// JSONRPCTransport carries encoded JSON-RPC messages for a JSONRPCClient.
+//
+// Request/response transports (JSONRPCHTTPTransport) hand every reply to
+// the receive callback before Send returns. Full-duplex transports
+// (WebSocket, framed streams) deliver replies from a read loop started by
+// Receive.
+type JSONRPCTransport interface {
+	// Send transmits one encoded request, notification or batch.
+	Send(ctx context.Context, msg []byte) error
+
+	// Receive registers the callbacks for incoming messages. handle is
+	// called with each message received (a response, a batch of responses
+	// or a server notification); done is called once when the transport
+	// can deliver no more, with the reason. Called once, before the first
+	// Send.
+	Receive(handle func(msg []byte), done func(err error))
+
+	// Close releases the transport.
+	Close() error
+}
+
+// jsonrpcSyncTransport is implemented by transports whose replies are all
+// delivered before Send returns, so calls left unanswered can fail at once.
+type jsonrpcSyncTransport interface {
+	repliesOnSend()
+}
+
+// JSONRPCClient is a JSON-RPC 2.0 client. It assigns request IDs,
+// correlates responses (in any order) to waiting calls, batches calls into
+// one message, and hands server notifications to OnNotification. It is
+// safe for concurrent use.
+//
+// Usage:
+//
+//	client := gohttp.NewJSONRPCClient(gohttp.NewJSONRPCHTTPTransport("http://localhost:8080/rpc"))
+//	sum, err := gohttp.JSONRPCCall[int](ctx, client, "add", []int{1, 2})
+type JSONRPCClient struct {
+	// OnNotification, if set, receives notifications sent by the server,
+	// such as progress updates. Set it before the first call.
+	OnNotification func(n *JSONRPCRequest)
+
+	transport JSONRPCTransport
+	nextID    atomic.Int64
+	start     sync.Once
+
+	mu      sync.Mutex
+	pending map[string]chan jsonrpcReply
+	err     error // set once the transport is done
+}
+
+// jsonrpcReply completes a pending call with a response or an error.
+type jsonrpcReply struct {
+	resp *JSONRPCResponse
+	err  error
+}
+
+// NewJSONRPCClient creates a client that talks over transport.
+func NewJSONRPCClient(transport JSONRPCTransport) *JSONRPCClient {
+	return &JSONRPCClient{transport: transport, pending: make(map[string]chan jsonrpcReply)}
+}
+
+// Call invokes method and returns the raw result. A JSON-RPC error from
+// the server is returned as *JSONRPCError.
+func (c *JSONRPCClient) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	req, ch, err := c.newCall(method, params)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		c.forget(req.ID)
+		return nil, err
+	}
+	if err := c.send(ctx, data, []json.RawMessage{req.ID}); err != nil {
+		return nil, err
+	}
+	return c.wait(ctx, req.ID, ch)
+}
+
+// Notify sends a notification; there is no response.
+func (c *JSONRPCClient) Notify(ctx context.Context, method string, params any) error {
+	req, err := newJSONRPCRequest(nil, method, params)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, data, nil)
+}
+
+// Close closes the transport and fails any calls still waiting.
+func (c *JSONRPCClient) Close() error {
+	err := c.transport.Close()
+	c.fail(ErrJSONRPCClosed)
+	return err
+}
+
+// JSONRPCCall invokes method on c and decodes the result into R.
+func JSONRPCCall[R any](ctx context.Context, c *JSONRPCClient, method string, params any) (R, error) {
+	var out R
+	raw, err := c.Call(ctx, method, params)
+	if err != nil {
+		return out, err
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return out, fmt.Errorf("jsonrpc: decoding result of %s: %w", method, err)
+	}
+	return out, nil
+}
+
+// ============================================================================
+// Batches
+// ============================================================================
+
+// JSONRPCBatch collects calls and notifications to send as one batch.
+//
+// Usage:
+//
+//	batch := client.NewBatch()
+//	sum := batch.Call("add", []int{1, 2})
+//	batch.Notify("log", "hello")
+//	if err := batch.Send(ctx); err != nil { ... }
+//	total, err := gohttp.JSONRPCResult[int](sum)
+type JSONRPCBatch struct {
+	client *JSONRPCClient
+	reqs   []*JSONRPCRequest
+	calls  []*JSONRPCPending
+	err    error
+}
+
+// JSONRPCPending is the outcome of one call in a batch, available after
+// the batch's Send returns.
+type JSONRPCPending struct {
+	Method string
+
+	id     json.RawMessage
+	ch     chan jsonrpcReply
+	result json.RawMessage
+	err    error
+}
+
+// Result returns the raw result, or the call's error.
+func (p *JSONRPCPending) Result() (json.RawMessage, error) {
+	return p.result, p.err
+}
+
+// JSONRPCResult decodes the result of a batched call into R.
+func JSONRPCResult[R any](p *JSONRPCPending) (R, error) {
+	var out R
+	if p.err != nil {
+		return out, p.err
+	}
+	if err := json.Unmarshal(p.result, &out); err != nil {
+		return out, fmt.Errorf("jsonrpc: decoding result of %s: %w", p.Method, err)
+	}
+	return out, nil
+}
+
+// NewBatch starts an empty batch.
+func (c *JSONRPCClient) NewBatch() *JSONRPCBatch {
+	return &JSONRPCBatch{client: c}
+}
+
+// Call adds a call to the batch.
+func (b *JSONRPCBatch) Call(method string, params any) *JSONRPCPending {
+	p := &JSONRPCPending{Method: method}
+	req, ch, err := b.client.newCall(method, params)
+	if err != nil {
+		p.err = err
+		if b.err == nil {
+			b.err = err
+		}
+		return p
+	}
+	p.id, p.ch = req.ID, ch
+	b.reqs = append(b.reqs, req)
+	b.calls = append(b.calls, p)
+	return p
+}
+
+// Notify adds a notification to the batch.
+func (b *JSONRPCBatch) Notify(method string, params any) {
+	req, err := newJSONRPCRequest(nil, method, params)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return
+	}
+	b.reqs = append(b.reqs, req)
+}
+
+// Send sends the batch and waits for every call's response. It returns an
+// error only if the batch could not be sent or ctx ended; per-call
+// failures are reported by each JSONRPCPending.
+func (b *JSONRPCBatch) Send(ctx context.Context) error {
+	c := b.client
+	ids := make([]json.RawMessage, len(b.calls))
+	for i, p := range b.calls {
+		ids[i] = p.id
+	}
+	err := b.err
+	var data []byte
+	if err == nil && len(b.reqs) > 0 {
+		data, err = json.Marshal(b.reqs)
+	}
+	if err == nil && len(b.reqs) > 0 {
+		err = c.send(ctx, data, ids)
+	}
+	if err != nil {
+		for _, p := range b.calls {
+			c.forget(p.id)
+			p.err = err
+		}
+		return err
+	}
+	for _, p := range b.calls {
+		p.result, p.err = c.wait(ctx, p.id, p.ch)
+	}
+	return ctx.Err()
+}
+
+// ============================================================================
+// Correlation
+// ============================================================================
+
+func newJSONRPCRequest(id json.RawMessage, method string, params any) (*JSONRPCRequest, error) {
+	req := &JSONRPCRequest{JSONRPC: JSONRPCVersion, ID: id, Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("jsonrpc: encoding params of %s: %w", method, err)
+		}
+		req.Params = encoded
+	}
+	return req, nil
+}
+
+// newCall builds a request with a fresh ID and registers it as pending.
+func (c *JSONRPCClient) newCall(method string, params any) (*JSONRPCRequest, chan jsonrpcReply, error) {
+	id := json.RawMessage(strconv.FormatInt(c.nextID.Add(1), 10))
+	req, err := newJSONRPCRequest(id, method, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch := make(chan jsonrpcReply, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	c.pending[string(id)] = ch
+	return req, ch, nil
+}
+
+// send starts the transport on first use and sends data. ids are the calls
+// in data; on a request/response transport any left unanswered afterwards
+// fail with the *JSONRPCError the server replied with under a null id, or
+// with ErrJSONRPCNoResponse.
+func (c *JSONRPCClient) send(ctx context.Context, data []byte, ids []json.RawMessage) error {
+	c.start.Do(func() { c.transport.Receive(c.receive, c.fail) })
+	err := c.transport.Send(ctx, data)
+	_, sync := c.transport.(jsonrpcSyncTransport)
+	var unmatched *JSONRPCError
+	if err != nil && !(sync && errors.As(err, &unmatched)) {
+		for _, id := range ids {
+			c.forget(id)
+		}
+		return err
+	}
+	if !sync {
+		return nil
+	}
+	reply := jsonrpcReply{err: ErrJSONRPCNoResponse}
+	if unmatched != nil {
+		reply.err = unmatched
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		if ch, ok := c.pending[string(id)]; ok {
+			delete(c.pending, string(id))
+			ch <- reply
+		}
+	}
+	if len(ids) == 0 && unmatched != nil {
+		return unmatched
+	}
+	return nil
+}
+
+// wait blocks until the response for id arrives.
+func (c *JSONRPCClient) wait(ctx context.Context, id json.RawMessage, ch chan jsonrpcReply) (json.RawMessage, error) {
+	select {
+	case reply := <-ch:
+		if reply.err != nil {
+			return nil, reply.err
+		}
+		if reply.resp.Error != nil {
+			return nil, reply.resp.Error
+		}
+		return reply.resp.Result, nil
+	case <-ctx.Done():
+		c.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+func (c *JSONRPCClient) forget(id json.RawMessage) {
+	c.mu.Lock()
+	delete(c.pending, string(id))
+	c.mu.Unlock()
+}
+
+// receive routes an incoming message: responses go to their waiting call,
+// notifications to OnNotification.
+func (c *JSONRPCClient) receive(msg []byte) {
+	if DetectBatch(msg) {
+		batch, err := SplitBatch(msg)
+		if err != nil {
+			log.Printf("JSONRPC client: dropping malformed batch: %v", err)
+			return
+		}
+		for _, m := range batch {
+			c.receive(m)
+		}
+		return
+	}
+
+	var envelope struct {
+		JSONRPCResponse
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		log.Printf("JSONRPC client: dropping malformed message: %v", err)
+		return
+	}
+	if envelope.Method != "" {
+		if len(envelope.ID) > 0 {
+			log.Printf("JSONRPC client: ignoring server request %s", envelope.Method)
+			return
+		}
+		if c.OnNotification != nil {
+			c.OnNotification(&JSONRPCRequest{JSONRPC: envelope.JSONRPC, Method: envelope.Method, Params: envelope.Params})
+		}
+		return
+	}
+
+	c.mu.Lock()
+	ch, ok := c.pending[string(envelope.ID)]
+	delete(c.pending, string(envelope.ID))
+	c.mu.Unlock()
+	if !ok {
+		log.Printf("JSONRPC client: response for unknown id %s", envelope.ID)
+		return
+	}
+	resp := envelope.JSONRPCResponse
+	ch <- jsonrpcReply{resp: &resp}
+}
+
+// fail ends every pending call with err and rejects new ones.
+func (c *JSONRPCClient) fail(err error) {
+	if err == nil {
+		err = ErrJSONRPCClosed
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	for id, ch := range c.pending {
+		ch <- jsonrpcReply{err: c.err}
+		delete(c.pending, id)
+	}
+}
+
+// ============================================================================
+// HTTP transport
+// ============================================================================
+
+// JSONRPCHTTPTransport sends each message as an HTTP POST. It accepts both
+// plain JSON responses and Streamable HTTP responses that arrive as an SSE
+// stream (notifications followed by the reply), and carries the
+// Mcp-Session-Id header returned by a Streamable server on later requests.
+type JSONRPCHTTPTransport struct {
+	// URL is the endpoint requests are POSTed to.
+	URL string
+
+	// Client performs the requests. Default: DefaultHttpClient. Streaming
+	// responses may need a client without a total Timeout.
+	Client *http.Client
+
+	// Auth, if set, adds credentials and retries on 401/403 via
+	// DoWithAuthRetry.
+	Auth *AuthRetryConfig
+
+	// Header is added to every request.
+	Header http.Header
+
+	mu      sync.Mutex
+	handle  func([]byte)
+	session string
+}
+
+// NewJSONRPCHTTPTransport creates an HTTP transport for url.
+func NewJSONRPCHTTPTransport(url string) *JSONRPCHTTPTransport {
+	return &JSONRPCHTTPTransport{URL: url}
+}
+
+func (t *JSONRPCHTTPTransport) repliesOnSend() {}
+
+// Receive implements JSONRPCTransport. done is never called; HTTP has no
+// connection to lose.
+func (t *JSONRPCHTTPTransport) Receive(handle func(msg []byte), done func(err error)) {
+	t.mu.Lock()
+	t.handle = handle
+	t.mu.Unlock()
+}
+
+// Close implements JSONRPCTransport.
+func (t *JSONRPCHTTPTransport) Close() error { return nil }
+
+// Send implements JSONRPCTransport. Non-2xx responses are returned as
+// *HTTPError (or *AuthRetryError for exhausted 401/403 retries). An error
+// reply with a null id, sent when the server could not tell which request
+// failed (e.g. a parse error), is returned as *JSONRPCError instead of
+// being handed to Receive.
+func (t *JSONRPCHTTPTransport) Send(ctx context.Context, msg []byte) error {
+	client := t.Client
+	if client == nil {
+		client = DefaultHttpClient
+	}
+	resp, err := DoWithAuthRetry(t.Auth, func() (*http.Request, error) {
+		req, err := NewBytesRequest(http.MethodPost, t.URL, msg)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		for name, values := range t.Header {
+			req.Header[name] = values
+		}
+		t.mu.Lock()
+		if t.session != "" {
+			req.Header.Set(MCPSessionHeader, t.session)
+		}
+		t.mu.Unlock()
+		return req, nil
+	}, client.Do)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxErrorBodySize))
+		return &HTTPError{Code: resp.StatusCode, Body: body, Header: resp.Header.Clone()}
+	}
+	if session := resp.Header.Get(MCPSessionHeader); session != "" {
+		t.mu.Lock()
+		t.session = session
+		t.mu.Unlock()
+	}
+	t.mu.Lock()
+	handle := t.handle
+	t.mu.Unlock()
+
+	var unmatched *JSONRPCError
+	var deliver func(msg []byte)
+	deliver = func(msg []byte) {
+		if DetectBatch(msg) {
+			if batch, err := SplitBatch(msg); err == nil {
+				for _, m := range batch {
+					deliver(m)
+				}
+				return
+			}
+		}
+		if rpcErr := nullIDError(msg); rpcErr != nil {
+			if unmatched == nil {
+				unmatched = rpcErr
+			}
+			return
+		}
+		if handle != nil {
+			handle(msg)
+		}
+	}
+	result := func() error {
+		if unmatched != nil {
+			return unmatched
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		reader := NewSSEEventReader(resp.Body)
+		for {
+			ev, err := reader.ReadEvent()
+			if ev.Data != "" {
+				deliver([]byte(ev.Data))
+			}
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return result()
+				}
+				return err
+			}
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		deliver(body)
+	}
+	return result()
+}
+
+// nullIDError returns the error of msg if it is an error response with a
+// null or missing id.
+func nullIDError(msg []byte) *JSONRPCError {
+	var resp JSONRPCResponse
+	if err := json.Unmarshal(msg, &resp); err != nil || resp.Error == nil {
+		return nil
+	}
+	if id := bytes.TrimSpace(resp.ID); len(id) > 0 && string(id) != "null" {
+		return nil
+	}
+	return resp.Error
+}
+
+// ============================================================================
+// WebSocket transport
+// ============================================================================
+
+// JSONRPCWSTransport exchanges messages over a WebSocket, one JSON-RPC
+// message per WebSocket text message.
+type JSONRPCWSTransport struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+// NewJSONRPCWSTransport wraps an established WebSocket connection, e.g.
+// from websocket.DefaultDialer.Dial.
+func NewJSONRPCWSTransport(conn *websocket.Conn) *JSONRPCWSTransport {
+	return &JSONRPCWSTransport{conn: conn}
+}
+
+// Receive implements JSONRPCTransport by starting the read loop.
+func (t *JSONRPCWSTransport) Receive(handle func(msg []byte), done func(err error)) {
+	go func() {
+		for {
+			_, msg, err := t.conn.ReadMessage()
+			if err != nil {
+				done(err)
+				return
+			}
+			handle(msg)
+		}
+	}()
+}
+
+// Send implements JSONRPCTransport.
+func (t *JSONRPCWSTransport) Send(ctx context.Context, msg []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		t.conn.SetWriteDeadline(deadline)
+		defer t.conn.SetWriteDeadline(time.Time{})
+	}
+	return t.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+// Close implements JSONRPCTransport.
+func (t *JSONRPCWSTransport) Close() error {
+	return t.conn.Close()
+}
+
+// ============================================================================
+// Framed stream transport
+// ============================================================================
+
+// JSONRPCStreamTransport exchanges Content-Length framed messages (see
+// WriteFrame and ReadFrame) over a byte stream, such as a language server's
+// or MCP server's stdin/stdout pipes.
+type JSONRPCStreamTransport struct {
+	reader  *bufio.Reader
+	writer  io.Writer
+	closer  io.Closer
+	writeMu sync.Mutex
+}
+
+// NewJSONRPCStreamTransport reads frames from r and writes frames to w.
+// Close closes whichever of r and w are io.Closers.
+//
+// Usage with a subprocess:
+//
+//	cmd := exec.Command("my-language-server")
+//	stdin, _ := cmd.StdinPipe()
+//	stdout, _ := cmd.StdoutPipe()
+//	cmd.Start()
+//	client := gohttp.NewJSONRPCClient(gohttp.NewJSONRPCStreamTransport(stdout, stdin))
+func NewJSONRPCStreamTransport(r io.Reader, w io.Writer) *JSONRPCStreamTransport {
+	return &JSONRPCStreamTransport{reader: bufio.NewReader(r), writer: w, closer: NewReadWriteCloser(r, w)}
+}
+
+// Receive implements JSONRPCTransport by starting the read loop.
+func (t *JSONRPCStreamTransport) Receive(handle func(msg []byte), done func(err error)) {
+	go func() {
+		for {
+			frame, err := ReadFrame(t.reader)
+			if err != nil {
+				done(err)
+				return
+			}
+			handle(frame)
+		}
+	}()
+}
+
+// Send implements JSONRPCTransport.
+func (t *JSONRPCStreamTransport) Send(ctx context.Context, msg []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return WriteFrame(t.writer, msg)
+}
+
+// Close implements JSONRPCTransport.
+func (t *JSONRPCStreamTransport) Close() error {
+	return t.closer.Close()
+}
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestJSONRPCClientHTTP verifies typed calls, errors, notifications and
+// batches over the plain HTTP transport.
+func TestJSONRPCClientHTTP(t *testing.T) {
+	server := httptest.NewServer(newTestJSONRPCServer())
+	defer server.Close()
+	client := NewJSONRPCClient(NewJSONRPCHTTPTransport(server.URL))
+	ctx := context.Background()
+
+	sum, err := JSONRPCCall[int](ctx, client, "add", []int{20, 22})
+	if err != nil || sum != 42 {
+		t.Fatalf("add = %d, %v", sum, err)
+	}
+
+	_, err = client.Call(ctx, "fail", nil)
+	var rpcErr *JSONRPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32001 || rpcErr.Data != "details" {
+		t.Errorf("fail error = %#v", err)
+	}
+
+	if err := client.Notify(ctx, "add", []int{1, 1}); err != nil {
+		t.Errorf("Notify: %v", err)
+	}
+
+	batch := client.NewBatch()
+	a := batch.Call("add", []int{1, 2})
+	b := batch.Call("nope", nil)
+	batch.Notify("add", []int{0, 0})
+	c := batch.Call("add", []int{3, 4})
+	if err := batch.Send(ctx); err != nil {
+		t.Fatalf("batch Send: %v", err)
+	}
+	if v, err := JSONRPCResult[int](a); err != nil || v != 3 {
+		t.Errorf("batch a = %d, %v", v, err)
+	}
+	if _, err := b.Result(); !errors.As(err, &rpcErr) || rpcErr.Code != JSONRPCMethodNotFound {
+		t.Errorf("batch b error = %v", err)
+	}
+	if v, err := JSONRPCResult[int](c); err != nil || v != 7 {
+		t.Errorf("batch c = %d, %v", v, err)
+	}
+}
+
+// TestJSONRPCClientHTTPNullIDError verifies that an error reply the server
+// could not attribute to a request (null id) fails the call with that
+// *JSONRPCError rather than ErrJSONRPCNoResponse.
+func TestJSONRPCClientHTTPNullIDError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`))
+	}))
+	defer server.Close()
+	client := NewJSONRPCClient(NewJSONRPCHTTPTransport(server.URL))
+
+	_, err := client.Call(context.Background(), "add", []int{1, 2})
+	var rpcErr *JSONRPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != JSONRPCParseError {
+		t.Errorf("Call error = %v, want parse error", err)
+	}
+	if err := client.Notify(context.Background(), "add", nil); !errors.As(err, &rpcErr) {
+		t.Errorf("Notify error = %v, want *JSONRPCError", err)
+	}
+}
+
+// TestJSONRPCClientStreamable verifies that notifications streamed as SSE
+// by a Streamable server reach OnNotification before the result, and that
+// the session header is carried across calls.
+func TestJSONRPCClientStreamable(t *testing.T) {
+	rpc := newTestJSONRPCServer()
+	Register(rpc, "whoami", func(ctx context.Context, _ struct{}) (string, error) {
+		return StreamableSessionID(ctx), nil
+	})
+	server := httptest.NewServer(StreamableServe(rpc.StreamableHandler(), &StreamableConfig{
+		Sessions: NewStreamableSessions(nil),
+	}))
+	defer server.Close()
+
+	client := NewJSONRPCClient(NewJSONRPCHTTPTransport(server.URL))
+	var mu sync.Mutex
+	var progress []string
+	client.OnNotification = func(n *JSONRPCRequest) {
+		mu.Lock()
+		progress = append(progress, n.Method+":"+string(n.Params))
+		mu.Unlock()
+	}
+
+	result, err := JSONRPCCall[string](context.Background(), client, "progress", 2)
+	if err != nil || result != "done" {
+		t.Fatalf("progress = %q, %v", result, err)
+	}
+	mu.Lock()
+	if strings.Join(progress, " ") != `progress:{"step":1} progress:{"step":2}` {
+		t.Errorf("notifications = %v", progress)
+	}
+	mu.Unlock()
+
+	first, err := JSONRPCCall[string](context.Background(), client, "whoami", nil)
+	if err != nil || first == "" {
+		t.Fatalf("whoami = %q, %v", first, err)
+	}
+	if second, _ := JSONRPCCall[string](context.Background(), client, "whoami", nil); second != first {
+		t.Errorf("session changed from %q to %q", first, second)
+	}
+}
+
+// TestJSONRPCClientWebSocket verifies out-of-order response correlation
+// over a WebSocket and that closing fails pending calls.
+func TestJSONRPCClientWebSocket(t *testing.T) {
+	rpc := newTestJSONRPCServer()
+	release := make(chan struct{})
+	Register(rpc, "slow", func(ctx context.Context, n int) (int, error) {
+		<-release
+		return n, nil
+	})
+	Register(rpc, "hang", func(ctx context.Context, _ struct{}) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	server := httptest.NewServer(WSServe(&JSONRPCWSHandler{Server: rpc}, nil))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewJSONRPCClient(NewJSONRPCWSTransport(ws))
+	ctx := context.Background()
+
+	slow := make(chan int, 1)
+	go func() {
+		v, _ := JSONRPCCall[int](ctx, client, "slow", 1)
+		slow <- v
+	}()
+	if v, err := JSONRPCCall[int](ctx, client, "add", []int{2, 3}); err != nil || v != 5 {
+		t.Fatalf("add while slow pending = %d, %v", v, err)
+	}
+	close(release)
+	if v := <-slow; v != 1 {
+		t.Errorf("slow = %d", v)
+	}
+
+	hung := make(chan error, 1)
+	go func() {
+		_, err := client.Call(ctx, "hang", nil)
+		hung <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	client.Close()
+	select {
+	case err := <-hung:
+		if err == nil {
+			t.Error("pending call succeeded after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending call not failed by Close")
+	}
+	if _, err := client.Call(ctx, "add", []int{1, 1}); err == nil {
+		t.Error("call after Close succeeded")
+	}
+}
+
+// TestJSONRPCClientStream verifies the framed stream transport against
+// ServeStream over a pair of pipes.
+func TestJSONRPCClientStream(t *testing.T) {
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- newTestJSONRPCServer().ServeStream(context.Background(), serverRead, serverWrite)
+		serverWrite.Close()
+	}()
+
+	client := NewJSONRPCClient(NewJSONRPCStreamTransport(clientRead, clientWrite))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if v, err := JSONRPCCall[int](ctx, client, "add", []int{5, 6}); err != nil || v != 11 {
+		t.Fatalf("add = %d, %v", v, err)
+	}
+
+	client.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("ServeStream: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeStream did not return after client closed")
+	}
+}
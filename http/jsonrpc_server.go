@@ -0,0 +1,547 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// JSONRPCHandlerFunc handles one JSON-RPC call. The returned value is
+// marshaled as the result. Returning a *JSONRPCError sends that error
+// object; any other error becomes an internal error (-32603) with the
+// error's text as the message.
+//
+// For notifications the result is discarded.
+type JSONRPCHandlerFunc func(ctx context.Context, req *JSONRPCRequest) (any, error)
+
+// JSONRPCMiddleware wraps a JSONRPCHandlerFunc, e.g. for logging, auth or
+// metrics. Middleware added first with Use runs outermost.
+type JSONRPCMiddleware func(next JSONRPCHandlerFunc) JSONRPCHandlerFunc
+
+// ErrNoJSONRPCNotifier is returned by JSONRPCNotify when the transport
+// serving the call cannot deliver server-to-client notifications.
+var ErrNoJSONRPCNotifier = errors.New("jsonrpc: transport does not support notifications")
+
+// defaultJSONRPCMaxBodySize caps request bodies read by the HTTP adapters.
+const defaultJSONRPCMaxBodySize = 4 << 20
+
+// JSONRPCServer dispatches JSON-RPC 2.0 requests to registered methods.
+// It handles single requests, notifications and batches (whose elements
+// run in parallel), and maps failures to the standard error codes.
+//
+// One server can be exposed over several transports at once:
+//   - plain HTTP POST: the server is an http.Handler
+//   - Streamable HTTP: StreamableHandler, with progress notifications
+//     streamed as SSE events
+//   - WebSocket: JSONRPCWSHandler with WSServe
+//   - LSP-framed byte streams (stdio, pipes): ServeStream
+//
+// Usage:
+//
+//	rpc := gohttp.NewJSONRPCServer()
+//	gohttp.Register(rpc, "add", func(ctx context.Context, p [2]int) (int, error) {
+//	    return p[0] + p[1], nil
+//	})
+//	router.Handle("/rpc", rpc)
+type JSONRPCServer struct {
+	// BatchConcurrency limits how many elements of a batch run at once.
+	// Default (0): all of them.
+	BatchConcurrency int
+
+	// MaxBodySize caps the size of request bodies read by the HTTP
+	// adapters. Default: 4 MB.
+	MaxBodySize int64
+
+	mu         sync.RWMutex
+	methods    map[string]JSONRPCHandlerFunc
+	middleware []JSONRPCMiddleware
+}
+
+// NewJSONRPCServer creates a server with no methods registered.
+func NewJSONRPCServer() *JSONRPCServer {
+	return &JSONRPCServer{methods: make(map[string]JSONRPCHandlerFunc)}
+}
+
+// Handle registers an untyped handler for method, replacing any previous
+// one. Most callers should use Register instead.
+func (s *JSONRPCServer) Handle(method string, handler JSONRPCHandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.methods == nil {
+		s.methods = make(map[string]JSONRPCHandlerFunc)
+	}
+	s.methods[method] = handler
+}
+
+// Use appends middleware applied to every method call.
+func (s *JSONRPCServer) Use(middleware ...JSONRPCMiddleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// Register adds a typed method to s. Params are decoded from the request's
+// "params" member (absent params leave P as its zero value); a decoding
+// failure is reported as invalid params (-32602). The result is marshaled
+// as JSON.
+func Register[P any, R any](s *JSONRPCServer, method string, fn func(ctx context.Context, params P) (R, error)) {
+	s.Handle(method, func(ctx context.Context, req *JSONRPCRequest) (any, error) {
+		var params P
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: "invalid params: " + err.Error()}
+			}
+		}
+		return fn(ctx, params)
+	})
+}
+
+// HandleMessage processes one raw message, a single request or a batch,
+// and returns the encoded response. It returns false when there is nothing
+// to send back (a notification, or a batch of only notifications).
+func (s *JSONRPCServer) HandleMessage(ctx context.Context, data []byte) ([]byte, bool) {
+	if DetectBatch(data) {
+		return s.handleBatch(ctx, data)
+	}
+	resp := s.handleOne(ctx, data)
+	if resp == nil {
+		return nil, false
+	}
+	out, err := json.Marshal(resp)
+	if err != nil {
+		out, _ = json.Marshal(errorResponse(resp.ID, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}))
+	}
+	return out, true
+}
+
+// Dispatch runs a decoded request through the middleware chain and the
+// registered method. It returns nil for notifications.
+func (s *JSONRPCServer) Dispatch(ctx context.Context, req *JSONRPCRequest) *JSONRPCResponse {
+	if req.JSONRPC != JSONRPCVersion || req.Method == "" {
+		if req.IsNotification() {
+			return nil
+		}
+		return errorResponse(req.ID, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "invalid request"})
+	}
+
+	s.mu.RLock()
+	handler, ok := s.methods[req.Method]
+	middleware := s.middleware
+	s.mu.RUnlock()
+	if !ok {
+		handler = func(context.Context, *JSONRPCRequest) (any, error) {
+			return nil, &JSONRPCError{Code: JSONRPCMethodNotFound, Message: "method not found: " + req.Method}
+		}
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	result, err := s.call(ctx, handler, req)
+	if req.IsNotification() {
+		if err != nil {
+			log.Printf("JSONRPC: notification %s failed: %v", req.Method, err)
+		}
+		return nil
+	}
+	if err != nil {
+		var rpcErr *JSONRPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}
+		}
+		return errorResponse(req.ID, rpcErr)
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, &JSONRPCError{Code: JSONRPCInternalError, Message: "failed to encode result: " + err.Error()})
+	}
+	return &JSONRPCResponse{JSONRPC: JSONRPCVersion, ID: req.ID, Result: encoded}
+}
+
+// call invokes handler, turning a panic into an internal error so one bad
+// method cannot take down a connection or a whole batch.
+func (s *JSONRPCServer) call(ctx context.Context, handler JSONRPCHandlerFunc, req *JSONRPCRequest) (result any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("JSONRPC: panic in %s: %v", req.Method, p)
+			err = &JSONRPCError{Code: JSONRPCInternalError, Message: "internal error"}
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// handleOne decodes and dispatches a single request.
+func (s *JSONRPCServer) handleOne(ctx context.Context, data []byte) *JSONRPCResponse {
+	var req JSONRPCRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return errorResponse(nil, &JSONRPCError{Code: JSONRPCParseError, Message: "parse error: " + err.Error()})
+		}
+		// Valid JSON of the wrong shape, e.g. a number or a bad "id".
+		return errorResponse(nil, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "invalid request"})
+	}
+	return s.Dispatch(ctx, &req)
+}
+
+// handleBatch dispatches the elements of a batch in parallel and collects
+// the responses, in request order, into a single array.
+func (s *JSONRPCServer) handleBatch(ctx context.Context, data []byte) ([]byte, bool) {
+	batch, err := SplitBatch(data)
+	if err != nil {
+		out, _ := json.Marshal(errorResponse(nil, &JSONRPCError{Code: JSONRPCParseError, Message: err.Error()}))
+		return out, true
+	}
+	if len(batch) == 0 {
+		out, _ := json.Marshal(errorResponse(nil, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "empty batch"}))
+		return out, true
+	}
+
+	responses := make([]*JSONRPCResponse, len(batch))
+	limit := s.BatchConcurrency
+	if limit <= 0 || limit > len(batch) {
+		limit = len(batch)
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, raw := range batch {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			responses[i] = s.handleOne(ctx, raw)
+		}()
+	}
+	wg.Wait()
+
+	out := make([]*JSONRPCResponse, 0, len(responses))
+	for _, resp := range responses {
+		if resp != nil {
+			out = append(out, resp)
+		}
+	}
+	if len(out) == 0 {
+		return nil, false
+	}
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		encoded, _ = json.Marshal(errorResponse(nil, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}))
+	}
+	return encoded, true
+}
+
+func errorResponse(id json.RawMessage, err *JSONRPCError) *JSONRPCResponse {
+	return &JSONRPCResponse{JSONRPC: JSONRPCVersion, ID: id, Error: err}
+}
+
+// ============================================================================
+// Server-to-client notifications
+// ============================================================================
+
+// JSONRPCNotifier delivers an encoded notification to the client of the
+// call being handled. Transports install one in the call's context.
+type JSONRPCNotifier func(notification []byte) error
+
+type jsonrpcNotifierKey struct{}
+
+// WithJSONRPCNotifier returns a context whose JSONRPCNotify calls are
+// delivered by notify. Transport adapters use it; custom transports can
+// too.
+func WithJSONRPCNotifier(ctx context.Context, notify JSONRPCNotifier) context.Context {
+	return context.WithValue(ctx, jsonrpcNotifierKey{}, notify)
+}
+
+// JSONRPCNotify sends a notification (e.g. progress) to the client of the
+// call being handled. Returns ErrNoJSONRPCNotifier when the transport has
+// no way to deliver it, such as plain HTTP or a Streamable client that
+// does not accept SSE.
+func JSONRPCNotify(ctx context.Context, method string, params any) error {
+	notify, _ := ctx.Value(jsonrpcNotifierKey{}).(JSONRPCNotifier)
+	if notify == nil {
+		return ErrNoJSONRPCNotifier
+	}
+	req := JSONRPCRequest{JSONRPC: JSONRPCVersion, Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("jsonrpc: encoding notification params: %w", err)
+		}
+		req.Params = encoded
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return notify(data)
+}
+
+// ============================================================================
+// HTTP adapters
+// ============================================================================
+
+// ServeHTTP serves JSON-RPC over plain HTTP POST: the body is a request or
+// batch and the response body is the result. Requests made only of
+// notifications get 204 No Content. JSON-RPC errors are sent with status
+// 200, as they are part of the protocol rather than the transport.
+func (s *JSONRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	out, ok := s.HandleMessage(r.Context(), body)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// StreamableHandler adapts the server to StreamableServe. A call that
+// completes without sending notifications gets a single JSON response.
+// Once a method sends a notification with JSONRPCNotify, and the client
+// accepts SSE, the response switches to an SSE stream: the notification
+// and any later ones are sent as events, followed by the final response.
+// Requests made only of notifications get 202 Accepted, as in the MCP
+// Streamable HTTP transport.
+//
+// Usage:
+//
+//	router.HandleFunc("/mcp", gohttp.StreamableServe(rpc.StreamableHandler(), nil))
+func (s *JSONRPCServer) StreamableHandler() StreamableHandlerFunc {
+	return func(ctx context.Context, r *http.Request) StreamableResponse {
+		body, err := io.ReadAll(io.LimitReader(r.Body, s.maxBodySize()+1))
+		if err != nil {
+			return SingleResponse{StatusCode: http.StatusBadRequest, Body: errorResponse(nil, &JSONRPCError{Code: JSONRPCParseError, Message: "failed to read body"})}
+		}
+		if int64(len(body)) > s.maxBodySize() {
+			return SingleResponse{StatusCode: http.StatusRequestEntityTooLarge, Body: errorResponse(nil, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "request too large"})}
+		}
+
+		type outcome struct {
+			data []byte
+			ok   bool
+		}
+		done := make(chan outcome, 1)
+		events := make(chan SSEEvent)
+		if _, acceptsSSE := ParseAcceptTypes(r.Header.Get("Accept")); acceptsSSE {
+			ctx = WithJSONRPCNotifier(ctx, func(n []byte) error {
+				select {
+				case events <- SSEEvent{Event: "message", Data: json.RawMessage(n)}:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}
+		go func() {
+			data, ok := s.HandleMessage(ctx, body)
+			done <- outcome{data, ok}
+		}()
+
+		select {
+		case res := <-done:
+			if !res.ok {
+				return SingleResponse{StatusCode: http.StatusAccepted}
+			}
+			return SingleResponse{Body: json.RawMessage(res.data)}
+		case first := <-events:
+			stream := make(chan SSEEvent)
+			go func() {
+				defer close(stream)
+				send := func(ev SSEEvent) bool {
+					select {
+					case stream <- ev:
+						return true
+					case <-ctx.Done():
+						return false
+					}
+				}
+				if !send(first) {
+					return
+				}
+				for {
+					select {
+					case ev := <-events:
+						if !send(ev) {
+							return
+						}
+					case res := <-done:
+						if res.ok {
+							send(SSEEvent{Event: "message", Data: json.RawMessage(res.data)})
+						}
+						return
+					}
+				}
+			}()
+			return StreamResponse{Events: stream}
+		}
+	}
+}
+
+func (s *JSONRPCServer) maxBodySize() int64 {
+	if s.MaxBodySize <= 0 {
+		return defaultJSONRPCMaxBodySize
+	}
+	return s.MaxBodySize
+}
+
+func (s *JSONRPCServer) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodySize()))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "failed to read request", http.StatusBadRequest)
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+// ============================================================================
+// WebSocket adapter
+// ============================================================================
+
+// JSONRPCConn serves JSON-RPC over a WebSocket, one message per request or
+// batch. Calls run concurrently, so a slow method does not block the
+// connection; responses and notifications go through the connection's
+// serialized Writer. The context passed to methods is cancelled when the
+// connection closes.
+type JSONRPCConn struct {
+	BaseConn[json.RawMessage, json.RawMessage]
+	Server *JSONRPCServer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewJSONRPCConn creates a WebSocket connection that dispatches to server.
+func NewJSONRPCConn(server *JSONRPCServer) *JSONRPCConn {
+	return &JSONRPCConn{
+		BaseConn: BaseConn[json.RawMessage, json.RawMessage]{
+			Codec:   &TypedJSONCodec[json.RawMessage, json.RawMessage]{},
+			NameStr: "JSONRPCConn",
+		},
+		Server: server,
+	}
+}
+
+// OnStart creates the context shared by this connection's calls.
+func (c *JSONRPCConn) OnStart(conn *websocket.Conn) error {
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c.BaseConn.OnStart(conn)
+}
+
+// HandleMessage dispatches a request or batch in its own goroutine.
+func (c *JSONRPCConn) HandleMessage(msg json.RawMessage) error {
+	ctx := WithJSONRPCNotifier(c.ctx, func(n []byte) error {
+		c.SendOutput(n)
+		return nil
+	})
+	go func() {
+		if out, ok := c.Server.HandleMessage(ctx, msg); ok {
+			c.SendOutput(out)
+		}
+	}()
+	return nil
+}
+
+// OnClose cancels in-flight calls and stops the writer.
+func (c *JSONRPCConn) OnClose() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.BaseConn.OnClose()
+}
+
+// JSONRPCWSHandler creates a JSONRPCConn for every WebSocket connection.
+//
+// Usage:
+//
+//	router.HandleFunc("/rpc/ws", gohttp.WSServe(&gohttp.JSONRPCWSHandler{Server: rpc}, nil))
+type JSONRPCWSHandler struct {
+	Server *JSONRPCServer
+}
+
+// Validate implements WSHandler. Accepts all connections; wrap it to add
+// authentication.
+func (h *JSONRPCWSHandler) Validate(w http.ResponseWriter, r *http.Request) (*JSONRPCConn, bool) {
+	return NewJSONRPCConn(h.Server), true
+}
+
+// ============================================================================
+// LSP-framed stream adapter
+// ============================================================================
+
+// ServeStream serves JSON-RPC over a Content-Length framed byte stream, as
+// used by LSP and the MCP stdio transport. Each frame is a request or
+// batch; calls run concurrently and responses are written as frames, one
+// at a time. It returns nil when r reaches EOF (after in-flight calls have
+// finished), or the first read or write error, cancelling the context of
+// any calls still running.
+//
+// Usage:
+//
+//	err := rpc.ServeStream(ctx, os.Stdin, os.Stdout)
+func (s *JSONRPCServer) ServeStream(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var writeMu sync.Mutex
+	var writeErr error
+	write := func(data []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if writeErr != nil {
+			return writeErr
+		}
+		if err := WriteFrame(w, data); err != nil {
+			writeErr = err
+			cancel()
+		}
+		return writeErr
+	}
+	ctx = WithJSONRPCNotifier(ctx, write)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	reader := bufio.NewReader(r)
+	for {
+		frame, err := ReadFrame(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				wg.Wait()
+				writeMu.Lock()
+				defer writeMu.Unlock()
+				return writeErr
+			}
+			// Cancel before the deferred Wait so in-flight calls stop
+			// instead of holding the error until they finish.
+			cancel()
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, ok := s.HandleMessage(ctx, frame); ok {
+				write(out)
+			}
+		}()
+	}
+}
@@ -0,0 +1,338 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestJSONRPCServer registers a few methods used across the tests.
+func newTestJSONRPCServer() *JSONRPCServer {
+	rpc := NewJSONRPCServer()
+	Register(rpc, "add", func(ctx context.Context, p [2]int) (int, error) {
+		return p[0] + p[1], nil
+	})
+	Register(rpc, "fail", func(ctx context.Context, p struct{}) (any, error) {
+		return nil, &JSONRPCError{Code: -32001, Message: "custom failure", Data: "details"}
+	})
+	Register(rpc, "boom", func(ctx context.Context, p struct{}) (any, error) {
+		return nil, errors.New("plain error")
+	})
+	Register(rpc, "panic", func(ctx context.Context, p struct{}) (any, error) {
+		panic("oops")
+	})
+	Register(rpc, "progress", func(ctx context.Context, steps int) (string, error) {
+		for i := 1; i <= steps; i++ {
+			if err := JSONRPCNotify(ctx, "progress", map[string]int{"step": i}); err != nil {
+				return "", err
+			}
+		}
+		return "done", nil
+	})
+	return rpc
+}
+
+func handleJSON(t *testing.T, rpc *JSONRPCServer, body string) (string, bool) {
+	t.Helper()
+	out, ok := rpc.HandleMessage(context.Background(), []byte(body))
+	return string(out), ok
+}
+
+// TestJSONRPCServerDispatch verifies results, notifications and the
+// standard error codes for single requests.
+func TestJSONRPCServerDispatch(t *testing.T) {
+	rpc := newTestJSONRPCServer()
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"result", `{"jsonrpc":"2.0","id":1,"method":"add","params":[2,3]}`, `{"jsonrpc":"2.0","id":1,"result":5}`},
+		{"string id", `{"jsonrpc":"2.0","id":"a","method":"add","params":[1,1]}`, `{"jsonrpc":"2.0","id":"a","result":2}`},
+		{"parse error", `{"jsonrpc":`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error: unexpected end of JSON input"}}`},
+		{"invalid request", `{"jsonrpc":"1.0","id":1,"method":"add"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32600,"message":"invalid request"}}`},
+		{"not found", `{"jsonrpc":"2.0","id":1,"method":"nope"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found: nope"}}`},
+		{"invalid params", `{"jsonrpc":"2.0","id":1,"method":"add","params":{"a":1}}`, ``},
+		{"custom error", `{"jsonrpc":"2.0","id":1,"method":"fail"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"custom failure","data":"details"}}`},
+		{"plain error", `{"jsonrpc":"2.0","id":1,"method":"boom"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"plain error"}}`},
+		{"panic", `{"jsonrpc":"2.0","id":1,"method":"panic"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"internal error"}}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := handleJSON(t, rpc, tc.body)
+			if !ok {
+				t.Fatal("expected a response")
+			}
+			if tc.want == "" {
+				var resp JSONRPCResponse
+				json.Unmarshal([]byte(got), &resp)
+				if resp.Error == nil || resp.Error.Code != JSONRPCInvalidParams {
+					t.Errorf("got %s, want invalid params", got)
+				}
+				return
+			}
+			if got != tc.want {
+				t.Errorf("got  %s\nwant %s", got, tc.want)
+			}
+		})
+	}
+
+	if out, ok := handleJSON(t, rpc, `{"jsonrpc":"2.0","method":"add","params":[1,2]}`); ok {
+		t.Errorf("notification got response %s", out)
+	}
+}
+
+// TestJSONRPCServerBatch verifies that batch elements run in parallel,
+// responses keep request order, notifications are omitted, and edge cases
+// follow the spec.
+func TestJSONRPCServerBatch(t *testing.T) {
+	rpc := NewJSONRPCServer()
+	var inFlight, peak atomic.Int32
+	Register(rpc, "slow", func(ctx context.Context, n int) (int, error) {
+		cur := inFlight.Add(1)
+		for {
+			old := peak.Load()
+			if cur <= old || peak.CompareAndSwap(old, cur) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		inFlight.Add(-1)
+		return n, nil
+	})
+
+	got, ok := handleJSON(t, rpc, `[
+		{"jsonrpc":"2.0","id":1,"method":"slow","params":1},
+		{"jsonrpc":"2.0","method":"slow","params":2},
+		{"jsonrpc":"2.0","id":3,"method":"slow","params":3},
+		1
+	]`)
+	if !ok {
+		t.Fatal("expected a batch response")
+	}
+	want := `[{"jsonrpc":"2.0","id":1,"result":1},{"jsonrpc":"2.0","id":3,"result":3},{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}]`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if peak.Load() < 2 {
+		t.Errorf("peak concurrency = %d, want batch elements to run in parallel", peak.Load())
+	}
+
+	if got, _ := handleJSON(t, rpc, `[]`); !strings.Contains(got, `"code":-32600`) {
+		t.Errorf("empty batch = %s, want invalid request", got)
+	}
+	if out, ok := handleJSON(t, rpc, `[{"jsonrpc":"2.0","method":"slow","params":1}]`); ok {
+		t.Errorf("notification-only batch got response %s", out)
+	}
+
+	rpc.BatchConcurrency = 1
+	peak.Store(0)
+	handleJSON(t, rpc, `[{"jsonrpc":"2.0","id":1,"method":"slow"},{"jsonrpc":"2.0","id":2,"method":"slow"}]`)
+	if peak.Load() != 1 {
+		t.Errorf("peak concurrency with limit 1 = %d", peak.Load())
+	}
+}
+
+// TestJSONRPCServerMiddleware verifies middleware order and that it can
+// short-circuit calls.
+func TestJSONRPCServerMiddleware(t *testing.T) {
+	rpc := newTestJSONRPCServer()
+	var order []string
+	trace := func(name string) JSONRPCMiddleware {
+		return func(next JSONRPCHandlerFunc) JSONRPCHandlerFunc {
+			return func(ctx context.Context, req *JSONRPCRequest) (any, error) {
+				order = append(order, name)
+				return next(ctx, req)
+			}
+		}
+	}
+	rpc.Use(trace("outer"), trace("inner"))
+	rpc.Use(func(next JSONRPCHandlerFunc) JSONRPCHandlerFunc {
+		return func(ctx context.Context, req *JSONRPCRequest) (any, error) {
+			if req.Method == "fail" {
+				return nil, NewJSONRPCError(-32003, "forbidden")
+			}
+			return next(ctx, req)
+		}
+	})
+
+	if got, _ := handleJSON(t, rpc, `{"jsonrpc":"2.0","id":1,"method":"add","params":[1,2]}`); got != `{"jsonrpc":"2.0","id":1,"result":3}` {
+		t.Errorf("add = %s", got)
+	}
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("middleware order = %v", order)
+	}
+	if got, _ := handleJSON(t, rpc, `{"jsonrpc":"2.0","id":1,"method":"fail"}`); !strings.Contains(got, `"code":-32003`) {
+		t.Errorf("short-circuited call = %s", got)
+	}
+}
+
+// TestJSONRPCServerHTTP verifies the plain HTTP adapter.
+func TestJSONRPCServerHTTP(t *testing.T) {
+	server := httptest.NewServer(newTestJSONRPCServer())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"add","params":[4,5]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" || string(body) != `{"jsonrpc":"2.0","id":7,"result":9}` {
+		t.Errorf("POST = %d %q %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, _ = http.Post(server.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","method":"add"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("notification status = %d, want 204", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(server.URL)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want 405", resp.StatusCode)
+	}
+}
+
+// TestJSONRPCServerStreamable verifies that calls without notifications get
+// a JSON response, calls that send notifications switch to SSE, and
+// clients that do not accept SSE still get the final result.
+func TestJSONRPCServerStreamable(t *testing.T) {
+	server := httptest.NewServer(StreamableServe(newTestJSONRPCServer().StreamableHandler(), nil))
+	defer server.Close()
+
+	post := func(body, accept string) *http.Response {
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader(body))
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	both := "application/json, text/event-stream"
+
+	resp := post(`{"jsonrpc":"2.0","id":1,"method":"add","params":[1,2]}`, both)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/json" || strings.TrimSpace(string(body)) != `{"jsonrpc":"2.0","id":1,"result":3}` {
+		t.Errorf("quick call = %q %s", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp = post(`{"jsonrpc":"2.0","id":2,"method":"progress","params":2}`, both)
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("progress Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+	for _, want := range []string{
+		`{"jsonrpc":"2.0","method":"progress","params":{"step":1}}`,
+		`{"jsonrpc":"2.0","method":"progress","params":{"step":2}}`,
+		`{"jsonrpc":"2.0","id":2,"result":"done"}`,
+	} {
+		ev, err := readSSEEvent(t, reader, 2*time.Second)
+		if err != nil || ev.Data != want {
+			t.Fatalf("event = %+v, %v; want %s", ev, err, want)
+		}
+	}
+
+	resp = post(`{"jsonrpc":"2.0","id":3,"method":"progress","params":1}`, "application/json")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"code":-32603`) {
+		t.Errorf("progress without SSE = %s, want notifier error", body)
+	}
+
+	resp = post(`{"jsonrpc":"2.0","method":"add"}`, both)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("notification status = %d, want 202", resp.StatusCode)
+	}
+}
+
+// TestJSONRPCServerWebSocket verifies the WebSocket adapter, including
+// notifications sent during a call.
+func TestJSONRPCServerWebSocket(t *testing.T) {
+	server := httptest.NewServer(WSServe(&JSONRPCWSHandler{Server: newTestJSONRPCServer()}, nil))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"progress","params":1}`))
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, want := range []string{
+		`{"jsonrpc":"2.0","method":"progress","params":{"step":1}}`,
+		`{"jsonrpc":"2.0","id":1,"result":"done"}`,
+	} {
+		_, msg, err := ws.ReadMessage()
+		if err != nil || string(msg) != want {
+			t.Fatalf("message = %s, %v; want %s", msg, err, want)
+		}
+	}
+}
+
+// TestJSONRPCServerStream verifies the LSP-framed stream adapter.
+func TestJSONRPCServerStream(t *testing.T) {
+	var in strings.Builder
+	WriteFrame(&in, []byte(`{"jsonrpc":"2.0","id":1,"method":"add","params":[2,2]}`))
+	WriteFrame(&in, []byte(`{"jsonrpc":"2.0","method":"add"}`))
+
+	var out strings.Builder
+	if err := newTestJSONRPCServer().ServeStream(context.Background(), strings.NewReader(in.String()), &out); err != nil {
+		t.Fatalf("ServeStream: %v", err)
+	}
+	frame, err := ReadFrame(bufio.NewReader(strings.NewReader(out.String())))
+	if err != nil || string(frame) != `{"jsonrpc":"2.0","id":1,"result":4}` {
+		t.Errorf("frame = %s, %v", frame, err)
+	}
+	if !strings.HasSuffix(out.String(), `"result":4}`) {
+		t.Errorf("unexpected extra output: %q", out.String())
+	}
+}
+
+// TestJSONRPCServerStreamReadError verifies that a read error cancels
+// in-flight calls instead of waiting for them to finish.
+func TestJSONRPCServerStreamReadError(t *testing.T) {
+	rpc := newTestJSONRPCServer()
+	started := make(chan struct{})
+	Register(rpc, "block", func(ctx context.Context, p struct{}) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	var in strings.Builder
+	WriteFrame(&in, []byte(`{"jsonrpc":"2.0","id":1,"method":"block"}`))
+	readErr := errors.New("read failed")
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte(in.String()))
+		<-started
+		pw.CloseWithError(readErr)
+	}()
+
+	served := make(chan error, 1)
+	go func() { served <- rpc.ServeStream(context.Background(), pr, io.Discard) }()
+	select {
+	case err := <-served:
+		if !errors.Is(err, readErr) {
+			t.Errorf("err = %v, want %v", err, readErr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeStream blocked on an in-flight call after a read error")
+	}
+}
@@ -0,0 +1,618 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProtectedResourceMetadata is the OAuth 2.0 Protected Resource Metadata
+// document (RFC 9728 §2) a resource server publishes so clients can find
+// the authorization servers that issue tokens for it.
+type ProtectedResourceMetadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers,omitempty"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported,omitempty"`
+	ResourceName           string   `json:"resource_name,omitempty"`
+}
+
+// AuthorizationServerMetadata is the OAuth 2.0 Authorization Server
+// Metadata document (RFC 8414 §2). Only the fields used by clients here
+// are listed.
+type AuthorizationServerMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+}
+
+// OAuthToken is an access token issued by a token endpoint.
+type OAuthToken struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	// Expiry is when the access token expires; zero if the server did not
+	// say.
+	Expiry time.Time
+	// Scopes are the granted scopes, or the requested ones if the server
+	// did not list them (RFC 6749 §5.1).
+	Scopes []string
+}
+
+// expired reports whether the token expires within delta of now.
+func (t *OAuthToken) expired(now time.Time, delta time.Duration) bool {
+	return !t.Expiry.IsZero() && now.Add(delta).After(t.Expiry)
+}
+
+// OAuthError is an error response from a token endpoint (RFC 6749 §5.2).
+type OAuthError struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	URI         string `json:"error_uri,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth error %s: %s", e.Code, e.Description)
+	}
+	return "oauth error " + e.Code
+}
+
+// ProtectedResourceMetadataURL returns the well-known metadata URL for a
+// resource URL (RFC 9728 §3.1): the well-known path is inserted between the
+// host and the resource path. Query and fragment are dropped.
+func ProtectedResourceMetadataURL(resource string) (string, error) {
+	return wellKnownURL(resource, "oauth-protected-resource")
+}
+
+func wellKnownURL(base, name string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("oauth: %q is not an absolute URL", base)
+	}
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+	return u.Scheme + "://" + u.Host + "/.well-known/" + name + path, nil
+}
+
+// FetchProtectedResourceMetadata fetches and validates the metadata at
+// metadataURL. If resource is non-empty, the document's resource must
+// identify it or a parent of it: same scheme and host, and a path that is
+// equal or ends at a "/" boundary (RFC 9728 §3.3). This stops a server
+// from claiming another origin's resource, and with it that resource's
+// tokens.
+func FetchProtectedResourceMetadata(ctx context.Context, client *http.Client, metadataURL, resource string) (*ProtectedResourceMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ContentTypeJSON)
+	meta, err := Call[*ProtectedResourceMetadata](ctx, req, WithClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("oauth: fetching resource metadata: %w", err)
+	}
+	if meta == nil || meta.Resource == "" {
+		return nil, errors.New("oauth: resource metadata has no resource")
+	}
+	if resource != "" && !resourceContains(meta.Resource, resource) {
+		return nil, fmt.Errorf("oauth: resource metadata is for %q, not %q", meta.Resource, resource)
+	}
+	return meta, nil
+}
+
+// resourceContains reports whether the resource identifier resource
+// covers target: the same scheme and host, and a path equal to or under
+// resource's path.
+func resourceContains(resource, target string) bool {
+	r, err := url.Parse(resource)
+	if err != nil {
+		return false
+	}
+	t, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(r.Scheme, t.Scheme) || !strings.EqualFold(r.Host, t.Host) {
+		return false
+	}
+	base := strings.TrimSuffix(r.EscapedPath(), "/")
+	path := t.EscapedPath()
+	return base == "" || path == base || strings.HasPrefix(path, base+"/")
+}
+
+// DiscoverAuthorizationServer fetches the RFC 8414 metadata of issuer,
+// falling back to OpenID Connect discovery, and checks that the document
+// names the same issuer (RFC 8414 §3.3).
+func DiscoverAuthorizationServer(ctx context.Context, client *http.Client, issuer string) (*AuthorizationServerMetadata, error) {
+	var lastErr error
+	for _, name := range []string{"oauth-authorization-server", "openid-configuration"} {
+		metadataURL, err := wellKnownURL(issuer, name)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", ContentTypeJSON)
+		meta, err := Call[*AuthorizationServerMetadata](ctx, req, WithClient(client))
+		if err != nil {
+			lastErr = err
+			if HTTPErrorCode(err) == http.StatusNotFound {
+				continue
+			}
+			break
+		}
+		if meta == nil || strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+			return nil, fmt.Errorf("oauth: metadata issuer does not match %q", issuer)
+		}
+		if meta.TokenEndpoint == "" {
+			return nil, errors.New("oauth: authorization server has no token endpoint")
+		}
+		return meta, nil
+	}
+	return nil, fmt.Errorf("oauth: discovering authorization server %s: %w", issuer, lastErr)
+}
+
+// OAuthClient acquires and caches access tokens for protected resources,
+// discovering where to get them from the resources themselves.
+//
+// On a 401 it reads the resource_metadata URL from WWW-Authenticate (or
+// derives the well-known URL), fetches the RFC 9728 metadata, discovers the
+// authorization server (RFC 8414) and obtains a token with a refresh-token
+// grant if it holds one, else a client-credentials grant. On a 403
+// insufficient_scope it requests a new token with the union of the held
+// and required scopes. Tokens are cached per resource and refreshed ahead
+// of expiry.
+//
+// Usage:
+//
+//	oauth := &gohttp.OAuthClient{ClientID: "svc", ClientSecret: secret}
+//	transport := gohttp.NewJSONRPCHTTPTransport(url)
+//	transport.Auth = oauth.AuthRetryConfig()
+type OAuthClient struct {
+	ClientID     string
+	ClientSecret string
+
+	// Scopes are requested when the challenge names none.
+	Scopes []string
+
+	// HTTPClient is used for metadata and token requests. Default:
+	// DefaultHttpClient.
+	HTTPClient *http.Client
+
+	// ExpiryDelta refreshes tokens this long before they expire.
+	// Default: 30s.
+	ExpiryDelta time.Duration
+
+	// mu guards the maps and each resource's token. Network requests run
+	// outside it, one per key at a time (see single).
+	mu        sync.Mutex
+	resources map[string]*oauthResource // by resource identifier
+	flights   map[string]*oauthFlight   // running discovery and token requests
+	now       func() time.Time
+}
+
+type oauthResource struct {
+	resource string
+	server   *AuthorizationServerMetadata
+	token    *OAuthToken // guarded by OAuthClient.mu
+}
+
+// oauthFlight is a running discovery or token request that later callers
+// with the same key wait on instead of repeating it.
+type oauthFlight struct {
+	done chan struct{}
+	err  error
+}
+
+// AuthRetryConfig returns an AuthRetryConfig that authenticates requests
+// with this client's tokens.
+func (c *OAuthClient) AuthRetryConfig() *AuthRetryConfig {
+	return &AuthRetryConfig{
+		SetAuth:        c.SetAuth,
+		OnUnauthorized: c.OnUnauthorized,
+		OnForbidden:    c.OnForbidden,
+	}
+}
+
+// SetAuth sets the Authorization header from the cached token for the
+// request's resource, refreshing an expiring token first. Requests to
+// resources not seen yet are sent without credentials; the 401 that
+// follows starts discovery. If the refresh fails, the stale token is
+// dropped and the request is sent without credentials too, so the 401
+// obtains a new one.
+func (c *OAuthClient) SetAuth(req *http.Request) error {
+	c.mu.Lock()
+	res := c.resourceFor(req.URL)
+	var tok *OAuthToken
+	if res != nil {
+		tok = res.token
+	}
+	c.mu.Unlock()
+	if tok == nil {
+		return nil
+	}
+	if tok.expired(c.clock(), c.expiryDelta()) && tok.RefreshToken != "" {
+		if err := c.single(req.Context(), "token "+res.resource, func() error {
+			if c.token(res) != tok {
+				return nil // already replaced
+			}
+			return c.refresh(req.Context(), res, tok)
+		}); err != nil {
+			if ctxErr := req.Context().Err(); ctxErr != nil {
+				return ctxErr
+			}
+			c.mu.Lock()
+			if res.token == tok {
+				res.token = nil
+			}
+			c.mu.Unlock()
+		}
+		if tok = c.token(res); tok == nil {
+			return nil
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	return nil
+}
+
+// OnUnauthorized discovers the resource's authorization server if needed
+// and obtains a new token.
+func (c *OAuthClient) OnUnauthorized(resp *http.Response) error {
+	if resp.Request == nil {
+		return errors.New("oauth: response has no request")
+	}
+	ctx := resp.Request.Context()
+	metadataURL, scopes, _ := ParseWWWAuthenticate(resp.Header.Get("Www-Authenticate"))
+	res, err := c.discover(ctx, resp.Request.URL, metadataURL)
+	if err != nil {
+		return err
+	}
+	used := bearerToken(resp.Request)
+	return c.single(ctx, "token "+res.resource, func() error {
+		tok := c.token(res)
+		if tok != nil && tok.AccessToken != used {
+			return nil // replaced since the request was sent
+		}
+		if tok != nil && tok.RefreshToken != "" {
+			if err := c.refresh(ctx, res, tok); err == nil {
+				return nil
+			}
+		}
+		if len(scopes) == 0 {
+			scopes = c.Scopes
+		}
+		return c.clientCredentials(ctx, res, scopes)
+	})
+}
+
+// OnForbidden handles a 403 insufficient_scope challenge (RFC 6750 §3.1)
+// by requesting a token with the additional scopes. Other 403s are
+// returned as errors.
+func (c *OAuthClient) OnForbidden(resp *http.Response) error {
+	if resp.Request == nil {
+		return errors.New("oauth: response has no request")
+	}
+	var bearer *AuthChallenge
+	challenges, _ := ParseAuthChallenges(resp.Header.Get("Www-Authenticate"))
+	for i := range challenges {
+		if challenges[i].HasScheme("Bearer") || challenges[i].Scheme == "" {
+			bearer = &challenges[i]
+			break
+		}
+	}
+	if bearer == nil || bearer.ErrorCode() != "insufficient_scope" {
+		return errors.New("oauth: forbidden")
+	}
+	required := bearer.Scopes()
+	if len(required) == 0 {
+		return errors.New("oauth: insufficient_scope without scope")
+	}
+
+	ctx := resp.Request.Context()
+	res, err := c.discover(ctx, resp.Request.URL, "")
+	if err != nil {
+		return err
+	}
+	used := bearerToken(resp.Request)
+	covered := func(tok *OAuthToken) bool {
+		return tok != nil && !slices.ContainsFunc(required, func(s string) bool { return !slices.Contains(tok.Scopes, s) })
+	}
+	// A step-up already running for other scopes may not cover ours, so
+	// try again once after waiting on it.
+	for range 2 {
+		err := c.single(ctx, "token "+res.resource, func() error {
+			tok := c.token(res)
+			if covered(tok) && tok.AccessToken != used {
+				return nil
+			}
+			scopes := slices.Clone(c.Scopes)
+			if tok != nil {
+				scopes = slices.Clone(tok.Scopes)
+			}
+			for _, s := range required {
+				if !slices.Contains(scopes, s) {
+					scopes = append(scopes, s)
+				}
+			}
+			return c.clientCredentials(ctx, res, scopes)
+		})
+		if err != nil || covered(c.token(res)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Token returns the cached token for resource, if any.
+func (c *OAuthClient) Token(resource string) (*OAuthToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if res, ok := c.resources[resource]; ok && res.token != nil {
+		tok := *res.token
+		return &tok, true
+	}
+	return nil, false
+}
+
+// single runs fn unless a call with the same key is running, in which case
+// it waits for that call and returns its error.
+func (c *OAuthClient) single(ctx context.Context, key string, fn func() error) error {
+	c.mu.Lock()
+	if f, ok := c.flights[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if c.flights == nil {
+		c.flights = make(map[string]*oauthFlight)
+	}
+	f := &oauthFlight{done: make(chan struct{})}
+	c.flights[key] = f
+	c.mu.Unlock()
+
+	f.err = fn()
+	c.mu.Lock()
+	delete(c.flights, key)
+	c.mu.Unlock()
+	close(f.done)
+	return f.err
+}
+
+func (c *OAuthClient) token(res *oauthResource) *OAuthToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return res.token
+}
+
+func (c *OAuthClient) setToken(res *oauthResource, tok *OAuthToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res.token = tok
+}
+
+// resourceFor returns the discovered resource that covers a request URL,
+// preferring the longest (most specific) resource identifier, so a token
+// issued for one path-scoped resource is never sent to another path on the
+// same origin. The caller holds c.mu.
+func (c *OAuthClient) resourceFor(u *url.URL) *oauthResource {
+	target := u.Scheme + "://" + u.Host + u.EscapedPath()
+	var best *oauthResource
+	for id, res := range c.resources {
+		if (best == nil || len(id) > len(best.resource)) && resourceContains(id, target) {
+			best = res
+		}
+	}
+	return best
+}
+
+// discover resolves the resource and authorization server for a request
+// URL, reusing cached metadata.
+func (c *OAuthClient) discover(ctx context.Context, target *url.URL, metadataURL string) (*oauthResource, error) {
+	origin := target.Scheme + "://" + target.Host
+	c.mu.Lock()
+	res := c.resourceFor(target)
+	c.mu.Unlock()
+	if res != nil && metadataURL == "" {
+		return res, nil
+	}
+
+	err := c.single(ctx, "discover "+origin+" "+metadataURL, func() error {
+		metadataURL := metadataURL
+		if metadataURL == "" {
+			var err error
+			if metadataURL, err = ProtectedResourceMetadataURL(origin); err != nil {
+				return err
+			}
+		}
+		prm, err := FetchProtectedResourceMetadata(ctx, c.httpClient(), metadataURL, origin+target.EscapedPath())
+		if err != nil {
+			return err
+		}
+		if len(prm.AuthorizationServers) == 0 {
+			return fmt.Errorf("oauth: resource %s lists no authorization servers", prm.Resource)
+		}
+
+		c.mu.Lock()
+		_, known := c.resources[prm.Resource]
+		c.mu.Unlock()
+		var server *AuthorizationServerMetadata
+		if !known {
+			if server, err = DiscoverAuthorizationServer(ctx, c.httpClient(), prm.AuthorizationServers[0]); err != nil {
+				return err
+			}
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.resources == nil {
+			c.resources = make(map[string]*oauthResource)
+		}
+		if _, ok := c.resources[prm.Resource]; !ok {
+			c.resources[prm.Resource] = &oauthResource{resource: prm.Resource, server: server}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if res = c.resourceFor(target); res == nil {
+		return nil, fmt.Errorf("oauth: no resource discovered for %s", origin+target.EscapedPath())
+	}
+	return res, nil
+}
+
+// refresh replaces stale, the resource's current token, using its
+// refresh token.
+func (c *OAuthClient) refresh(ctx context.Context, res *oauthResource, stale *OAuthToken) error {
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {stale.RefreshToken},
+		"resource":      {res.resource},
+	}
+	tok, err := c.requestToken(ctx, res.server, form, stale.Scopes)
+	if err != nil {
+		return err
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = stale.RefreshToken // RFC 6749 §6: may be kept
+	}
+	c.setToken(res, tok)
+	return nil
+}
+
+func (c *OAuthClient) clientCredentials(ctx context.Context, res *oauthResource, scopes []string) error {
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"resource":   {res.resource}, // RFC 8707
+	}
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	tok, err := c.requestToken(ctx, res.server, form, scopes)
+	if err != nil {
+		return err
+	}
+	c.setToken(res, tok)
+	return nil
+}
+
+// bearerToken returns the bearer token a request was sent with, if any.
+func bearerToken(req *http.Request) string {
+	scheme, token, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return token
+}
+
+// requestToken posts a token request, authenticating the client with
+// client_secret_basic unless the server only supports client_secret_post.
+func (c *OAuthClient) requestToken(ctx context.Context, server *AuthorizationServerMetadata, form url.Values, scopes []string) (*OAuthToken, error) {
+	methods := server.TokenEndpointAuthMethodsSupported
+	useBasic := c.ClientSecret != "" && (len(methods) == 0 || slices.Contains(methods, "client_secret_basic"))
+	if !useBasic {
+		form.Set("client_id", c.ClientID)
+		if c.ClientSecret != "" {
+			form.Set("client_secret", c.ClientSecret)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", ContentTypeForm)
+	req.Header.Set("Accept", ContentTypeJSON)
+	if useBasic {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		oauthErr := &OAuthError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, oauthErr) != nil || oauthErr.Code == "" {
+			return nil, &HTTPError{Code: resp.StatusCode, Body: body, Header: resp.Header.Clone()}
+		}
+		return nil, oauthErr
+	}
+
+	var out struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("oauth: decoding token response: %w", err)
+	}
+	if out.AccessToken == "" {
+		return nil, errors.New("oauth: token response has no access_token")
+	}
+	if !strings.EqualFold(out.TokenType, "bearer") {
+		return nil, fmt.Errorf("oauth: unsupported token type %q", out.TokenType)
+	}
+	tok := &OAuthToken{
+		AccessToken:  out.AccessToken,
+		TokenType:    out.TokenType,
+		RefreshToken: out.RefreshToken,
+		Scopes:       scopes,
+	}
+	if out.Scope != "" {
+		tok.Scopes = strings.Fields(out.Scope)
+	}
+	if out.ExpiresIn > 0 {
+		tok.Expiry = c.clock().Add(time.Duration(out.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
+
+func (c *OAuthClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return DefaultHttpClient
+}
+
+func (c *OAuthClient) expiryDelta() time.Duration {
+	if c.ExpiryDelta > 0 {
+		return c.ExpiryDelta
+	}
+	return 30 * time.Second
+}
+
+func (c *OAuthClient) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,447 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeAuthServer is a stand-in OAuth authorization server issuing opaque
+// tokens for client "svc"/"secret".
+type fakeAuthServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	tokens    map[string][]string // access token -> scopes
+	refreshes map[string][]string // refresh token -> scopes
+	grants    []string
+	resources []string
+	n         int
+	expiresIn int
+	// hold, if set, makes token requests wait until it is closed; each
+	// waiting request first sends on held.
+	hold, held chan struct{}
+}
+
+func newFakeAuthServer(t *testing.T) *fakeAuthServer {
+	t.Helper()
+	as := &fakeAuthServer{tokens: map[string][]string{}, refreshes: map[string][]string{}, expiresIn: 3600}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AuthorizationServerMetadata{
+			Issuer:                            as.URL,
+			TokenEndpoint:                     as.URL + "/token",
+			GrantTypesSupported:               []string{"client_credentials", "refresh_token"},
+			TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		as.mu.Lock()
+		hold, held := as.hold, as.held
+		as.mu.Unlock()
+		if hold != nil {
+			held <- struct{}{}
+			<-hold
+		}
+		as.mu.Lock()
+		defer as.mu.Unlock()
+		if id, secret, ok := r.BasicAuth(); !ok || id != "svc" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		grant := r.PostForm.Get("grant_type")
+		as.grants = append(as.grants, grant)
+		as.resources = append(as.resources, r.PostForm.Get("resource"))
+		var scopes []string
+		switch grant {
+		case "client_credentials":
+			scopes = strings.Fields(r.PostForm.Get("scope"))
+		case "refresh_token":
+			var ok bool
+			if scopes, ok = as.refreshes[r.PostForm.Get("refresh_token")]; !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "unknown refresh token"})
+				return
+			}
+		}
+		as.n++
+		access, refresh := fmt.Sprintf("at-%d", as.n), fmt.Sprintf("rt-%d", as.n)
+		as.tokens[access] = scopes
+		as.refreshes[refresh] = scopes
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": access, "token_type": "Bearer", "expires_in": as.expiresIn,
+			"refresh_token": refresh, "scope": strings.Join(scopes, " "),
+		})
+	})
+	as.Server = httptest.NewServer(mux)
+	t.Cleanup(as.Close)
+	return as
+}
+
+func (as *fakeAuthServer) revokeAll() {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	clear(as.tokens)
+}
+
+func (as *fakeAuthServer) grantLog() string {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return strings.Join(as.grants, ",")
+}
+
+// newFakeResourceServer protects /api (scope "read") and /admin (scope
+// "admin") with tokens from as, and publishes RFC 9728 metadata.
+func newFakeResourceServer(t *testing.T, as *fakeAuthServer) *httptest.Server {
+	t.Helper()
+	var rs *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-protected-resource", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ProtectedResourceMetadata{
+			Resource:             rs.URL,
+			AuthorizationServers: []string{as.URL},
+			ScopesSupported:      []string{"read", "admin"},
+		})
+	})
+	protect := func(scope string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			as.mu.Lock()
+			scopes, ok := as.tokens[token]
+			as.mu.Unlock()
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer resource_metadata="`+rs.URL+`/.well-known/oauth-protected-resource", scope="read"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !slices.Contains(scopes, scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`"ok:` + strings.Join(scopes, "+") + `"`))
+		}
+	}
+	mux.HandleFunc("/api", protect("read"))
+	mux.HandleFunc("/admin", protect("admin"))
+	rs = httptest.NewServer(mux)
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func oauthGet(t *testing.T, cfg *AuthRetryConfig, url string) (string, error) {
+	t.Helper()
+	resp, err := DoWithAuthRetry(cfg, func() (*http.Request, error) {
+		return http.NewRequest("GET", url, nil)
+	}, http.DefaultClient.Do)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out string
+	json.NewDecoder(resp.Body).Decode(&out)
+	return out, nil
+}
+
+func TestOAuthClient_DiscoveryAndStepUp(t *testing.T) {
+	as := newFakeAuthServer(t)
+	rs := newFakeResourceServer(t, as)
+	client := &OAuthClient{ClientID: "svc", ClientSecret: "secret"}
+	cfg := client.AuthRetryConfig()
+
+	// 401 -> discovery -> client_credentials with the challenged scope.
+	if got, err := oauthGet(t, cfg, rs.URL+"/api"); err != nil || got != "ok:read" {
+		t.Fatalf("api = %q, %v", got, err)
+	}
+	// The cached token is reused.
+	if got, err := oauthGet(t, cfg, rs.URL+"/api"); err != nil || got != "ok:read" {
+		t.Fatalf("second api = %q, %v", got, err)
+	}
+	if as.grantLog() != "client_credentials" {
+		t.Errorf("grants = %s, want one token request", as.grantLog())
+	}
+
+	// 403 insufficient_scope -> a token with read and admin.
+	if got, err := oauthGet(t, cfg, rs.URL+"/admin"); err != nil || got != "ok:read+admin" {
+		t.Fatalf("admin = %q, %v", got, err)
+	}
+	tok, ok := client.Token(rs.URL)
+	if !ok || strings.Join(tok.Scopes, " ") != "read admin" {
+		t.Errorf("cached token = %+v", tok)
+	}
+
+	// A revoked access token is replaced through the refresh grant.
+	as.revokeAll()
+	if got, err := oauthGet(t, cfg, rs.URL+"/admin"); err != nil || got != "ok:read+admin" {
+		t.Fatalf("after revoke = %q, %v", got, err)
+	}
+	if got := as.grantLog(); got != "client_credentials,client_credentials,refresh_token" {
+		t.Errorf("grants = %s", got)
+	}
+	for _, r := range as.resources {
+		if r != rs.URL {
+			t.Errorf("token request resource = %q, want %q", r, rs.URL)
+		}
+	}
+}
+
+// TestOAuthClient_SlowTokenRequest verifies that a slow token request
+// neither blocks requests to other resources nor is repeated by
+// concurrent requests for the same resource.
+func TestOAuthClient_SlowTokenRequest(t *testing.T) {
+	as := newFakeAuthServer(t)
+	fast := newFakeResourceServer(t, as)
+	slow := newFakeResourceServer(t, as)
+	client := &OAuthClient{ClientID: "svc", ClientSecret: "secret"}
+	cfg := client.AuthRetryConfig()
+	if _, err := oauthGet(t, cfg, fast.URL+"/api"); err != nil {
+		t.Fatal(err)
+	}
+
+	as.mu.Lock()
+	as.hold, as.held = make(chan struct{}), make(chan struct{}, 10)
+	as.mu.Unlock()
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			if got, err := oauthGet(t, cfg, slow.URL+"/api"); err != nil || got != "ok:read" {
+				t.Errorf("slow = %q, %v", got, err)
+			}
+		})
+	}
+	<-as.held
+
+	done := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", fast.URL+"/api", nil)
+		err := client.SetAuth(req)
+		if err == nil && req.Header.Get("Authorization") == "" {
+			err = errors.New("no Authorization header")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("SetAuth blocked behind another resource's token request")
+	}
+
+	time.Sleep(50 * time.Millisecond) // let the other requests queue up
+	close(as.hold)
+	wg.Wait()
+	if got := as.grantLog(); got != "client_credentials,client_credentials" {
+		t.Errorf("grants = %s, want one per resource", got)
+	}
+}
+
+func TestOAuthClient_RefreshesBeforeExpiry(t *testing.T) {
+	as := newFakeAuthServer(t)
+	as.expiresIn = 60
+	rs := newFakeResourceServer(t, as)
+	now := time.Unix(1000, 0)
+	client := &OAuthClient{ClientID: "svc", ClientSecret: "secret", now: func() time.Time { return now }}
+	cfg := client.AuthRetryConfig()
+
+	if _, err := oauthGet(t, cfg, rs.URL+"/api"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(45 * time.Second) // within the 30s ExpiryDelta
+	if _, err := oauthGet(t, cfg, rs.URL+"/api"); err != nil {
+		t.Fatal(err)
+	}
+	if got := as.grantLog(); got != "client_credentials,refresh_token" {
+		t.Errorf("grants = %s, want a proactive refresh", got)
+	}
+}
+
+// TestOAuthClient_RefreshRejected verifies that a rejected refresh drops
+// the stale token and re-authorizes through the 401 instead of failing
+// the request.
+func TestOAuthClient_RefreshRejected(t *testing.T) {
+	as := newFakeAuthServer(t)
+	as.expiresIn = 60
+	rs := newFakeResourceServer(t, as)
+	now := time.Unix(1000, 0)
+	client := &OAuthClient{ClientID: "svc", ClientSecret: "secret", now: func() time.Time { return now }}
+	cfg := client.AuthRetryConfig()
+
+	if _, err := oauthGet(t, cfg, rs.URL+"/api"); err != nil {
+		t.Fatal(err)
+	}
+	as.mu.Lock()
+	clear(as.refreshes) // the refresh endpoint now returns 400 invalid_grant
+	as.mu.Unlock()
+	as.revokeAll()
+	now = now.Add(2 * time.Minute)
+
+	req, _ := http.NewRequest("GET", rs.URL+"/api", nil)
+	if err := client.SetAuth(req); err != nil || req.Header.Get("Authorization") != "" {
+		t.Fatalf("SetAuth = %v, Authorization %q; want an unauthenticated request", err, req.Header.Get("Authorization"))
+	}
+	if _, ok := client.Token(rs.URL); ok {
+		t.Error("stale token still cached")
+	}
+	if got, err := oauthGet(t, cfg, rs.URL+"/api"); err != nil || got != "ok:read" {
+		t.Fatalf("after rejected refresh = %q, %v", got, err)
+	}
+	if got := as.grantLog(); got != "client_credentials,refresh_token,client_credentials" {
+		t.Errorf("grants = %s", got)
+	}
+}
+
+func TestOAuthClient_BadCredentials(t *testing.T) {
+	as := newFakeAuthServer(t)
+	rs := newFakeResourceServer(t, as)
+	client := &OAuthClient{ClientID: "svc", ClientSecret: "wrong"}
+	_, err := oauthGet(t, client.AuthRetryConfig(), rs.URL+"/api")
+	var oauthErr *OAuthError
+	var retryErr *AuthRetryError
+	if !errors.As(err, &retryErr) || retryErr.StatusCode != 401 || !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_client" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestFetchProtectedResourceMetadata_ResourceMismatch(t *testing.T) {
+	srv := newJSONServer(t, 200, `{"resource":"https://other.example","authorization_servers":["https://as.example"]}`, nil)
+	defer srv.Close()
+	_, err := FetchProtectedResourceMetadata(context.Background(), nil, srv.URL, "https://api.example/v1")
+	if err == nil || !strings.Contains(err.Error(), "not") {
+		t.Errorf("err = %v, want resource mismatch", err)
+	}
+}
+
+// TestOAuthClient_ForeignOriginClaimsResource verifies that a second
+// origin serving metadata that names the first origin's resource gets no
+// token.
+func TestOAuthClient_ForeignOriginClaimsResource(t *testing.T) {
+	as := newFakeAuthServer(t)
+	rs := newFakeResourceServer(t, as)
+	client := &OAuthClient{ClientID: "svc", ClientSecret: "secret"}
+	cfg := client.AuthRetryConfig()
+	if _, err := oauthGet(t, cfg, rs.URL+"/api"); err != nil {
+		t.Fatal(err)
+	}
+
+	var evil *httptest.Server
+	var leaked atomic.Bool
+	evil = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			leaked.Store(true)
+		}
+		if r.URL.Path == "/.well-known/oauth-protected-resource" {
+			json.NewEncoder(w).Encode(ProtectedResourceMetadata{Resource: rs.URL, AuthorizationServers: []string{as.URL}})
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer resource_metadata="`+evil.URL+`/.well-known/oauth-protected-resource"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer evil.Close()
+
+	if _, err := oauthGet(t, cfg, evil.URL+"/api"); err == nil {
+		t.Error("foreign origin accepted as the resource")
+	}
+	if leaked.Load() {
+		t.Error("token for the real resource sent to the foreign origin")
+	}
+}
+
+// TestOAuthClient_PathScopedResource verifies that a token for a
+// path-scoped resource is not attached to other paths on the same origin.
+func TestOAuthClient_PathScopedResource(t *testing.T) {
+	as := newFakeAuthServer(t)
+	var rs *httptest.Server
+	var leaked atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-protected-resource/a", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ProtectedResourceMetadata{Resource: rs.URL + "/a", AuthorizationServers: []string{as.URL}})
+	})
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		as.mu.Lock()
+		_, ok := as.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		as.mu.Unlock()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer resource_metadata="`+rs.URL+`/.well-known/oauth-protected-resource/a"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`"a"`))
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			leaked.Store(true)
+		}
+		w.Write([]byte(`"b"`))
+	})
+	rs = httptest.NewServer(mux)
+	defer rs.Close()
+
+	client := &OAuthClient{ClientID: "svc", ClientSecret: "secret"}
+	cfg := client.AuthRetryConfig()
+	if got, err := oauthGet(t, cfg, rs.URL+"/a"); err != nil || got != "a" {
+		t.Fatalf("a = %q, %v", got, err)
+	}
+	if got, err := oauthGet(t, cfg, rs.URL+"/b"); err != nil || got != "b" {
+		t.Fatalf("b = %q, %v", got, err)
+	}
+	if leaked.Load() {
+		t.Error("token for /a sent to /b")
+	}
+}
+
+func TestResourceContains(t *testing.T) {
+	cases := []struct {
+		resource, target string
+		want             bool
+	}{
+		{"https://api.example.com", "https://api.example.com/v1/x", true},
+		{"https://api.example.com/", "https://API.example.com", true},
+		{"https://api.example.com/v1", "https://api.example.com/v1", true},
+		{"https://api.example.com/v1", "https://api.example.com/v1/x", true},
+		{"https://api.example.com/v1", "https://api.example.com/v10", false},
+		{"https://api.example.com", "https://api.example.com.evil.net/x", false},
+		{"http://127.0.0.1:4567", "http://127.0.0.1:45678/x", false},
+		{"https://api.example.com", "http://api.example.com/x", false},
+	}
+	for _, c := range cases {
+		if got := resourceContains(c.resource, c.target); got != c.want {
+			t.Errorf("resourceContains(%q, %q) = %v", c.resource, c.target, got)
+		}
+	}
+}
+
+func TestDiscoverAuthorizationServer_IssuerMismatch(t *testing.T) {
+	srv := newJSONServer(t, 200, `{"issuer":"https://evil.example","token_endpoint":"https://evil.example/token"}`, nil)
+	defer srv.Close()
+	if _, err := DiscoverAuthorizationServer(context.Background(), nil, srv.URL); err == nil {
+		t.Error("issuer mismatch accepted")
+	}
+}
+
+func TestProtectedResourceMetadataURL(t *testing.T) {
+	cases := map[string]string{
+		"https://api.example":         "https://api.example/.well-known/oauth-protected-resource",
+		"https://api.example/v1/":     "https://api.example/.well-known/oauth-protected-resource/v1",
+		"https://api.example/v1?x=1#": "https://api.example/.well-known/oauth-protected-resource/v1",
+	}
+	for in, want := range cases {
+		if got, err := ProtectedResourceMetadataURL(in); err != nil || got != want {
+			t.Errorf("ProtectedResourceMetadataURL(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ProtectedResourceMetadataURL("/relative"); err == nil {
+		t.Error("relative URL accepted")
+	}
+}
@@ -1,14 +1,28 @@
 package http
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var urlPingHttpClient *http.Client
 
+// urlProbeHttpClient is the verifying client Wait and Check use by default.
+var urlProbeHttpClient = &http.Client{Timeout: 10 * time.Second}
+
 func init() {
 	if urlPingHttpClient == nil {
 		transport := &http.Transport{
@@ -38,10 +52,27 @@ type URLWaiter struct {
 	// Func versions of above so we can do something dynamcially on each iteration
 	RequestFunc  func(iter int, prevError error) (*http.Request, error)
 	ValidateFunc func(req *http.Request, resp *http.Response) error
+
+	// Client sends the checks made by Wait and Check. If nil, a client is
+	// built from TLSConfig, or, without one, a shared client that verifies
+	// certificates. Run always uses a shared client that skips
+	// verification.
+	Client *http.Client
+
+	// TLSConfig configures the client built when Client is nil, e.g. with
+	// the CA that signed a peer's certificate.
+	TLSConfig *tls.Config
+
+	// InsecureSkipVerify makes Wait and Check accept any certificate when
+	// neither Client nor TLSConfig is set, like Run.
+	InsecureSkipVerify bool
 }
 
 // Runs the "waiter".
 //
+// Run retries forever with a fixed delay and ignores ValidateFunc; use
+// Wait for a bounded, cancellable wait with backoff.
+//
 // Returns a tuple of:
 //
 //		success - whether the waited-upon eventually became active.
@@ -80,8 +111,308 @@ func (u *URLWaiter) Run() (success bool, iter int, err error) {
 			log.Println("Error calling URl: ", u.Url, err)
 		} else {
 			log.Println("Success calling URL: ", u.Url, resp)
-			return
+			return true, iter, nil
 		}
 		time.Sleep(u.DelayBetweenChecks)
 	}
 }
+
+// Wait checks the URL until it responds successfully, with backoff, as
+// configured by cfg. See WaitReady.
+func (u *URLWaiter) Wait(ctx context.Context, cfg WaitConfig) (attempts int, err error) {
+	return WaitReady(ctx, cfg, u)
+}
+
+// Check makes one request and returns nil if it got a response below 400
+// that passes ValidateFunc. It makes URLWaiter a Probe.
+func (u *URLWaiter) Check(ctx context.Context) error {
+	return u.checkAttempt(ctx, 0, nil)
+}
+
+func (u *URLWaiter) checkAttempt(ctx context.Context, iter int, prevErr error) error {
+	var req *http.Request
+	var err error
+	if u.RequestFunc != nil {
+		req, err = u.RequestFunc(iter, prevErr)
+		if err == nil && req == nil {
+			err = errors.New("url waiter: RequestFunc returned no request")
+		}
+	} else {
+		method := u.Method
+		if method == "" {
+			method = "GET"
+		}
+		req, err = NewJsonRequest(method, u.Url, u.Payload)
+		if err == nil {
+			for k, v := range u.Headers {
+				req.Header.Set(k, v)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	client := u.Client
+	if client == nil && u.TLSConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = u.TLSConfig
+		transport.DisableKeepAlives = true
+		client = &http.Client{Transport: transport}
+	} else if client == nil && u.InsecureSkipVerify {
+		client = urlPingHttpClient
+	} else if client == nil {
+		client = urlProbeHttpClient
+	}
+	resp, err := CallRaw(ctx, req, WithClient(client))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if u.ValidateFunc != nil {
+		return u.ValidateFunc(req, resp)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// ============================================================================
+// Readiness probes
+// ============================================================================
+
+// Probe checks once whether a dependency is ready, returning nil if it is.
+type Probe interface {
+	Check(ctx context.Context) error
+}
+
+// ProbeFunc adapts a function to Probe.
+type ProbeFunc func(ctx context.Context) error
+
+// Check calls f.
+func (f ProbeFunc) Check(ctx context.Context) error { return f(ctx) }
+
+// HTTPProbe returns a probe that GETs url with client and expects a
+// response below 400. A nil client verifies certificates against the
+// system roots.
+func HTTPProbe(url string, client *http.Client) Probe {
+	return &URLWaiter{Url: url, Client: client}
+}
+
+// TCPProbe returns a probe that succeeds once a TCP connection to addr
+// (host:port) can be opened, e.g. for a database:
+//
+//	gohttp.TCPProbe("postgres:5432")
+func TCPProbe(addr string) Probe {
+	return ProbeFunc(func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// GRPCHealthProbe returns a probe that calls the standard gRPC health
+// service (grpc.health.v1.Health/Check) at target for service ("" for the
+// server as a whole) and expects SERVING. Without opts the connection is
+// plaintext; pass grpc.WithTransportCredentials for TLS.
+func GRPCHealthProbe(target, service string, opts ...grpc.DialOption) Probe {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return ProbeFunc(func(ctx context.Context) error {
+		conn, err := grpc.NewClient(target, opts...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("grpc health of %s: %s", target, resp.GetStatus())
+		}
+		return nil
+	})
+}
+
+// ============================================================================
+// Waiting on probes
+// ============================================================================
+
+// WaitConfig bounds and paces the checks of WaitReady and WaitAll.
+type WaitConfig struct {
+	// Timeout bounds the whole wait. 0 means only the context deadline
+	// applies.
+	Timeout time.Duration
+
+	// MaxAttempts bounds the checks per target. 0 means no limit.
+	MaxAttempts int
+
+	// AttemptTimeout bounds each check. 0 means no per-check limit.
+	AttemptTimeout time.Duration
+
+	// Waits between checks grow exponentially from InitialBackoff by
+	// Multiplier up to MaxBackoff, with Jitter applied, as for
+	// RetryPolicy. Defaults: 100ms, 10s and 2.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+
+	// OnAttempt, if set, is called after each check with the target name
+	// ("" for WaitReady), the attempt (starting at 1) and its error.
+	// WaitAll calls it concurrently for different targets.
+	OnAttempt func(target string, attempt int, err error)
+}
+
+// DefaultWaitConfig returns a config that waits up to 2 minutes, checking
+// with a 5s timeout and backing off from 500ms to 10s with 20% jitter.
+func DefaultWaitConfig() WaitConfig {
+	return WaitConfig{
+		Timeout:        2 * time.Minute,
+		AttemptTimeout: 5 * time.Second,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// WaitReady checks probe until it succeeds, the attempts run out, or the
+// timeout or ctx ends the wait. It returns the number of checks made and,
+// on failure, an error wrapping the last check's error and, if the wait
+// was cut short, the context error:
+//
+//	_, err := gohttp.WaitReady(ctx, gohttp.DefaultWaitConfig(), gohttp.TCPProbe("redis:6379"))
+func WaitReady(ctx context.Context, cfg WaitConfig, probe Probe) (attempts int, err error) {
+	return waitReady(ctx, cfg, "", probe)
+}
+
+func waitReady(ctx context.Context, cfg WaitConfig, name string, probe Probe) (int, error) {
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	backoff := RetryPolicy{
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		Multiplier:     cfg.Multiplier,
+		Jitter:         cfg.Jitter,
+	}
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		checkCtx, cancel := ctx, context.CancelFunc(func() {})
+		if cfg.AttemptTimeout > 0 {
+			checkCtx, cancel = context.WithTimeout(ctx, cfg.AttemptTimeout)
+		}
+		var err error
+		if w, ok := probe.(*URLWaiter); ok {
+			err = w.checkAttempt(checkCtx, attempt-1, lastErr)
+		} else {
+			err = probe.Check(checkCtx)
+		}
+		cancel()
+		if cfg.OnAttempt != nil {
+			cfg.OnAttempt(name, attempt, err)
+		}
+		if err == nil {
+			return attempt, nil
+		}
+		lastErr = err
+		if cfg.MaxAttempts > 0 && attempt >= cfg.MaxAttempts {
+			return attempt, fmt.Errorf("not ready after %d attempts: %w", attempt, err)
+		}
+
+		timer := time.NewTimer(backoff.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, fmt.Errorf("%w after %d attempts: %w", ctx.Err(), attempt, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// WaitTarget names a dependency for WaitAll.
+type WaitTarget struct {
+	Name  string
+	Probe Probe
+}
+
+// WaitResult is the outcome of waiting on one WaitTarget.
+type WaitResult struct {
+	Name     string
+	Attempts int
+	// Elapsed is the time until the target was ready or the wait gave up.
+	Elapsed time.Duration
+	// Err is nil if the target became ready.
+	Err error
+}
+
+// WaitReport is the outcome of WaitAll, one result per target in the
+// order given.
+type WaitReport struct {
+	Results []WaitResult
+	Elapsed time.Duration
+}
+
+// Ready reports whether every target became ready.
+func (r *WaitReport) Ready() bool {
+	return r.Err() == nil
+}
+
+// Err joins the errors of the targets that did not become ready, each
+// prefixed with its name, or returns nil.
+func (r *WaitReport) Err() error {
+	var errs []error
+	for _, res := range r.Results {
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.Name, res.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// String summarizes the report, one line per target.
+func (r *WaitReport) String() string {
+	var b strings.Builder
+	for _, res := range r.Results {
+		if res.Err == nil {
+			fmt.Fprintf(&b, "%s: ready after %d attempts in %s\n", res.Name, res.Attempts, res.Elapsed.Round(time.Millisecond))
+		} else {
+			fmt.Fprintf(&b, "%s: not ready after %d attempts in %s: %v\n", res.Name, res.Attempts, res.Elapsed.Round(time.Millisecond), res.Err)
+		}
+	}
+	return b.String()
+}
+
+// WaitAll waits on all targets concurrently, each as WaitReady would, and
+// reports on every one. Use it to gate service startup on its
+// dependencies:
+//
+//	report := gohttp.WaitAll(ctx, gohttp.DefaultWaitConfig(),
+//		gohttp.WaitTarget{Name: "db", Probe: gohttp.TCPProbe("postgres:5432")},
+//		gohttp.WaitTarget{Name: "users", Probe: gohttp.GRPCHealthProbe("users:9090", "")},
+//		gohttp.WaitTarget{Name: "auth", Probe: gohttp.HTTPProbe("http://auth/healthz", nil)})
+//	if err := report.Err(); err != nil {
+//		log.Fatalf("dependencies not ready:\n%s", report)
+//	}
+func WaitAll(ctx context.Context, cfg WaitConfig, targets ...WaitTarget) *WaitReport {
+	start := time.Now()
+	report := &WaitReport{Results: make([]WaitResult, len(targets))}
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Go(func() {
+			attempts, err := waitReady(ctx, cfg, t.Name, t.Probe)
+			report.Results[i] = WaitResult{Name: t.Name, Attempts: attempts, Elapsed: time.Since(start), Err: err}
+		})
+	}
+	wg.Wait()
+	report.Elapsed = time.Since(start)
+	return report
+}
@@ -0,0 +1,176 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func fastWait() WaitConfig {
+	return WaitConfig{Timeout: 2 * time.Second, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+func TestURLWaiter_Wait(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+	w := &URLWaiter{Url: srv.URL}
+	attempts, err := w.Wait(context.Background(), fastWait())
+	if err != nil || attempts != 3 || calls.Load() != 3 {
+		t.Errorf("attempts = %d, calls = %d, err = %v", attempts, calls.Load(), err)
+	}
+}
+
+func TestURLWaiter_ValidateAndRequestFunc(t *testing.T) {
+	srv := newJSONServer(t, 200, `{"ready":false}`, nil)
+	defer srv.Close()
+	var iters []int
+	w := &URLWaiter{
+		RequestFunc: func(iter int, prevErr error) (*http.Request, error) {
+			iters = append(iters, iter)
+			return http.NewRequest("GET", srv.URL, nil)
+		},
+		ValidateFunc: func(req *http.Request, resp *http.Response) error {
+			return errors.New("not ready yet")
+		},
+	}
+	cfg := fastWait()
+	cfg.MaxAttempts = 3
+	attempts, err := w.Wait(context.Background(), cfg)
+	if attempts != 3 || err == nil || !strings.Contains(err.Error(), "not ready yet") {
+		t.Errorf("attempts = %d, err = %v", attempts, err)
+	}
+	if len(iters) != 3 || iters[2] != 2 {
+		t.Errorf("iters = %v", iters)
+	}
+}
+
+func TestURLWaiter_TLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	cfg := fastWait()
+	cfg.MaxAttempts = 1
+	if _, err := (&URLWaiter{Url: srv.URL, Client: &http.Client{}}).Wait(context.Background(), cfg); err == nil {
+		t.Error("untrusted certificate accepted")
+	}
+	w := &URLWaiter{Url: srv.URL, TLSConfig: &tls.Config{RootCAs: pool}}
+	if _, err := w.Wait(context.Background(), cfg); err != nil {
+		t.Errorf("trusted certificate: %v", err)
+	}
+}
+
+func TestURLWaiter_VerifiesByDefault(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	if err := HTTPProbe(srv.URL, nil).Check(context.Background()); err == nil {
+		t.Error("HTTPProbe accepted an untrusted certificate")
+	}
+	cfg := fastWait()
+	cfg.MaxAttempts = 1
+	if _, err := (&URLWaiter{Url: srv.URL}).Wait(context.Background(), cfg); err == nil {
+		t.Error("Wait accepted an untrusted certificate")
+	}
+	w := &URLWaiter{Url: srv.URL, InsecureSkipVerify: true}
+	if err := w.Check(context.Background()); err != nil {
+		t.Errorf("InsecureSkipVerify: %v", err)
+	}
+}
+
+func TestWaitReady_Deadline(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg := fastWait()
+	cfg.Timeout = 50 * time.Millisecond
+	attempts, err := WaitReady(context.Background(), cfg, TCPProbe(addr))
+	if !errors.Is(err, context.DeadlineExceeded) || attempts < 2 {
+		t.Errorf("attempts = %d, err = %v", attempts, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := WaitReady(ctx, fastWait(), TCPProbe(addr)); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if err := TCPProbe(ln.Addr().String()).Check(context.Background()); err != nil {
+		t.Errorf("open port: %v", err)
+	}
+}
+
+func TestGRPCHealthProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := health.NewServer()
+	hs.SetServingStatus("users", healthpb.HealthCheckResponse_NOT_SERVING)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	probe := GRPCHealthProbe(ln.Addr().String(), "users")
+	if err := probe.Check(context.Background()); err == nil || !strings.Contains(err.Error(), "NOT_SERVING") {
+		t.Errorf("err = %v, want NOT_SERVING", err)
+	}
+	var checks atomic.Int32
+	cfg := fastWait()
+	cfg.OnAttempt = func(target string, attempt int, err error) {
+		if checks.Add(1) == 2 {
+			hs.SetServingStatus("users", healthpb.HealthCheckResponse_SERVING)
+		}
+	}
+	if attempts, err := WaitReady(context.Background(), cfg, probe); err != nil || attempts != 3 {
+		t.Errorf("attempts = %d, err = %v", attempts, err)
+	}
+}
+
+func TestWaitAll_Report(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	cfg := fastWait()
+	cfg.MaxAttempts = 3
+
+	report := WaitAll(context.Background(), cfg,
+		WaitTarget{Name: "api", Probe: HTTPProbe(ok.URL, nil)},
+		WaitTarget{Name: "db", Probe: ProbeFunc(func(ctx context.Context) error { return errors.New("refused") })},
+	)
+	if report.Ready() || len(report.Results) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if r := report.Results[0]; r.Name != "api" || r.Err != nil || r.Attempts != 1 {
+		t.Errorf("api = %+v", r)
+	}
+	if r := report.Results[1]; r.Err == nil || r.Attempts != 3 {
+		t.Errorf("db = %+v", r)
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "db: not ready after 3 attempts: refused") {
+		t.Errorf("Err() = %v", err)
+	}
+	if s := report.String(); !strings.Contains(s, "api: ready after 1 attempts") || !strings.Contains(s, "db: not ready") {
+		t.Errorf("String() = %q", s)
+	}
+}
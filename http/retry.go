@@ -0,0 +1,249 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how WithRetry retries a failed Call or CallVoid.
+//
+// A request is retried when the attempt fails with a network error or a
+// response status accepted by RetryStatus, and only if:
+//   - the method is idempotent (GET, HEAD, OPTIONS, TRACE, PUT, DELETE), the
+//     request carries an Idempotency-Key header, or RetryNonIdempotent is set
+//   - the body can be replayed: requests without a body, or whose GetBody is
+//     set (http.NewRequest sets it for bytes, strings and buffers)
+//   - attempts, MaxElapsed and the context deadline leave room for another try
+//
+// Waits grow exponentially from InitialBackoff by Multiplier up to
+// MaxBackoff, with Jitter applied. A Retry-After header on a 429 or 503
+// response replaces the computed wait.
+//
+// Zero-valued fields take the defaults shown; Jitter is used as given.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Default: 3.
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry. Default: 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the computed wait. Default: 10s.
+	MaxBackoff time.Duration
+
+	// Multiplier is the backoff growth factor. Default: 2.
+	Multiplier float64
+
+	// Jitter randomizes each wait by up to ±Jitter of its value (0.2 means
+	// ±20%), so clients that failed together do not retry together. 0
+	// disables jitter.
+	Jitter float64
+
+	// MaxElapsed bounds the total time spent, including waits. A retry
+	// that could not start before it runs out is not attempted. 0 means
+	// only the context deadline applies.
+	MaxElapsed time.Duration
+
+	// MaxRetryAfter is the longest Retry-After the policy will wait for;
+	// a server asking for more fails the call instead. Default: 30s.
+	MaxRetryAfter time.Duration
+
+	// RetryStatus reports whether a response status is worth retrying.
+	// Default: 429 and the transient statuses of IsHTTPTransient.
+	RetryStatus func(code int) bool
+
+	// RetryNonIdempotent allows retrying POST, PATCH and other
+	// non-idempotent methods. Only set it for endpoints that tolerate
+	// duplicate requests.
+	RetryNonIdempotent bool
+
+	// OnRetry, if set, is called before each wait with the attempt that
+	// failed (starting at 1), its error and the wait.
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with the defaults and 20% jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		MaxRetryAfter:  30 * time.Second,
+	}
+}
+
+// WithRetry retries failed calls according to policy.
+//
+// Usage:
+//
+//	cfg, err := gohttp.Call[Config](ctx, req, gohttp.WithRetry(gohttp.DefaultRetryPolicy()))
+func WithRetry(policy RetryPolicy) CallOption {
+	return func(cfg *callConfig) { cfg.retry = &policy }
+}
+
+// do runs attempt until it succeeds or the policy gives up, returning the
+// last attempt's result.
+func (p *RetryPolicy) do(ctx context.Context, req *http.Request, attempt func(*http.Request) ([]byte, *http.Response, error)) ([]byte, *http.Response, error) {
+	start := time.Now()
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	retryable := p.RetryNonIdempotent || isIdempotent(req)
+
+	for n := 1; ; n++ {
+		if n > 1 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+		body, resp, err := attempt(req)
+		if err == nil || !retryable || n >= maxAttempts || !p.shouldRetry(ctx, err) {
+			return body, resp, err
+		}
+		if n == 1 && req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return body, resp, err // the body cannot be replayed
+		}
+
+		wait, ok := p.wait(n, err)
+		if !ok {
+			return body, resp, err
+		}
+		if p.MaxElapsed > 0 && time.Since(start)+wait >= p.MaxElapsed {
+			return body, resp, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return body, resp, err
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(n, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return body, resp, err
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry classifies a failed attempt.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		if p.RetryStatus != nil {
+			return p.RetryStatus(httpErr.Code)
+		}
+		return httpErr.Code == http.StatusTooManyRequests || IsHTTPTransient(httpErr.Code)
+	}
+	return isRetryableNetError(err)
+}
+
+// wait returns how long to wait after the given failed attempt, or false
+// if the server asked for a longer wait than MaxRetryAfter allows.
+func (p *RetryPolicy) wait(attempt int, err error) (time.Duration, bool) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && (httpErr.Code == http.StatusTooManyRequests || httpErr.Code == http.StatusServiceUnavailable) {
+		if after, ok := ParseRetryAfter(httpErr.Header.Get("Retry-After"), time.Now()); ok {
+			maxAfter := p.MaxRetryAfter
+			if maxAfter <= 0 {
+				maxAfter = 30 * time.Second
+			}
+			return after, after <= maxAfter
+		}
+	}
+	return p.Backoff(attempt), true
+}
+
+// Backoff returns the jittered wait after the given failed attempt
+// (starting at 1).
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	initial, maxBackoff, multiplier := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 10 * time.Second
+	}
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	wait := float64(initial)
+	for i := 1; i < attempt && wait < float64(maxBackoff); i++ {
+		wait *= multiplier
+	}
+	wait = min(wait, float64(maxBackoff))
+	if p.Jitter > 0 {
+		wait *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(wait)
+}
+
+// ParseRetryAfter parses a Retry-After header value, either delay-seconds
+// or an HTTP-date (RFC 9110 §10.2.3), into a wait relative to now. Returns
+// false if the value is empty or malformed; dates in the past give 0.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(at.Sub(now), 0), true
+}
+
+// isIdempotent reports whether req can safely be sent more than once
+// (RFC 9110 §9.2.2), or carries an Idempotency-Key.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// isRetryableNetError reports whether a transport error may succeed on
+// retry. Certificate problems will not go away by themselves.
+func isRetryableNetError(err error) bool {
+	var (
+		unknownAuthority *x509.UnknownAuthorityError
+		invalidCert      x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		verification     *tls.CertificateVerificationError
+	)
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalidCert),
+		errors.As(err, &hostname), errors.As(err, &verification):
+		return false
+	case errors.Is(err, context.Canceled):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,236 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with status, then answers
+// 200 with the request body echoed back.
+func flakyServer(t *testing.T, failures int32, status int, headers map[string]string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) <= failures {
+			for k, v := range headers {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"` + string(body) + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func fastRetry() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+func TestWithRetry_TransientThenSuccess(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+
+	var retries []int
+	policy := fastRetry()
+	policy.OnRetry = func(attempt int, err error, wait time.Duration) {
+		retries = append(retries, attempt)
+		if HTTPErrorCode(err) != 503 {
+			t.Errorf("OnRetry err = %v", err)
+		}
+	}
+	if _, err := Call[callTestUser](context.Background(), req, WithRetry(policy)); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if calls.Load() != 3 || len(retries) != 2 {
+		t.Errorf("calls = %d, retries = %v", calls.Load(), retries)
+	}
+}
+
+func TestWithRetry_MaxAttempts(t *testing.T) {
+	srv, calls := flakyServer(t, 10, http.StatusBadGateway, nil)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	err := CallVoid(context.Background(), req, WithRetry(fastRetry()))
+	if HTTPErrorCode(err) != 502 {
+		t.Errorf("err = %v, want the last 502", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+}
+
+func TestWithRetry_NotRetriedOn4xx(t *testing.T) {
+	srv, calls := flakyServer(t, 10, http.StatusBadRequest, nil)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	CallVoid(context.Background(), req, WithRetry(fastRetry()))
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestWithRetry_PostNeedsOptIn(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable, nil)
+	req, _ := http.NewRequest("POST", srv.URL, strings.NewReader("bob"))
+	if err := CallVoid(context.Background(), req, WithRetry(fastRetry())); HTTPErrorCode(err) != 503 {
+		t.Errorf("POST without opt-in err = %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("POST retried without opt-in: calls = %d", calls.Load())
+	}
+
+	// Opted in: the body is rewound for the retry.
+	srv, calls = flakyServer(t, 1, http.StatusServiceUnavailable, nil)
+	req, _ = http.NewRequest("POST", srv.URL, strings.NewReader("bob"))
+	policy := fastRetry()
+	policy.RetryNonIdempotent = true
+	got, err := Call[callTestUser](context.Background(), req, WithRetry(policy))
+	if err != nil || got.Name != "bob" || calls.Load() != 2 {
+		t.Errorf("got %+v, err %v, calls %d", got, err, calls.Load())
+	}
+}
+
+func TestWithRetry_IdempotencyKey(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable, nil)
+	req, _ := http.NewRequest("POST", srv.URL, strings.NewReader("carol"))
+	req.Header.Set("Idempotency-Key", "k1")
+	got, err := Call[callTestUser](context.Background(), req, WithRetry(fastRetry()))
+	if err != nil || got.Name != "carol" || calls.Load() != 2 {
+		t.Errorf("got %+v, err %v, calls %d", got, err, calls.Load())
+	}
+}
+
+func TestWithRetry_UnreplayableBody(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable, nil)
+	req, _ := http.NewRequest("PUT", srv.URL, io.NopCloser(strings.NewReader("x")))
+	req.GetBody = nil
+	CallVoid(context.Background(), req, WithRetry(fastRetry()))
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1 without GetBody", calls.Load())
+	}
+}
+
+func TestWithRetry_RetryAfter(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusTooManyRequests, map[string]string{"Retry-After": "1"})
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	start := time.Now()
+	if err := CallVoid(context.Background(), req, WithRetry(fastRetry())); err != nil {
+		t.Fatalf("CallVoid: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %v, want Retry-After of 1s honoured", elapsed)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d", calls.Load())
+	}
+}
+
+func TestWithRetry_RetryAfterTooLong(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable, map[string]string{"Retry-After": "120"})
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	policy := fastRetry()
+	policy.MaxRetryAfter = time.Second
+	if err := CallVoid(context.Background(), req, WithRetry(policy)); HTTPErrorCode(err) != 503 {
+		t.Errorf("err = %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want no retry", calls.Load())
+	}
+}
+
+func TestWithRetry_NetworkError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if err := CallVoid(context.Background(), req, WithRetry(fastRetry())); err != nil {
+		t.Fatalf("CallVoid: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d", calls.Load())
+	}
+}
+
+func TestWithRetry_ContextCancelDuringWait(t *testing.T) {
+	srv, calls := flakyServer(t, 10, http.StatusServiceUnavailable, nil)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	policy.OnRetry = func(int, error, time.Duration) { cancel() }
+
+	done := make(chan error, 1)
+	go func() { done <- CallVoid(ctx, req, WithRetry(policy)) }()
+	select {
+	case err := <-done:
+		if HTTPErrorCode(err) != 503 {
+			t.Errorf("err = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("retry wait not interrupted by cancel")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d", calls.Load())
+	}
+}
+
+func TestWithRetry_MaxElapsed(t *testing.T) {
+	srv, calls := flakyServer(t, 10, http.StatusServiceUnavailable, nil)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: 40 * time.Millisecond, MaxBackoff: 40 * time.Millisecond, MaxElapsed: 100 * time.Millisecond}
+	CallVoid(context.Background(), req, WithRetry(policy))
+	if n := calls.Load(); n < 2 || n > 3 {
+		t.Errorf("calls = %d, want 2-3 within MaxElapsed", n)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for range 50 {
+		if got := p.Backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("jittered Backoff(1) = %v", got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"5", 5 * time.Second, true},
+		{"Wed, 01 Jan 2025 00:00:30 GMT", 30 * time.Second, true},
+		{"Tue, 31 Dec 2024 00:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, c := range cases {
+		got, ok := ParseRetryAfter(c.in, now)
+		if got != c.want || ok != c.ok {
+			t.Errorf("ParseRetryAfter(%q) = %v, %v", c.in, got, ok)
+		}
+	}
+}
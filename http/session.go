@@ -3,6 +3,8 @@ package http
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"sync"
+	"time"
 )
 
 // GenerateSessionID returns a cryptographically random 32-character hex string
@@ -21,3 +23,219 @@ func GenerateSessionID() string {
 	}
 	return hex.EncodeToString(b)
 }
+
+// SessionStore records which session IDs are live. It is deliberately
+// small so it can be backed by Redis, a database or a shared cache when
+// sessions must survive restarts or be validated by several instances.
+// StreamableSessions uses it to issue and validate Mcp-Session-Id values.
+//
+// Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Create records a new live session.
+	Create(id string) error
+
+	// Touch validates a session and marks it active, extending its idle
+	// lifetime. It returns false if the session is unknown or has expired.
+	Touch(id string) (bool, error)
+
+	// Delete removes a session. Deleting an unknown session is not an error.
+	Delete(id string) error
+}
+
+// SessionExpiryNotifier is implemented by SessionStores that expire
+// sessions on their own. StreamableSessions registers with it so that an
+// expired session is cleaned up (and OnClose called) like a deleted one.
+type SessionExpiryNotifier interface {
+	// OnExpire registers fn to be called with the ID of each session the
+	// store expires. fn must not call back into the store synchronously
+	// while holding locks the store needs.
+	OnExpire(fn func(id string))
+}
+
+// MemorySessionStore is an in-process SessionStore with optional idle
+// expiry. Expired sessions are removed when touched and by Sweep, which a
+// background sweeper runs every IdleTimeout/2 from the first Create until
+// Close; either way the OnExpire hooks are called for them. The zero value
+// is ready to use and never expires sessions.
+type MemorySessionStore struct {
+	// IdleTimeout expires a session that has not been touched for this
+	// long. Zero means sessions never expire. Set it before the first
+	// Create.
+	IdleTimeout time.Duration
+
+	mu        sync.Mutex
+	lastSeen  map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+	onExpire  []func(id string)
+
+	// Background sweeper, started by the first Create when IdleTimeout is
+	// set and stopped by Close.
+	sweeping  bool
+	stopSweep chan struct{}
+	sweepDone chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemorySessionStore creates a MemorySessionStore that expires sessions
+// after idleTimeout without activity (0 disables expiry).
+func NewMemorySessionStore(idleTimeout time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{
+		IdleTimeout: idleTimeout,
+		lastSeen:    make(map[string]time.Time),
+		now:         time.Now,
+	}
+}
+
+// Create implements SessionStore.
+func (m *MemorySessionStore) Create(id string) error {
+	m.mu.Lock()
+	now := m.clock()
+	var expired []string
+	if m.IdleTimeout > 0 && now.Sub(m.lastSweep) >= m.IdleTimeout {
+		expired = m.sweepLocked(now)
+	}
+	if m.lastSeen == nil {
+		m.lastSeen = make(map[string]time.Time)
+	}
+	m.lastSeen[id] = now
+	if m.IdleTimeout > 0 && !m.sweeping {
+		m.sweeping = true
+		m.stopSweep = make(chan struct{})
+		m.sweepDone = make(chan struct{})
+		go m.sweepLoop(max(m.IdleTimeout/2, time.Millisecond), m.stopSweep, m.sweepDone)
+	}
+	hooks := m.onExpire
+	m.mu.Unlock()
+	notifyExpired(hooks, expired)
+	return nil
+}
+
+// Touch implements SessionStore.
+func (m *MemorySessionStore) Touch(id string) (bool, error) {
+	m.mu.Lock()
+	seen, ok := m.lastSeen[id]
+	if !ok {
+		m.mu.Unlock()
+		return false, nil
+	}
+	now := m.clock()
+	if m.expired(seen, now) {
+		delete(m.lastSeen, id)
+		hooks := m.onExpire
+		m.mu.Unlock()
+		notifyExpired(hooks, []string{id})
+		return false, nil
+	}
+	m.lastSeen[id] = now
+	m.mu.Unlock()
+	return true, nil
+}
+
+// OnExpire implements SessionExpiryNotifier. Hooks run after the store's
+// lock is released.
+func (m *MemorySessionStore) OnExpire(fn func(id string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onExpire = append(m.onExpire, fn)
+}
+
+// Delete implements SessionStore.
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.lastSeen, id)
+	return nil
+}
+
+// Len returns the number of sessions held, including expired sessions
+// that have not been swept yet.
+func (m *MemorySessionStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.lastSeen)
+}
+
+// Sweep removes expired sessions and returns how many were removed.
+func (m *MemorySessionStore) Sweep() int {
+	m.mu.Lock()
+	expired := m.sweepLocked(m.clock())
+	hooks := m.onExpire
+	m.mu.Unlock()
+	notifyExpired(hooks, expired)
+	return len(expired)
+}
+
+// Close stops the background sweeper. Sessions are kept and the store
+// remains usable, but idle sessions are then only expired when touched or
+// by calling Sweep.
+func (m *MemorySessionStore) Close() error {
+	m.closeOnce.Do(func() {
+		m.mu.Lock()
+		stop, done := m.stopSweep, m.sweepDone
+		m.sweeping = true // never restart
+		m.mu.Unlock()
+		if stop != nil {
+			close(stop)
+			<-done
+		}
+	})
+	return nil
+}
+
+func (m *MemorySessionStore) sweepLoop(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.Sweep()
+		}
+	}
+}
+
+// idleTimeout lets StreamableSessions pace its stream touches.
+func (m *MemorySessionStore) idleTimeout() time.Duration {
+	return m.IdleTimeout
+}
+
+// sweepLocked removes expired sessions and returns their IDs.
+func (m *MemorySessionStore) sweepLocked(now time.Time) []string {
+	m.lastSweep = now
+	var removed []string
+	for id, seen := range m.lastSeen {
+		if m.expired(seen, now) {
+			delete(m.lastSeen, id)
+			removed = append(removed, id)
+		}
+	}
+	return removed
+}
+
+func notifyExpired(hooks []func(id string), ids []string) {
+	for _, id := range ids {
+		for _, hook := range hooks {
+			hook(id)
+		}
+	}
+}
+
+func (m *MemorySessionStore) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+func (m *MemorySessionStore) expired(seen, now time.Time) bool {
+	return m.IdleTimeout > 0 && now.Sub(seen) > m.IdleTimeout
+}
+
+// Compile-time interface compliance checks
+var (
+	_ SessionStore          = (*MemorySessionStore)(nil)
+	_ SessionExpiryNotifier = (*MemorySessionStore)(nil)
+)
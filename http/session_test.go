@@ -2,6 +2,7 @@ package http
 
 import (
 	"testing"
+	"time"
 )
 
 // TestGenerateSessionID_Length verifies that GenerateSessionID returns a
@@ -36,3 +37,91 @@ func TestGenerateSessionID_Unique(t *testing.T) {
 		t.Errorf("GenerateSessionID() returned same value twice: %q", a)
 	}
 }
+
+// TestMemorySessionStore_Lifecycle verifies Create, Touch and Delete.
+func TestMemorySessionStore_Lifecycle(t *testing.T) {
+	store := &MemorySessionStore{}
+	if live, _ := store.Touch("s1"); live {
+		t.Error("Touch of unknown session should return false")
+	}
+	store.Create("s1")
+	if live, _ := store.Touch("s1"); !live {
+		t.Error("Touch of created session should return true")
+	}
+	store.Delete("s1")
+	if live, _ := store.Touch("s1"); live {
+		t.Error("Touch of deleted session should return false")
+	}
+}
+
+// TestMemorySessionStore_IdleExpiry verifies that sessions expire after
+// IdleTimeout without a Touch, that Touch extends the lifetime, and that
+// Sweep removes expired sessions.
+func TestMemorySessionStore_IdleExpiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemorySessionStore(time.Minute)
+	store.now = func() time.Time { return now }
+
+	store.Create("active")
+	store.Create("idle")
+	now = now.Add(50 * time.Second)
+	store.Touch("active")
+	now = now.Add(50 * time.Second)
+
+	if live, _ := store.Touch("active"); !live {
+		t.Error("touched session should still be live")
+	}
+	if store.Sweep() != 1 || store.Len() != 1 {
+		t.Errorf("Sweep should remove only the idle session, Len = %d", store.Len())
+	}
+	if live, _ := store.Touch("idle"); live {
+		t.Error("idle session should have expired")
+	}
+}
+
+// TestMemorySessionStore_OnExpire verifies that OnExpire hooks run for
+// sessions expired by Touch and by Sweep, but not for deleted ones.
+func TestMemorySessionStore_OnExpire(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemorySessionStore(time.Minute)
+	store.now = func() time.Time { return now }
+	var expired []string
+	store.OnExpire(func(id string) { expired = append(expired, id) })
+
+	store.Create("touched")
+	store.Create("swept")
+	store.Create("deleted")
+	store.Delete("deleted")
+	now = now.Add(2 * time.Minute)
+
+	store.Touch("touched")
+	store.Sweep()
+	if len(expired) != 2 || expired[0] != "touched" || expired[1] != "swept" {
+		t.Errorf("expired = %v, want [touched swept]", expired)
+	}
+}
+
+// TestMemorySessionStore_BackgroundSweep verifies that idle sessions expire
+// without any further store calls, and that Close stops the sweeper.
+func TestMemorySessionStore_BackgroundSweep(t *testing.T) {
+	store := NewMemorySessionStore(20 * time.Millisecond)
+	expired := make(chan string, 1)
+	store.OnExpire(func(id string) { expired <- id })
+	store.Create("idle")
+
+	select {
+	case id := <-expired:
+		if id != "idle" {
+			t.Errorf("expired %q, want idle", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle session not swept in the background")
+	}
+	store.Close()
+
+	store.Create("after-close")
+	time.Sleep(60 * time.Millisecond)
+	if store.Len() != 1 {
+		t.Errorf("Len = %d after Close, want the session kept until touched", store.Len())
+	}
+}
@@ -0,0 +1,398 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// SSEClient — reconnecting Server-Sent Events client
+// ============================================================================
+//
+// SSEClient is the Go counterpart to the TypeScript SSEClient in
+// clients/typescript. It implements the client side of the WHATWG
+// reconnection model on top of SSEEventReader:
+// https://html.spec.whatwg.org/multipage/server-sent-events.html#sse-processing-model
+//
+//   - The last seen "id:" is sent as Last-Event-ID on every reconnect, so
+//     servers backed by an EventStore (see SSEConnConfig.EventStore) can
+//     replay what was missed.
+//   - A "retry:" field replaces the base reconnection delay.
+//   - A 204 No Content response ends the stream without reconnecting.
+
+// SSEClientEvent is a decoded event delivered by SSEClient.
+type SSEClientEvent[T any] struct {
+	// Event is the SSE event type ("event:" field). Empty for unnamed
+	// events, which EventSource clients receive as "message".
+	Event string
+
+	// ID is the SSE event ID ("id:" field), empty if the event had none.
+	ID string
+
+	// Data is the "data:" payload decoded with the client's Codec.
+	Data T
+}
+
+// SSEClient connects to an SSE endpoint (such as one served by SSEServe),
+// decodes events with a Codec, and transparently reconnects when the stream
+// drops.
+//
+// Events are delivered either through the OnMessage/OnEvent callbacks
+// (Run) or on a channel (Events).
+//
+// Usage:
+//
+//	client := gohttp.NewSSEClient[MyEvent]("http://localhost:8080/events")
+//	client.OnEvent = func(event string, data MyEvent) { ... }
+//	err := client.Run(ctx) // blocks until ctx is cancelled or a terminal error
+//
+// Or with a channel:
+//
+//	for ev := range client.Events(ctx) {
+//	    // ev.Event, ev.ID, ev.Data
+//	}
+//	if err := client.Err(); err != nil { ... }
+//
+// Not safe for concurrent use: run one Run or Events at a time per client.
+// LastEventID may be read from any goroutine.
+type SSEClient[T any] struct {
+	// URL is the SSE endpoint. Requests are always GET.
+	URL string
+
+	// Header is added to every request (e.g., static auth tokens).
+	Header http.Header
+
+	// HTTPClient performs the requests. It must not set a Timeout, which
+	// would cut off the long-lived stream. Default: http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Auth, if set, routes every connection attempt through
+	// DoWithAuthRetry, so tokens are injected and refreshed on 401/403.
+	Auth *AuthRetryConfig
+
+	// Codec decodes the "data:" field of each event. Only Decode is used.
+	// Default: TypedJSONCodec[T, any].
+	Codec Codec[T, any]
+
+	// InitialRetry is the base reconnection delay, used until the server
+	// sends a "retry:" hint. Default: 3 seconds.
+	InitialRetry time.Duration
+
+	// MaxBackoff caps the reconnection delay, which doubles (with jitter)
+	// after each consecutive failed connection attempt. Default: 30 seconds.
+	MaxBackoff time.Duration
+
+	// MaxReconnects limits consecutive failed connection attempts before Run
+	// gives up. A successful connection resets the count. 0 means unlimited.
+	MaxReconnects int
+
+	// OnMessage is called by Run for unnamed events (no "event:" field).
+	OnMessage func(data T)
+
+	// OnEvent is called by Run for named events (has "event:" field).
+	OnEvent func(event string, data T)
+
+	// OnError is called for recoverable errors: events whose data fails to
+	// decode (the event is skipped) and dropped connections (a reconnect
+	// follows). If nil, these errors are logged.
+	OnError func(err error)
+
+	mu          sync.Mutex
+	lastEventID string
+	retry       time.Duration
+	err         error
+}
+
+// NewSSEClient creates an SSEClient for url with a JSON codec.
+func NewSSEClient[T any](url string) *SSEClient[T] {
+	return &SSEClient[T]{
+		URL:   url,
+		Codec: &TypedJSONCodec[T, any]{},
+	}
+}
+
+// LastEventID returns the ID of the last event received, which is sent as
+// Last-Event-ID when reconnecting. Set it before Run via SetLastEventID to
+// resume a stream from a previous session.
+func (c *SSEClient[T]) LastEventID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastEventID
+}
+
+// SetLastEventID sets the ID sent as Last-Event-ID on the next connection.
+func (c *SSEClient[T]) SetLastEventID(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastEventID = id
+}
+
+// Run connects and dispatches events to OnMessage and OnEvent until ctx is
+// cancelled, the server ends the stream with 204 No Content, a connection
+// fails with a non-retryable status, or MaxReconnects is exceeded.
+//
+// Returns nil after a 204, ctx.Err() after cancellation, and otherwise the
+// error that ended the stream.
+func (c *SSEClient[T]) Run(ctx context.Context) error {
+	return c.run(ctx, func(ev SSEClientEvent[T]) error {
+		if ev.Event == "" {
+			if c.OnMessage != nil {
+				c.OnMessage(ev.Data)
+			}
+		} else if c.OnEvent != nil {
+			c.OnEvent(ev.Event, ev.Data)
+		}
+		return nil
+	})
+}
+
+// Events runs the client in a background goroutine and delivers events on
+// the returned channel, which is closed when the client stops (see Run for
+// the conditions). Call Err after the channel is closed for the reason.
+//
+// The channel is unbuffered; the stream is not read while the consumer is
+// busy, which applies backpressure to the server.
+func (c *SSEClient[T]) Events(ctx context.Context) <-chan SSEClientEvent[T] {
+	out := make(chan SSEClientEvent[T])
+	go func() {
+		defer close(out)
+		err := c.run(ctx, func(ev SSEClientEvent[T]) error {
+			select {
+			case out <- ev:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+	}()
+	return out
+}
+
+// Err returns the error that stopped the stream started by Events, or nil
+// if it ended normally. Only meaningful after the Events channel is closed.
+func (c *SSEClient[T]) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+var (
+	// errSSENoContent signals a 204 response: the server asked the client
+	// to stop reconnecting.
+	errSSENoContent = errors.New("sse: server responded 204 No Content")
+
+	// errSSEContentType signals a 200 response that is not an event stream.
+	errSSEContentType = errors.New("sse: expected text/event-stream")
+)
+
+// run is the reconnect loop shared by Run and Events. emit delivers each
+// decoded event; an error from emit stops the loop and is returned.
+func (c *SSEClient[T]) run(ctx context.Context, emit func(SSEClientEvent[T]) error) error {
+	failures := 0
+	for {
+		resp, err := c.connect(ctx)
+		if err == nil {
+			failures = 0
+			err = c.consume(ctx, resp.Body, emit)
+			resp.Body.Close()
+			var emitErr *sseEmitError
+			if errors.As(err, &emitErr) {
+				return emitErr.err
+			}
+		} else {
+			if errors.Is(err, errSSENoContent) {
+				return nil
+			}
+			if !isSSERetryable(err) {
+				return err
+			}
+			failures++
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if c.MaxReconnects > 0 && failures > c.MaxReconnects {
+			return fmt.Errorf("sse: giving up after %d failed reconnects: %w", c.MaxReconnects, err)
+		}
+		if err != nil && err != io.EOF {
+			c.reportError(err)
+		}
+
+		timer := time.NewTimer(c.reconnectDelay(failures))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// connect issues the GET, with Last-Event-ID when resuming, and validates
+// the response. The returned response is a live event stream.
+func (c *SSEClient[T]) connect(ctx context.Context) (*http.Response, error) {
+	buildReq := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, vs := range c.Header {
+			for _, v := range vs {
+				req.Header.Add(k, v)
+			}
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Cache-Control", "no-cache")
+		if id := c.LastEventID(); id != "" {
+			req.Header.Set("Last-Event-ID", id)
+		}
+		return req, nil
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var resp *http.Response
+	var err error
+	if c.Auth != nil {
+		resp, err = DoWithAuthRetry(c.Auth, buildReq, client.Do)
+	} else {
+		var req *http.Request
+		if req, err = buildReq(); err == nil {
+			resp, err = client.Do(req)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		resp.Body.Close()
+		return nil, errSSENoContent
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxErrorBodySize))
+		resp.Body.Close()
+		return nil, &HTTPError{Code: resp.StatusCode, Body: body, Header: resp.Header.Clone()}
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/event-stream" {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w, got %q", errSSEContentType, resp.Header.Get("Content-Type"))
+	}
+	return resp, nil
+}
+
+// consume reads events until the stream ends, tracking the last event ID
+// and retry hint. Returns io.EOF when the server closes the stream.
+func (c *SSEClient[T]) consume(ctx context.Context, body io.Reader, emit func(SSEClientEvent[T]) error) error {
+	codec := c.Codec
+	if codec == nil {
+		codec = &TypedJSONCodec[T, any]{}
+	}
+	reader := NewSSEEventReader(body)
+	for {
+		ev, err := reader.ReadEvent()
+		if ev.Retry > 0 {
+			c.mu.Lock()
+			c.retry = time.Duration(ev.Retry) * time.Millisecond
+			c.mu.Unlock()
+		}
+		// An "id:" field, even an empty one, replaces the last event ID.
+		if ev.hasID && err == nil {
+			c.SetLastEventID(ev.ID)
+		}
+
+		// Per the WHATWG dispatch algorithm, events without a "data:"
+		// field (bare retry hints, comments such as keepalives) are not
+		// dispatched; a "data:" field with an empty value is. A partial
+		// event cut off by EOF is dropped as well.
+		if ev.hasData && err == nil {
+			data, decodeErr := codec.Decode([]byte(ev.Data), TextMessage)
+			if decodeErr != nil {
+				c.reportError(fmt.Errorf("sse: decoding event %q: %w", ev.ID, decodeErr))
+			} else if emitErr := emit(SSEClientEvent[T]{Event: ev.Event, ID: ev.ID, Data: data}); emitErr != nil {
+				return &sseEmitError{emitErr}
+			}
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
+
+// reconnectDelay returns the delay before the next attempt: the server's
+// retry hint (or InitialRetry), doubled per consecutive failure up to
+// MaxBackoff, with ±20% jitter once backing off.
+func (c *SSEClient[T]) reconnectDelay(failures int) time.Duration {
+	c.mu.Lock()
+	delay := c.retry
+	c.mu.Unlock()
+	if delay <= 0 {
+		delay = c.InitialRetry
+	}
+	if delay <= 0 {
+		delay = 3 * time.Second
+	}
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	if failures <= 1 {
+		return min(delay, maxBackoff)
+	}
+	for i := 1; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxBackoff)
+	jitter := time.Duration(rand.Int64N(int64(delay)/5+1)) * 2
+	return delay - delay/5 + jitter
+}
+
+func (c *SSEClient[T]) reportError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	} else {
+		log.Printf("SSEClient %s: %v", c.URL, err)
+	}
+}
+
+// sseEmitError wraps an error returned by the event consumer so run can
+// tell it apart from stream errors (which trigger a reconnect).
+type sseEmitError struct{ err error }
+
+func (e *sseEmitError) Error() string { return e.err.Error() }
+func (e *sseEmitError) Unwrap() error { return e.err }
+
+// isSSERetryable reports whether a failed connection attempt should be
+// retried: network errors, 5xx, 408 and 429 are; other HTTP statuses, auth
+// failures and content-type mismatches are not.
+func isSSERetryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return IsHTTPTransient(httpErr.Code) ||
+			httpErr.Code == http.StatusTooManyRequests ||
+			httpErr.Code == http.StatusRequestTimeout
+	}
+	var authErr *AuthRetryError
+	if errors.As(err, &authErr) {
+		return false
+	}
+	return !errors.Is(err, errSSEContentType)
+}
@@ -0,0 +1,344 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type sseClientTestEvent struct {
+	N int `json:"n"`
+}
+
+// writeSSE writes raw SSE text and flushes it.
+func writeSSE(w http.ResponseWriter, text string) {
+	w.Write([]byte(text))
+	w.(http.Flusher).Flush()
+}
+
+func startSSE(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+}
+
+// collectEvents reads n events from the channel or fails after a timeout.
+func collectEvents[T any](t *testing.T, ch <-chan SSEClientEvent[T], n int) []SSEClientEvent[T] {
+	t.Helper()
+	var got []SSEClientEvent[T]
+	for len(got) < n {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				t.Fatalf("channel closed after %d events, want %d", len(got), n)
+			}
+			got = append(got, ev)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout after %d events, want %d", len(got), n)
+		}
+	}
+	return got
+}
+
+// TestSSEClientDecodesEvents verifies typed decoding of data, event names
+// and IDs, and that comments and bare retry hints are not delivered.
+func TestSSEClientDecodesEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startSSE(w)
+		writeSSE(w, ": keepalive\n\n")
+		writeSSE(w, "id: 1\ndata: {\"n\":1}\n\n")
+		writeSSE(w, "retry: 5000\n\n")
+		writeSSE(w, "event: update\nid: 2\ndata: {\"n\":2}\n\n")
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewSSEClient[sseClientTestEvent](srv.URL)
+	got := collectEvents(t, client.Events(ctx), 2)
+
+	if got[0].Data.N != 1 || got[0].Event != "" || got[0].ID != "1" {
+		t.Errorf("first event = %+v", got[0])
+	}
+	if got[1].Data.N != 2 || got[1].Event != "update" || got[1].ID != "2" {
+		t.Errorf("second event = %+v", got[1])
+	}
+	if id := client.LastEventID(); id != "2" {
+		t.Errorf("LastEventID = %q, want 2", id)
+	}
+}
+
+// sseRawCodec decodes event data as a plain string.
+type sseRawCodec struct{}
+
+func (sseRawCodec) Decode(data []byte, _ MessageType) (string, error) { return string(data), nil }
+func (sseRawCodec) Encode(any) ([]byte, MessageType, error)           { return nil, TextMessage, nil }
+
+// TestSSEClientEmptyFields verifies the WHATWG handling of empty fields: a
+// lone "data:" dispatches an event with empty data, and an empty "id:"
+// resets the last event ID.
+func TestSSEClientEmptyFields(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startSSE(w)
+		writeSSE(w, "id: 1\ndata: a\n\n")
+		writeSSE(w, "data:\n\n")
+		writeSSE(w, "id:\ndata: b\n\n")
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &SSEClient[string]{URL: srv.URL, Codec: sseRawCodec{}}
+	events := client.Events(ctx)
+	got := collectEvents(t, events, 2)
+	if got[0].Data != "a" || got[1].Data != "" {
+		t.Fatalf("events = %+v, want a and an empty-data event", got)
+	}
+	if id := client.LastEventID(); id != "1" {
+		t.Errorf("LastEventID = %q, want 1", id)
+	}
+	if got := collectEvents(t, events, 1); got[0].Data != "b" {
+		t.Fatalf("third event = %+v", got[0])
+	}
+	if id := client.LastEventID(); id != "" {
+		t.Errorf("LastEventID = %q after empty id field, want it reset", id)
+	}
+}
+
+// TestSSEClientReconnectsWithLastEventID verifies that when the server
+// closes the stream, the client reconnects after the server's retry hint
+// and sends the last seen ID as Last-Event-ID.
+func TestSSEClientReconnectsWithLastEventID(t *testing.T) {
+	var conns atomic.Int32
+	lastIDs := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastIDs <- r.Header.Get("Last-Event-ID")
+		startSSE(w)
+		if conns.Add(1) == 1 {
+			writeSSE(w, "retry: 10\nid: a\ndata: {\"n\":1}\n\n")
+			return // drop the stream
+		}
+		writeSSE(w, "id: b\ndata: {\"n\":2}\n\n")
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewSSEClient[sseClientTestEvent](srv.URL)
+	client.InitialRetry = time.Minute // the retry hint must override this
+
+	got := collectEvents(t, client.Events(ctx), 2)
+	if got[0].Data.N != 1 || got[1].Data.N != 2 {
+		t.Errorf("events = %+v", got)
+	}
+	if first, second := <-lastIDs, <-lastIDs; first != "" || second != "a" {
+		t.Errorf("Last-Event-ID headers = %q, %q; want \"\", \"a\"", first, second)
+	}
+}
+
+// TestSSEClientResumesFromSSEServe verifies the round trip with SSEServe
+// backed by an EventStore: events sent while the client was reconnecting
+// are replayed, in order and without duplicates.
+func TestSSEClientResumesFromSSEServe(t *testing.T) {
+	handler := &NotifierSSEHandler{connChan: make(chan *NotifierSSEConn, 2)}
+	config := &SSEConnConfig{
+		EventStore: NewMemoryEventStore(100),
+		StreamID:   func(r *http.Request) string { return "client-1" },
+	}
+	srv := httptest.NewServer(SSEServe[any](handler, config))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewSSEClient[sseClientTestEvent](srv.URL)
+	client.InitialRetry = 10 * time.Millisecond
+
+	// Buffer the stream so the client keeps reading (and tracking IDs)
+	// while the test is waiting on the server side.
+	events := make(chan SSEClientEvent[sseClientTestEvent], 10)
+	go func() {
+		for ev := range client.Events(ctx) {
+			events <- ev
+		}
+	}()
+
+	conn := waitForSSEConn(t, handler.connChan)
+	conn.SendOutput(map[string]any{"n": 1})
+	collectEvents(t, events, 1)
+
+	// Events 2 and 3 may or may not be read from the first connection before
+	// it closes; either way they must arrive exactly once. Event 4 goes to
+	// the new connection.
+	conn.SendOutput(map[string]any{"n": 2})
+	conn.SendOutput(map[string]any{"n": 3})
+	conn.Close()
+	conn = waitForSSEConn(t, handler.connChan)
+	conn.SendOutput(map[string]any{"n": 4})
+
+	var ns []int
+	for len(ns) == 0 || ns[len(ns)-1] != 4 {
+		ns = append(ns, collectEvents(t, events, 1)[0].Data.N)
+	}
+	if fmt.Sprint(ns) != "[2 3 4]" {
+		t.Errorf("events after first = %v, want [2 3 4]", ns)
+	}
+}
+
+// TestSSEClientRunCallbacks verifies that Run dispatches unnamed events to
+// OnMessage and named events to OnEvent, and returns nil when the server
+// responds 204 No Content (the spec's signal to stop reconnecting).
+func TestSSEClientRunCallbacks(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conns.Add(1) > 1 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		startSSE(w)
+		writeSSE(w, "data: {\"n\":1}\n\nevent: tick\ndata: {\"n\":2}\n\n")
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var messages []int
+	var named []string
+	client := NewSSEClient[sseClientTestEvent](srv.URL)
+	client.InitialRetry = time.Millisecond
+	client.OnMessage = func(data sseClientTestEvent) {
+		mu.Lock()
+		messages = append(messages, data.N)
+		mu.Unlock()
+	}
+	client.OnEvent = func(event string, data sseClientTestEvent) {
+		mu.Lock()
+		named = append(named, fmt.Sprintf("%s:%d", event, data.N))
+		mu.Unlock()
+	}
+
+	if err := client.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if fmt.Sprint(messages) != "[1]" || fmt.Sprint(named) != "[tick:2]" {
+		t.Errorf("messages = %v, named = %v", messages, named)
+	}
+}
+
+// TestSSEClientTerminalStatus verifies that a 4xx response stops the client
+// with an *HTTPError instead of reconnecting.
+func TestSSEClientTerminalStatus(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conns.Add(1)
+		http.Error(w, "no such stream", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	err := NewSSEClient[any](srv.URL).Run(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != 404 {
+		t.Fatalf("Run error = %v, want *HTTPError 404", err)
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("Expected 1 attempt, got %d", n)
+	}
+}
+
+// TestSSEClientMaxReconnects verifies that consecutive transient failures
+// are retried with backoff up to MaxReconnects, then reported.
+func TestSSEClientMaxReconnects(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conns.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := NewSSEClient[any](srv.URL)
+	client.InitialRetry = time.Millisecond
+	client.MaxReconnects = 2
+	var reported atomic.Int32
+	client.OnError = func(error) { reported.Add(1) }
+
+	err := client.Run(context.Background())
+	if HTTPErrorCode(errors.Unwrap(err)) != 503 {
+		t.Fatalf("Run error = %v, want wrapped 503", err)
+	}
+	if n := conns.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts (1 + 2 reconnects), got %d", n)
+	}
+	if n := reported.Load(); n != 2 {
+		t.Errorf("Expected 2 reported errors, got %d", n)
+	}
+}
+
+// TestSSEClientAuthRetry verifies that connections go through
+// DoWithAuthRetry: a 401 triggers OnUnauthorized and the retried request
+// carries the refreshed token.
+func TestSSEClientAuthRetry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		startSSE(w)
+		writeSSE(w, "data: {\"n\":7}\n\n")
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	token := "stale"
+	client := NewSSEClient[sseClientTestEvent](srv.URL)
+	client.Auth = &AuthRetryConfig{
+		SetAuth: func(req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		},
+		OnUnauthorized: func(resp *http.Response) error {
+			token = "fresh"
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got := collectEvents(t, client.Events(ctx), 1)
+	if got[0].Data.N != 7 {
+		t.Errorf("event = %+v", got[0])
+	}
+}
+
+// TestSSEClientContextCancel verifies that cancelling the context closes
+// the Events channel and records the context error.
+func TestSSEClientContextCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startSSE(w)
+		writeSSE(w, ": hi\n\n")
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewSSEClient[any](srv.URL)
+	events := client.Events(ctx)
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected channel to close without events")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+	if !errors.Is(client.Err(), context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", client.Err())
+	}
+}
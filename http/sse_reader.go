@@ -35,6 +35,11 @@ type SSEReadEvent struct {
 	ID      string // "id:" field value
 	Retry   int    // "retry:" field value in ms (0 = not set)
 	Comment string // Comment text (lines starting with ":")
+
+	// hasData and hasID record whether the event had a "data:" or "id:"
+	// field at all, which Data and ID cannot tell apart from an empty one.
+	hasData bool
+	hasID   bool
 }
 
 // SSEEventReader reads Server-Sent Events from an io.Reader.
@@ -168,6 +173,7 @@ func (r *SSEEventReader) ReadEvent() (SSEReadEvent, error) {
 			// last event ID buffer to the field value. Otherwise, ignore the field."
 			if !strings.ContainsRune(value, '\x00') {
 				ev.id = value
+				ev.idSet = true
 			}
 		case "retry":
 			// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
@@ -197,6 +203,7 @@ type sseReadState struct {
 	event     string
 	dataLines []string
 	id        string
+	idSet     bool
 	retry     int
 	comment   string
 	touched   bool // true if any line was processed for this event
@@ -215,6 +222,8 @@ func (s *sseReadState) finish() SSEReadEvent {
 		ID:      s.id,
 		Retry:   s.retry,
 		Comment: s.comment,
+		hasData: len(s.dataLines) > 0,
+		hasID:   s.idSet,
 	}
 }
 
@@ -182,6 +182,30 @@ func TestReadEvent_EmptyDataField(t *testing.T) {
 	if ev.Data != "" {
 		t.Errorf("Data = %q, want empty", ev.Data)
 	}
+	if !ev.hasData {
+		t.Error("hasData = false, want true for an empty data field")
+	}
+}
+
+func TestReadEvent_EmptyIDField(t *testing.T) {
+	// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+	// "id:" with no value sets the last event ID buffer to the empty string,
+	// which is distinct from an event with no "id:" field at all.
+	r := NewSSEEventReader(strings.NewReader("id:\ndata: x\n\ndata: y\n\n"))
+	ev, err := r.ReadEvent()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ev.ID != "" || !ev.hasID {
+		t.Errorf("ID = %q, hasID = %v; want empty and set", ev.ID, ev.hasID)
+	}
+	ev, err = r.ReadEvent()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ev.hasID {
+		t.Error("hasID = true for an event without an id field")
+	}
 }
 
 func TestReadEvent_EOFMidEvent(t *testing.T) {
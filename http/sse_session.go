@@ -0,0 +1,290 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// SSEInputConn is implemented by SSE connections that accept
+// client-to-server messages delivered through SSESessions. It mirrors the
+// HandleMessage hook of WebSocket connections.
+type SSEInputConn[I any] interface {
+	HandleMessage(msg I) error
+}
+
+// SSESessionRegistry opens and closes the client-to-server channel paired
+// with an SSE stream. *SSESessions[I, O] implements it; see
+// SSEConnConfig.Sessions.
+type SSESessionRegistry interface {
+	// OpenSession creates a session for conn (the value returned by
+	// SSEHandler.Validate) and returns its ID and the URL the client should
+	// POST messages to.
+	OpenSession(conn any, r *http.Request) (sessionID, endpoint string, err error)
+
+	// CloseSession ends a session. Later POSTs to it get 404.
+	CloseSession(sessionID string)
+}
+
+// SSESessions pairs SSE streams with a POST endpoint, giving SSE a
+// client-to-server channel in the style of the legacy MCP HTTP+SSE
+// transport:
+//
+//  1. The client opens the SSE stream (GET).
+//  2. SSEServe opens a session and sends an "endpoint" event whose data is
+//     a session-scoped URL, e.g. "/messages?sessionId=3f2a...".
+//  3. The client POSTs messages to that URL. SSESessions decodes each body
+//     with Codec and calls the owning connection's HandleMessage, then
+//     replies 202 Accepted. Responses, if any, travel over the SSE stream.
+//
+// Messages for a session are handled one at a time, in arrival order, like
+// messages read from a WebSocket. Unknown or expired sessions get 404.
+//
+// Usage:
+//
+//	sessions := gohttp.NewSSESessions[MyInput, MyOutput](codec, "/messages")
+//	router.HandleFunc("/sse", gohttp.SSEServe[MyOutput](handler, &gohttp.SSEConnConfig{
+//	    KeepalivePeriod: 30 * time.Second,
+//	    Sessions:        sessions,
+//	}))
+//	router.Handle("/messages", sessions)
+//
+// Connections must implement SSEInputConn[I] and embed BaseSSEConn.
+type SSESessions[I any, O any] struct {
+	// Codec decodes POSTed message bodies. Only Decode is used.
+	Codec Codec[I, O]
+
+	// Endpoint is the path (or absolute URL) where this handler is mounted.
+	// The session ID is appended as a query parameter.
+	Endpoint string
+
+	// SessionParam is the query parameter carrying the session ID.
+	// Default: "sessionId".
+	SessionParam string
+
+	// IdleTimeout expires a session, and closes its stream, when no message
+	// has been POSTed and no event has been sent down the stream for this
+	// long. Keepalives do not count. Zero means sessions live as long as
+	// their stream.
+	IdleTimeout time.Duration
+
+	// MaxBodySize caps the size of a POSTed message. Default: 4 MB.
+	MaxBodySize int64
+
+	// Hub, when set, is used to resolve a session's connection at delivery
+	// time, so a connection that has been unregistered from the hub no
+	// longer receives messages even if its session is still open.
+	Hub *SSEHub[O]
+
+	mu       sync.Mutex
+	sessions map[string]*sseSession[I]
+}
+
+// sseSession is one open client-to-server channel.
+type sseSession[I any] struct {
+	connId  string
+	handler SSEInputConn[I]
+	closer  interface{ Close() }
+
+	// handleMu serializes HandleMessage calls for the session.
+	handleMu sync.Mutex
+	idle     *time.Timer
+}
+
+// NewSSESessions creates an SSESessions that decodes messages with codec
+// and is mounted at endpoint.
+func NewSSESessions[I any, O any](codec Codec[I, O], endpoint string) *SSESessions[I, O] {
+	return &SSESessions[I, O]{
+		Codec:    codec,
+		Endpoint: endpoint,
+	}
+}
+
+// OpenSession implements SSESessionRegistry.
+func (s *SSESessions[I, O]) OpenSession(conn any, r *http.Request) (string, string, error) {
+	handler, ok := conn.(SSEInputConn[I])
+	if !ok {
+		var zero I
+		return "", "", fmt.Errorf("SSESessions: connection type %T does not implement SSEInputConn[%T]", conn, zero)
+	}
+	sess := &sseSession[I]{handler: handler}
+	if c, ok := conn.(interface{ ConnId() string }); ok {
+		sess.connId = c.ConnId()
+	}
+	sess.closer, _ = conn.(interface{ Close() })
+
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("SSESessions: invalid endpoint %q: %w", s.Endpoint, err)
+	}
+	id := GenerateSessionID()
+	query := endpoint.Query()
+	query.Set(s.sessionParam(), id)
+	endpoint.RawQuery = query.Encode()
+
+	s.mu.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]*sseSession[I])
+	}
+	s.sessions[id] = sess
+	if s.IdleTimeout > 0 {
+		sess.idle = time.AfterFunc(s.IdleTimeout, func() { s.expire(id) })
+	}
+	s.mu.Unlock()
+	if reporter, ok := conn.(sseActivityReporter); ok && s.IdleTimeout > 0 {
+		reporter.setActivityHook(func() { s.touch(id) })
+	}
+	return id, endpoint.String(), nil
+}
+
+// touch resets a session's idle timer.
+func (s *SSESessions[I, O]) touch(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[sessionID]; ok && sess.idle != nil {
+		sess.idle.Reset(s.IdleTimeout)
+	}
+}
+
+// CloseSession implements SSESessionRegistry.
+func (s *SSESessions[I, O]) CloseSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[sessionID]; ok {
+		if sess.idle != nil {
+			sess.idle.Stop()
+		}
+		delete(s.sessions, sessionID)
+	}
+}
+
+// Count returns the number of open sessions.
+func (s *SSESessions[I, O]) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// expire ends an idle session and closes its stream.
+func (s *SSESessions[I, O]) expire(sessionID string) {
+	s.mu.Lock()
+	sess, ok := s.sessions[sessionID]
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	log.Printf("SSESessions: session %s expired after %v idle", sessionID, s.IdleTimeout)
+	if sess.closer != nil {
+		sess.closer.Close()
+	}
+}
+
+// ServeHTTP handles POSTed client messages:
+//   - 405 for methods other than POST
+//   - 400 if the session parameter is missing or the body does not decode
+//   - 404 if the session is unknown or has expired
+//   - 413 if the body exceeds MaxBodySize
+//   - 500 if HandleMessage returns an error
+//   - 202 Accepted once the message has been handled
+func (s *SSESessions[I, O]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sessionID := r.URL.Query().Get(s.sessionParam())
+	if sessionID == "" {
+		http.Error(w, "missing "+s.sessionParam(), http.StatusBadRequest)
+		return
+	}
+	sess, handler, ok := s.lookup(sessionID)
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	maxBody := s.MaxBodySize
+	if maxBody <= 0 {
+		maxBody = 4 << 20
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read message", http.StatusBadRequest)
+		return
+	}
+	msg, err := s.Codec.Decode(body, postMessageType(r))
+	if err != nil {
+		http.Error(w, "invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess.handleMu.Lock()
+	err = handler.HandleMessage(msg)
+	sess.handleMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// lookup returns the live session for sessionID and the connection that
+// should handle its messages, resetting the idle timer. With a Hub
+// configured, the connection is resolved through the hub and must still be
+// registered there.
+func (s *SSESessions[I, O]) lookup(sessionID string) (*sseSession[I], SSEInputConn[I], bool) {
+	s.mu.Lock()
+	sess, ok := s.sessions[sessionID]
+	if ok && sess.idle != nil {
+		sess.idle.Reset(s.IdleTimeout)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil, false
+	}
+	if s.Hub == nil {
+		return sess, sess.handler, true
+	}
+	conn, ok := s.Hub.Get(sess.connId)
+	if !ok {
+		return nil, nil, false
+	}
+	handler, ok := conn.(SSEInputConn[I])
+	if !ok {
+		return nil, nil, false
+	}
+	return sess, handler, true
+}
+
+func (s *SSESessions[I, O]) sessionParam() string {
+	if s.SessionParam == "" {
+		return "sessionId"
+	}
+	return s.SessionParam
+}
+
+// postMessageType maps the request Content-Type to the MessageType passed to
+// Codec.Decode: binary for protobuf and octet-stream bodies, text otherwise.
+func postMessageType(r *http.Request) MessageType {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/octet-stream", "application/protobuf", "application/x-protobuf":
+		return BinaryMessage
+	}
+	return TextMessage
+}
+
+// Compile-time interface compliance check
+var _ SSESessionRegistry = (*SSESessions[any, any])(nil)
@@ -0,0 +1,218 @@
+package http
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// echoSSEConn echoes every POSTed message back over its SSE stream.
+type echoSSEConn struct {
+	NotifierSSEConn
+}
+
+func (c *echoSSEConn) HandleMessage(msg any) error {
+	c.SendEvent("echo", msg)
+	return nil
+}
+
+type echoSSEHandler struct {
+	connChan chan *echoSSEConn
+}
+
+func (h *echoSSEHandler) Validate(w http.ResponseWriter, r *http.Request) (*echoSSEConn, bool) {
+	conn := &echoSSEConn{NotifierSSEConn{
+		BaseSSEConn: BaseSSEConn[any]{Codec: &JSONCodec{}, NameStr: "EchoSSEConn"},
+		closedChan:  make(chan struct{}),
+		startedChan: make(chan struct{}),
+	}}
+	h.connChan <- conn
+	return conn, true
+}
+
+// newSessionTestServer mounts an SSE stream at /sse paired with sessions
+// at /messages.
+func newSessionTestServer(t *testing.T, sessions *SSESessions[any, any], config *SSEConnConfig) (*httptest.Server, *echoSSEHandler) {
+	t.Helper()
+	handler := &echoSSEHandler{connChan: make(chan *echoSSEConn, 1)}
+	if config == nil {
+		config = &SSEConnConfig{}
+	}
+	config.Sessions = sessions
+	router := mux.NewRouter()
+	router.HandleFunc("/sse", SSEServe[any](handler, config))
+	router.Handle("/messages", sessions)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, handler
+}
+
+// openSession connects to the stream and returns the reader and the
+// endpoint URL announced by the server.
+func openSession(t *testing.T, server *httptest.Server) (*http.Response, *bufio.Reader, string) {
+	t.Helper()
+	resp := connectSSE(t, server.URL+"/sse")
+	reader := bufio.NewReader(resp.Body)
+	ev, err := readSSEEvent(t, reader, 2*time.Second)
+	if err != nil {
+		t.Fatalf("read endpoint event: %v", err)
+	}
+	if ev.Event != "endpoint" || !strings.HasPrefix(ev.Data, "/messages?sessionId=") {
+		t.Fatalf("first event = %+v, want endpoint", ev)
+	}
+	return resp, reader, ev.Data
+}
+
+func postMessage(t *testing.T, url, body string) int {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// TestSSESessionRoundTrip verifies the full paired-transport flow: endpoint
+// event, POST decoded with the Codec and handled by the owning connection,
+// and the reply delivered over the stream.
+func TestSSESessionRoundTrip(t *testing.T) {
+	sessions := NewSSESessions[any, any](&JSONCodec{}, "/messages")
+	server, _ := newSessionTestServer(t, sessions, nil)
+
+	resp, reader, endpoint := openSession(t, server)
+	defer resp.Body.Close()
+
+	if code := postMessage(t, server.URL+endpoint, `{"hello":"world"}`); code != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want 202", code)
+	}
+	ev, err := readSSEEvent(t, reader, 2*time.Second)
+	if err != nil {
+		t.Fatalf("read echo: %v", err)
+	}
+	if ev.Event != "echo" || ev.Data != `{"hello":"world"}` {
+		t.Errorf("echo event = %+v", ev)
+	}
+}
+
+// TestSSESessionErrors verifies status codes for unknown sessions, bad
+// bodies, wrong methods, and sessions whose stream has ended.
+func TestSSESessionErrors(t *testing.T) {
+	sessions := NewSSESessions[any, any](&JSONCodec{}, "/messages")
+	server, handler := newSessionTestServer(t, sessions, nil)
+
+	if code := postMessage(t, server.URL+"/messages?sessionId=nope", `{}`); code != http.StatusNotFound {
+		t.Errorf("unknown session status = %d, want 404", code)
+	}
+	if code := postMessage(t, server.URL+"/messages", `{}`); code != http.StatusBadRequest {
+		t.Errorf("missing session status = %d, want 400", code)
+	}
+
+	resp, _, endpoint := openSession(t, server)
+	conn := <-handler.connChan
+	if code := postMessage(t, server.URL+endpoint, `{not json`); code != http.StatusBadRequest {
+		t.Errorf("bad body status = %d, want 400", code)
+	}
+	getResp, err := http.Get(server.URL + endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getResp.Body.Close()
+	if getResp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want 405", getResp.StatusCode)
+	}
+
+	resp.Body.Close()
+	<-conn.closedChan
+	deadline := time.Now().Add(2 * time.Second)
+	for sessions.Count() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if code := postMessage(t, server.URL+endpoint, `{}`); code != http.StatusNotFound {
+		t.Errorf("closed session status = %d, want 404", code)
+	}
+}
+
+// TestSSESessionIdleExpiry verifies that an idle session expires, its
+// stream is closed, and further POSTs get 404.
+func TestSSESessionIdleExpiry(t *testing.T) {
+	sessions := NewSSESessions[any, any](&JSONCodec{}, "/messages")
+	sessions.IdleTimeout = 50 * time.Millisecond
+	server, handler := newSessionTestServer(t, sessions, nil)
+
+	resp, _, endpoint := openSession(t, server)
+	defer resp.Body.Close()
+	conn := <-handler.connChan
+
+	select {
+	case <-conn.closedChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream not closed after idle timeout")
+	}
+	if code := postMessage(t, server.URL+endpoint, `{}`); code != http.StatusNotFound {
+		t.Errorf("expired session status = %d, want 404", code)
+	}
+}
+
+// TestSSESessionIdleResetBySends verifies that events sent down the stream
+// keep a session alive even when nothing is POSTed.
+func TestSSESessionIdleResetBySends(t *testing.T) {
+	sessions := NewSSESessions[any, any](&JSONCodec{}, "/messages")
+	sessions.IdleTimeout = 100 * time.Millisecond
+	server, handler := newSessionTestServer(t, sessions, nil)
+
+	resp, reader, endpoint := openSession(t, server)
+	defer resp.Body.Close()
+	conn := <-handler.connChan
+
+	for i := range 8 {
+		conn.SendEvent("push", i)
+		if _, err := readSSEEvent(t, reader, 2*time.Second); err != nil {
+			t.Fatalf("read push %d: %v", i, err)
+		}
+		select {
+		case <-conn.closedChan:
+			t.Fatalf("stream closed after push %d while still active", i)
+		case <-time.After(40 * time.Millisecond):
+		}
+	}
+	if code := postMessage(t, server.URL+endpoint, `{}`); code != http.StatusAccepted {
+		t.Errorf("active session status = %d, want 202", code)
+	}
+
+	select {
+	case <-conn.closedChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream not closed once sends stopped")
+	}
+}
+
+// TestSSESessionViaHub verifies that with a Hub configured, messages are
+// routed through the hub and stop once the connection is unregistered.
+func TestSSESessionViaHub(t *testing.T) {
+	hub := NewSSEHub[any]()
+	sessions := NewSSESessions[any, any](&JSONCodec{}, "/messages")
+	sessions.Hub = hub
+	server, handler := newSessionTestServer(t, sessions, &SSEConnConfig{Hub: hub})
+
+	resp, reader, endpoint := openSession(t, server)
+	defer resp.Body.Close()
+	conn := <-handler.connChan
+
+	if code := postMessage(t, server.URL+endpoint, `1`); code != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want 202", code)
+	}
+	if ev, err := readSSEEvent(t, reader, 2*time.Second); err != nil || ev.Data != "1" {
+		t.Fatalf("echo = %+v, %v", ev, err)
+	}
+
+	hub.Unregister(conn.ConnId())
+	if code := postMessage(t, server.URL+endpoint, `2`); code != http.StatusNotFound {
+		t.Errorf("POST after unregister status = %d, want 404", code)
+	}
+}
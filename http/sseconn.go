@@ -3,13 +3,16 @@ package http
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	conc "github.com/panyam/gocurrent"
 	gut "github.com/panyam/goutils/utils"
+	"github.com/panyam/servicekit/middleware"
 )
 
 // ============================================================================
@@ -27,6 +30,57 @@ type SSEConnConfig struct {
 	//
 	// See WHATWG SSE spec: https://html.spec.whatwg.org/multipage/server-sent-events.html#parsing-an-event-stream
 	KeepalivePeriod time.Duration
+
+	// EventStore, when set, enables automatic stream resumption. Every event
+	// sent via SendOutput, SendEvent or SendEventWithID is assigned an ID
+	// (if it has none), encoded once and persisted under the connection's
+	// stream ID. When a client reconnects with a Last-Event-ID header, the
+	// events it missed are replayed before live delivery resumes.
+	//
+	// Only connections embedding BaseSSEConn participate; other SSEConn
+	// implementations are served without resumption. Default: nil (disabled).
+	//
+	// See WHATWG SSE spec: https://html.spec.whatwg.org/multipage/server-sent-events.html#the-last-event-id-string
+	EventStore EventStore
+
+	// StreamID resolves the EventStore stream that a request reads from and
+	// writes to. It must return the same value for a client across
+	// reconnects — typically a session, user or subscription ID.
+	//
+	// Connections that share a stream ID share its history: a hub
+	// broadcast is stored once per stream, and an event sent to one
+	// connection is replayed to any client resuming that stream.
+	//
+	// Required when EventStore is set; SSEServe panics without it.
+	StreamID func(r *http.Request) string
+
+	// IDGen assigns IDs to events sent without one. It is shared by every
+	// connection served by the handler so IDs stay unique across reconnects.
+	//
+	// If nil, SSEServe creates one AtomicIDGen per handler. Only used when
+	// EventStore is set.
+	IDGen IDGen
+
+	// Hub, when set, receives every connection served by SSEServe: the
+	// connection is registered once it has started (and any replay has
+	// been queued) and unregistered when the handler exits, before OnClose.
+	// Use an *SSEHub[O] whose O matches the handler's output type; other
+	// connections are rejected. Default: nil (no automatic registration).
+	Hub SSEConnRegistry
+
+	// Metadata builds the metadata a connection is registered with (user,
+	// topics, remote IP, labels). The topics are subscribed on registration.
+	// If nil, or if it leaves RemoteIP empty, RemoteIP is filled in from
+	// middleware.ClientIP. Only used when Hub is set.
+	Metadata func(r *http.Request) SSEConnMeta
+
+	// Sessions, when set, pairs each stream with a client-to-server
+	// channel: SSEServe opens a session for the connection and sends an
+	// "endpoint" event whose data is the session-scoped URL the client
+	// POSTs messages to. The session is closed when the stream ends. Use
+	// an *SSESessions[I, O], which also serves the POST endpoint.
+	// Default: nil (stream only).
+	Sessions SSESessionRegistry
 }
 
 // DefaultSSEConnConfig returns an SSEConnConfig with sensible defaults:
@@ -80,8 +134,67 @@ type SSEOutgoingMessage[O any] struct {
 	// Comment is an SSE comment line (for keepalive). Mutually exclusive with Data.
 	// Sent as ": {comment}\n\n".
 	Comment string
+
+	// RawData is a pre-encoded payload written as the "data:" field without
+	// going through the Codec. Used to deliver events persisted in an
+	// EventStore, which are stored already encoded. Ignored if Data is set.
+	RawData []byte
+
+	// Frame is a complete, pre-framed event written to the wire verbatim.
+	// Frames are shared between connections (see SSEFrame), so the Writer
+	// never re-encodes or re-formats them. Takes precedence over Data,
+	// RawData and Retry.
+	Frame *SSEFrame
+}
+
+// SSEFrame is an event that has been encoded and formatted in SSE wire
+// format exactly once, so it can be delivered to any number of connections
+// without per-connection work. SSEHub uses frames for Broadcast and Publish:
+// a broadcast to 10k clients encodes its payload once instead of 10k times.
+//
+// A frame is immutable once created and safe for concurrent use; the Writer
+// of every connection it is sent to writes the same underlying bytes.
+type SSEFrame struct {
+	event string
+	id    string
+	data  []byte
+	wire  []byte
+}
+
+// NewSSEFrame formats an already-encoded payload as an SSE event. Multi-line
+// data is split into separate "data:" lines. The frame takes ownership of
+// data; the caller must not modify it afterwards.
+func NewSSEFrame(event, id string, data []byte) *SSEFrame {
+	return &SSEFrame{
+		event: event,
+		id:    id,
+		data:  data,
+		wire:  appendSSEFrame(nil, event, id, 0, data),
+	}
 }
 
+// EncodeSSEFrame encodes msg with codec and formats it as an SSE event.
+func EncodeSSEFrame[O any](codec Codec[any, O], event, id string, msg O) (*SSEFrame, error) {
+	data, _, err := codec.Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	return NewSSEFrame(event, id, data), nil
+}
+
+// Event returns the SSE event type of the frame ("" for unnamed events).
+func (f *SSEFrame) Event() string { return f.event }
+
+// ID returns the SSE event ID of the frame ("" if none).
+func (f *SSEFrame) ID() string { return f.id }
+
+// Data returns the encoded payload. The returned slice must not be modified.
+func (f *SSEFrame) Data() []byte { return f.data }
+
+// Bytes returns the complete wire representation, including the blank line
+// that terminates the event. The returned slice must not be modified.
+func (f *SSEFrame) Bytes() []byte { return f.wire }
+
 // ============================================================================
 // SSEConn Interface
 // ============================================================================
@@ -176,6 +289,22 @@ type BaseSSEConn[O any] struct {
 	// Used by SSEServe to detect programmatic close via Close().
 	done     chan struct{}
 	doneOnce sync.Once
+
+	// Resumption state, attached by SSEServe when SSEConnConfig.EventStore
+	// is set. sendMu serializes ID assignment, storage and enqueueing so the
+	// store order always matches the wire order. Until resume runs, events
+	// are stored but held in pending instead of being written, so replayed
+	// and live events never overlap.
+	sendMu   sync.Mutex
+	store    EventStore
+	streamID string
+	idgen    IDGen
+	live     bool
+	pending  []StoredEvent
+
+	// activity, when set, is called for every data event sent. SSESessions
+	// uses it to keep a session alive while its stream is in use.
+	activity func()
 }
 
 // Name returns the connection name.
@@ -194,6 +323,12 @@ func (b *BaseSSEConn[O]) ConnId() string {
 	return b.ConnIdStr
 }
 
+// OutputCodec returns the Codec used to encode outgoing messages. SSEHub
+// uses it to encode a broadcast once for all connections sharing a codec.
+func (b *BaseSSEConn[O]) OutputCodec() Codec[any, O] {
+	return b.Codec
+}
+
 // OnStart initializes the SSE connection. It asserts that the ResponseWriter
 // supports http.Flusher (required for streaming), then creates the Writer
 // with SSE-format dispatch.
@@ -226,39 +361,37 @@ func (b *BaseSSEConn[O]) OnStart(w http.ResponseWriter, r *http.Request) error {
 			return nil
 		}
 
+		// Handle shared pre-framed events (e.g., SSEHub broadcasts)
+		if msg.Frame != nil {
+			if _, err := w.Write(msg.Frame.wire); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+
 		// Handle bare retry hint (no data). Used by SendRetry to change the
 		// client's reconnection delay without delivering application data.
-		if msg.Data == nil && msg.Retry > 0 {
+		if msg.Data == nil && msg.RawData == nil && msg.Retry > 0 {
 			fmt.Fprintf(w, "retry: %d\n\n", msg.Retry)
 			flusher.Flush()
 			return nil
 		}
 
+		// Handle pre-encoded payloads (e.g., events replayed from an EventStore)
+		if msg.Data == nil && msg.RawData != nil {
+			writeSSEFrame(w, msg.Event, msg.ID, msg.Retry, msg.RawData)
+			flusher.Flush()
+			return nil
+		}
+
 		// Handle data messages
 		if msg.Data != nil {
 			data, _, err := b.Codec.Encode(*msg.Data)
 			if err != nil {
 				return err
 			}
-
-			if msg.Event != "" {
-				fmt.Fprintf(w, "event: %s\n", msg.Event)
-			}
-			if msg.ID != "" {
-				fmt.Fprintf(w, "id: %s\n", msg.ID)
-			}
-			// Retry is emitted before data so clients that parse
-			// field-by-field see the hint alongside the event payload.
-			// Per SSE spec, negative or zero values are dropped.
-			if msg.Retry > 0 {
-				fmt.Fprintf(w, "retry: %d\n", msg.Retry)
-			}
-
-			// Per SSE spec, multi-line data must be split into separate data: lines
-			for _, line := range bytes.Split(data, []byte("\n")) {
-				fmt.Fprintf(w, "data: %s\n", line)
-			}
-			fmt.Fprint(w, "\n") // blank line terminates the event
+			writeSSEFrame(w, msg.Event, msg.ID, msg.Retry, data)
 			flusher.Flush()
 		}
 		return nil
@@ -268,6 +401,47 @@ func (b *BaseSSEConn[O]) OnStart(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// writeSSEFrame writes a single event in SSE wire format with one Write.
+func writeSSEFrame(w io.Writer, event, id string, retry int, data []byte) {
+	w.Write(appendSSEFrame(nil, event, id, retry, data))
+}
+
+// appendSSEFrame appends a single event in SSE wire format to dst. Retry is
+// emitted before data so clients that parse field-by-field see the hint
+// alongside the event payload; per SSE spec, zero or negative values are
+// dropped. Multi-line data is split into separate "data:" lines.
+func appendSSEFrame(dst []byte, event, id string, retry int, data []byte) []byte {
+	if dst == nil {
+		dst = make([]byte, 0, len(data)+len(event)+len(id)+32)
+	}
+	if event != "" {
+		dst = append(dst, "event: "...)
+		dst = append(dst, event...)
+		dst = append(dst, '\n')
+	}
+	if id != "" {
+		dst = append(dst, "id: "...)
+		dst = append(dst, id...)
+		dst = append(dst, '\n')
+	}
+	if retry > 0 {
+		dst = append(dst, "retry: "...)
+		dst = strconv.AppendInt(dst, int64(retry), 10)
+		dst = append(dst, '\n')
+	}
+	for {
+		line, rest, more := bytes.Cut(data, []byte("\n"))
+		dst = append(dst, "data: "...)
+		dst = append(dst, line...)
+		dst = append(dst, '\n')
+		if !more {
+			break
+		}
+		data = rest
+	}
+	return append(dst, '\n') // blank line terminates the event
+}
+
 // initReady ensures the ready channel is created exactly once.
 func (b *BaseSSEConn[O]) initReady() {
 	b.readyOnce.Do(func() {
@@ -311,9 +485,7 @@ func (b *BaseSSEConn[O]) OnClose() {
 // This is a convenience method for sending events without a named type.
 // For named events, use SendEvent or SendEventWithID.
 func (b *BaseSSEConn[O]) SendOutput(msg O) {
-	if b.Writer != nil {
-		b.Writer.Send(SSEOutgoingMessage[O]{Data: &msg})
-	}
+	b.send("", "", msg)
 }
 
 // SendEvent sends a named event to the client. The event type is set via
@@ -322,9 +494,7 @@ func (b *BaseSSEConn[O]) SendOutput(msg O) {
 // Per WHATWG SSE spec, if no event type is specified, clients receive the
 // event via the "message" event handler.
 func (b *BaseSSEConn[O]) SendEvent(event string, msg O) {
-	if b.Writer != nil {
-		b.Writer.Send(SSEOutgoingMessage[O]{Data: &msg, Event: event})
-	}
+	b.send(event, "", msg)
 }
 
 // SendEventWithID sends a named event with an ID. The ID is set via the
@@ -335,9 +505,146 @@ func (b *BaseSSEConn[O]) SendEvent(event string, msg O) {
 // on reconnection, the browser includes "Last-Event-ID: {id}" so the server
 // can resume the event stream from the correct position.
 func (b *BaseSSEConn[O]) SendEventWithID(event string, id string, msg O) {
+	b.send(event, id, msg)
+}
+
+// send delivers a data event. Without an EventStore the message is queued to
+// the Writer as-is. With an EventStore attached, the message is encoded once,
+// given an ID if it has none, persisted, and then either written or held
+// until resume has replayed the events the client missed.
+func (b *BaseSSEConn[O]) send(event, id string, msg O) {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	if b.activity != nil {
+		b.activity()
+	}
+
+	if b.store == nil {
+		if b.Writer != nil {
+			b.Writer.Send(SSEOutgoingMessage[O]{Data: &msg, Event: event, ID: id})
+		}
+		return
+	}
+
+	data, _, err := b.Codec.Encode(msg)
+	if err != nil {
+		log.Printf("SSE %s: failed to encode event: %v", b.ConnId(), err)
+		return
+	}
+	b.storeAndSendLocked(event, id, data)
+}
+
+// SendFrame sends a pre-encoded, pre-framed event. The frame's bytes are
+// written as-is, so sending one frame to many connections costs a single
+// encode. This is what SSEHub uses for Broadcast and Publish.
+//
+// With an EventStore attached the frame cannot be shared verbatim, because
+// each connection assigns its own event ID: the already-encoded payload is
+// stored and framed for this connection, but still not re-encoded.
+func (b *BaseSSEConn[O]) SendFrame(frame *SSEFrame) {
+	b.sendSharedFrame(frame, nil)
+}
+
+// sendSharedFrame is SendFrame for one delivery of a hub broadcast. With an
+// EventStore attached, the frame is stored once per stream across the
+// broadcast: a connection whose stream already holds it reuses the stored
+// event and its ID.
+func (b *BaseSSEConn[O]) sendSharedFrame(frame *SSEFrame, broadcast *sseBroadcast) {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	if b.activity != nil {
+		b.activity()
+	}
+
+	if b.store == nil {
+		if b.Writer != nil {
+			b.Writer.Send(SSEOutgoingMessage[O]{Frame: frame})
+		}
+		return
+	}
+	if stored, ok := broadcast.lookup(b.store, b.streamID); ok {
+		b.sendStoredLocked(stored)
+		return
+	}
+	stored := b.storeLocked(frame.event, frame.id, frame.data)
+	broadcast.record(b.store, b.streamID, stored)
+	b.sendStoredLocked(stored)
+}
+
+// storeAndSendLocked assigns an ID if needed, persists an encoded event, and
+// writes or holds it depending on whether resume has run. Caller holds
+// sendMu and b.store is set.
+func (b *BaseSSEConn[O]) storeAndSendLocked(event, id string, data []byte) {
+	b.sendStoredLocked(b.storeLocked(event, id, data))
+}
+
+// storeLocked assigns an ID if needed and persists an encoded event. Caller
+// holds sendMu and b.store is set.
+func (b *BaseSSEConn[O]) storeLocked(event, id string, data []byte) StoredEvent {
+	if id == "" {
+		id = b.idgen.Next()
+	}
+	stored := StoredEvent{ID: id, Event: event, Data: data}
+	if err := b.store.Store(b.streamID, stored); err != nil {
+		log.Printf("SSE %s: failed to store event %s: %v", b.ConnId(), id, err)
+	}
+	return stored
+}
+
+// sendStoredLocked writes a stored event, or holds it until resume has run.
+// Caller holds sendMu.
+func (b *BaseSSEConn[O]) sendStoredLocked(stored StoredEvent) {
+	if !b.live {
+		b.pending = append(b.pending, stored)
+		return
+	}
+	b.writeStored(stored)
+}
+
+// writeStored queues a persisted event to the Writer. Caller holds sendMu.
+func (b *BaseSSEConn[O]) writeStored(ev StoredEvent) {
 	if b.Writer != nil {
-		b.Writer.Send(SSEOutgoingMessage[O]{Data: &msg, Event: event, ID: id})
+		b.Writer.Send(SSEOutgoingMessage[O]{RawData: ev.Data, Event: ev.Event, ID: ev.ID})
+	}
+}
+
+// attachEventStore enables resumption for this connection. Called by
+// SSEServe before OnStart; events sent from then on are stored and held
+// until resume is called.
+func (b *BaseSSEConn[O]) attachEventStore(store EventStore, streamID string, idgen IDGen) {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	b.store = store
+	b.streamID = streamID
+	b.idgen = idgen
+	b.live = false
+	b.pending = nil
+}
+
+// resume switches the connection to live delivery. If lastEventID is set,
+// the events stored after it are replayed first (this includes anything
+// sent since attachEventStore, since those were stored too). Otherwise only
+// the events held since attachEventStore are flushed. Holding sendMu for the
+// whole switch guarantees no live event is written before or interleaved
+// with the replay.
+func (b *BaseSSEConn[O]) resume(lastEventID string) error {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+
+	events := b.pending
+	var err error
+	if lastEventID != "" && b.store != nil {
+		var replayed []StoredEvent
+		if replayed, err = b.store.Replay(b.streamID, lastEventID); err == nil {
+			events = replayed
+		}
 	}
+	for _, ev := range events {
+		b.writeStored(ev)
+	}
+	b.pending = nil
+	b.live = true
+	return err
 }
 
 // SendKeepalive sends an SSE comment as a keepalive signal. The comment
@@ -391,6 +698,45 @@ func (b *BaseSSEConn[O]) InputChan() chan<- SSEOutgoingMessage[O] {
 	return nil
 }
 
+// sendDirect queues a frame without storing it in the EventStore, for
+// control events that must not be replayed.
+func (b *BaseSSEConn[O]) sendDirect(frame *SSEFrame) {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	if b.Writer != nil {
+		b.Writer.Send(SSEOutgoingMessage[O]{Frame: frame})
+	}
+}
+
+// setActivityHook registers fn to be called for every data event sent.
+// Keepalives and control events do not count as activity.
+func (b *BaseSSEConn[O]) setActivityHook(fn func()) {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	b.activity = fn
+}
+
+// sseDirectSender is implemented by BaseSSEConn (and so by any type
+// embedding it). SSEServe uses it to send the Sessions endpoint event.
+type sseDirectSender interface {
+	sendDirect(frame *SSEFrame)
+}
+
+// sseResumable is implemented by BaseSSEConn (and so by any type embedding
+// it). SSEServe uses it to wire SSEConnConfig.EventStore into a connection
+// without widening the public SSEConn interface.
+type sseResumable interface {
+	attachEventStore(store EventStore, streamID string, idgen IDGen)
+	resume(lastEventID string) error
+}
+
+// sseActivityReporter is implemented by BaseSSEConn (and so by any type
+// embedding it). SSESessions uses it to reset a session's idle timer when
+// events are sent down its stream.
+type sseActivityReporter interface {
+	setActivityHook(fn func())
+}
+
 // ============================================================================
 // SSEHandler — Factory interface
 // ============================================================================
@@ -428,8 +774,15 @@ type SSEHandler[O any, S SSEConn[O]] interface {
 //  1. handler.Validate() is called to check the request
 //  2. SSE headers are set (Content-Type, Cache-Control, etc.)
 //  3. conn.OnStart() is called to initialize the connection
-//  4. Keepalive comments are sent at the configured interval
-//  5. On client disconnect (context cancellation), conn.OnClose() is called
+//  4. If an EventStore is configured, events missed since the client's
+//     Last-Event-ID are replayed before live delivery starts
+//  5. If a Hub is configured, the connection is registered with it
+//  6. If Sessions is configured, a session is opened and an "endpoint"
+//     event with its POST URL is sent
+//  7. Keepalive comments are sent at the configured interval
+//  8. On client disconnect (context cancellation), the session is closed,
+//     the connection is unregistered from the Hub and conn.OnClose() is
+//     called
 //
 // Important: Set http.Server.WriteTimeout = 0 for SSE endpoints to prevent
 // the server from closing long-lived connections. See middleware.ApplyDefaults.
@@ -439,12 +792,29 @@ func SSEServe[O any, S SSEConn[O]](handler SSEHandler[O, S], config *SSEConnConf
 	if config == nil {
 		config = DefaultSSEConnConfig()
 	}
+	if config.EventStore != nil && config.StreamID == nil {
+		panic("SSEServe: SSEConnConfig.StreamID is required when EventStore is set")
+	}
+	idgen := config.IDGen
+	if config.EventStore != nil && idgen == nil {
+		idgen = &AtomicIDGen{}
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		conn, valid := handler.Validate(w, r)
 		if !valid {
 			return
 		}
 
+		// Attach the event store before OnStart so that anything the
+		// connection sends during startup is stored and held for resume.
+		var resumable sseResumable
+		if config.EventStore != nil {
+			if rc, ok := any(conn).(sseResumable); ok {
+				rc.attachEventStore(config.EventStore, config.StreamID(r), idgen)
+				resumable = rc
+			}
+		}
+
 		// Set SSE response headers per the WHATWG spec
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
@@ -458,6 +828,49 @@ func SSEServe[O any, S SSEConn[O]](handler SSEHandler[O, S], config *SSEConnConf
 		}
 		defer conn.OnClose()
 
+		// Replay missed events (if the client sent Last-Event-ID) ahead of
+		// any live event, then switch to live delivery.
+		if resumable != nil {
+			if err := resumable.resume(r.Header.Get("Last-Event-ID")); err != nil {
+				log.Printf("SSE %s: replay failed: %v", conn.ConnId(), err)
+			}
+		}
+
+		// Register with the hub only once the connection can deliver, and
+		// unregister before OnClose stops the Writer.
+		if config.Hub != nil {
+			meta := SSEConnMeta{}
+			if config.Metadata != nil {
+				meta = config.Metadata(r)
+			}
+			if meta.RemoteIP == "" {
+				meta.RemoteIP = middleware.ClientIP(r)
+			}
+			if err := config.Hub.RegisterServed(conn, meta); err != nil {
+				log.Printf("SSE %s: hub registration failed: %v", conn.ConnId(), err)
+				return
+			}
+			defer config.Hub.UnregisterServed(conn)
+		}
+
+		// Open the paired POST channel and tell the client where it is.
+		// The endpoint event bypasses the EventStore: each stream gets a
+		// fresh session, so a replayed endpoint would point at a dead one.
+		if config.Sessions != nil {
+			sender, ok := any(conn).(sseDirectSender)
+			if !ok {
+				log.Printf("SSE %s: %T cannot send an endpoint event", conn.ConnId(), conn)
+				return
+			}
+			sessionID, endpoint, err := config.Sessions.OpenSession(conn, r)
+			if err != nil {
+				log.Printf("SSE %s: opening session failed: %v", conn.ConnId(), err)
+				return
+			}
+			defer config.Sessions.CloseSession(sessionID)
+			sender.sendDirect(NewSSEFrame("endpoint", "", []byte(endpoint)))
+		}
+
 		// Note: header flush happens inside OnStart, before the Writer
 		// goroutine is created, to avoid concurrent ResponseWriter access.
 
@@ -511,4 +924,8 @@ func (h *JSONSSEHandler) Validate(w http.ResponseWriter, r *http.Request) (*JSON
 // Compile-time interface compliance checks
 // ============================================================================
 
-var _ SSEConn[any] = (*BaseSSEConn[any])(nil)
+var (
+	_ SSEConn[any]    = (*BaseSSEConn[any])(nil)
+	_ sseResumable    = (*BaseSSEConn[any])(nil)
+	_ sseDirectSender = (*BaseSSEConn[any])(nil)
+)
@@ -0,0 +1,228 @@
+package http
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// newResumeTestServer starts an SSE endpoint backed by the given store, with
+// the stream ID taken from the "stream" query parameter so that reconnects
+// from the same client land on the same stream.
+func newResumeTestServer(t *testing.T, handler *NotifierSSEHandler, store EventStore) *httptest.Server {
+	t.Helper()
+	config := &SSEConnConfig{
+		EventStore: store,
+		StreamID:   func(r *http.Request) string { return r.URL.Query().Get("stream") },
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/events", SSEServe[any](handler, config))
+	return httptest.NewServer(router)
+}
+
+// connectSSEWithLastID opens an SSE stream, sending Last-Event-ID if set.
+func connectSSEWithLastID(t *testing.T, url, lastEventID string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect to SSE endpoint: %v", err)
+	}
+	return resp
+}
+
+// TestSSEResumeAssignsIDs verifies that with an EventStore configured,
+// SendEvent assigns sequential IDs, writes them on the wire, and persists
+// each event under the resolved stream ID.
+func TestSSEResumeAssignsIDs(t *testing.T) {
+	store := NewMemoryEventStore(100)
+	handler := &NotifierSSEHandler{connChan: make(chan *NotifierSSEConn, 1)}
+	server := newResumeTestServer(t, handler, store)
+	defer server.Close()
+
+	resp := connectSSEWithLastID(t, server.URL+"/events?stream=s1", "")
+	defer resp.Body.Close()
+	conn := waitForSSEConn(t, handler.connChan)
+	reader := bufio.NewReader(resp.Body)
+
+	conn.SendEvent("update", map[string]any{"n": 1})
+	conn.SendOutput(map[string]any{"n": 2})
+
+	for _, want := range []string{"1", "2"} {
+		ev, err := readSSEEvent(t, reader, 2*time.Second)
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		if ev.ID != want {
+			t.Errorf("ID = %q, want %q", ev.ID, want)
+		}
+	}
+
+	stored, _ := store.Replay("s1", "")
+	if len(stored) != 2 {
+		t.Fatalf("Expected 2 stored events, got %d", len(stored))
+	}
+	if stored[0].Event != "update" || string(stored[0].Data) != `{"n":1}` {
+		t.Errorf("Unexpected first stored event: %+v", stored[0])
+	}
+}
+
+// TestSSEResumeReplaysMissedEvents verifies that a client reconnecting with
+// Last-Event-ID receives exactly the events after that ID, followed by live
+// events whose IDs continue the sequence (no gaps, no duplicates).
+func TestSSEResumeReplaysMissedEvents(t *testing.T) {
+	store := NewMemoryEventStore(100)
+	handler := &NotifierSSEHandler{connChan: make(chan *NotifierSSEConn, 1)}
+	server := newResumeTestServer(t, handler, store)
+	defer server.Close()
+
+	// First connection: three events are sent, the client only reads one.
+	resp := connectSSEWithLastID(t, server.URL+"/events?stream=s1", "")
+	conn := waitForSSEConn(t, handler.connChan)
+	for i := 1; i <= 3; i++ {
+		conn.SendOutput(map[string]any{"n": i})
+	}
+	ev, err := readSSEEvent(t, bufio.NewReader(resp.Body), 2*time.Second)
+	if err != nil || ev.ID != "1" {
+		t.Fatalf("first read = %+v, %v; want ID 1", ev, err)
+	}
+	resp.Body.Close()
+	<-conn.closedChan
+
+	// Reconnect from ID 1: expect 2 and 3 replayed, then live 4.
+	resp = connectSSEWithLastID(t, server.URL+"/events?stream=s1", "1")
+	defer resp.Body.Close()
+	conn = waitForSSEConn(t, handler.connChan)
+	conn.SendOutput(map[string]any{"n": 4})
+
+	reader := bufio.NewReader(resp.Body)
+	for _, want := range []string{"2", "3", "4"} {
+		ev, err := readSSEEvent(t, reader, 2*time.Second)
+		if err != nil {
+			t.Fatalf("read event %s: %v", want, err)
+		}
+		if ev.ID != want {
+			t.Errorf("ID = %q, want %q", ev.ID, want)
+		}
+	}
+}
+
+// TestSSEResumeNoDuplicatesDuringStartup verifies that an event sent after
+// Validate but before replay completes is delivered exactly once, whether or
+// not the client is resuming.
+func TestSSEResumeNoDuplicatesDuringStartup(t *testing.T) {
+	for _, lastID := range []string{"", "0"} {
+		store := NewMemoryEventStore(100)
+		if lastID != "" {
+			store.Store("s1", StoredEvent{ID: lastID, Data: []byte(`{}`)})
+		}
+		handler := &earlySendSSEHandler{NotifierSSEHandler{connChan: make(chan *NotifierSSEConn, 1)}}
+		config := &SSEConnConfig{
+			EventStore: store,
+			IDGen:      &AtomicIDGen{},
+			StreamID:   func(r *http.Request) string { return "s1" },
+		}
+		server := httptest.NewServer(SSEServe[any](handler, config))
+
+		resp := connectSSEWithLastID(t, server.URL, lastID)
+		conn := waitForSSEConn(t, handler.connChan)
+		conn.SendEvent("live", map[string]any{})
+
+		reader := bufio.NewReader(resp.Body)
+		for _, want := range []string{"early", "live"} {
+			ev, err := readSSEEvent(t, reader, 2*time.Second)
+			if err != nil {
+				t.Fatalf("lastID=%q: read %s: %v", lastID, want, err)
+			}
+			if ev.Event != want {
+				t.Errorf("lastID=%q: event = %q, want %q", lastID, ev.Event, want)
+			}
+		}
+		resp.Body.Close()
+		server.Close()
+	}
+}
+
+// earlySendSSEHandler sends an event from Validate, before OnStart has
+// created the Writer, to exercise the held-until-resume path.
+type earlySendSSEHandler struct {
+	NotifierSSEHandler
+}
+
+func (h *earlySendSSEHandler) Validate(w http.ResponseWriter, r *http.Request) (*NotifierSSEConn, bool) {
+	conn := newNotifierSSEConn()
+	go func() {
+		// Validate returns before SSEServe attaches the store, so send from
+		// the first point the connection is guaranteed to be attached.
+		<-conn.Ready()
+		conn.SendEvent("early", map[string]any{})
+		h.connChan <- conn
+	}()
+	return conn, true
+}
+
+// TestSSEResumeSharedStreamBroadcast verifies that a hub broadcast to two
+// connections sharing a stream is stored once, so a client resuming the
+// stream gets it replayed exactly once.
+func TestSSEResumeSharedStreamBroadcast(t *testing.T) {
+	store := NewMemoryEventStore(100)
+	store.Store("room", StoredEvent{ID: "0", Data: []byte(`{}`)})
+	hub := NewSSEHub[any]()
+	handler := &NotifierSSEHandler{connChan: make(chan *NotifierSSEConn, 1)}
+	server := httptest.NewServer(SSEServe[any](handler, &SSEConnConfig{
+		EventStore: store,
+		StreamID:   func(r *http.Request) string { return "room" },
+		Hub:        hub,
+	}))
+	defer server.Close()
+
+	for range 2 {
+		resp := connectSSEWithLastID(t, server.URL, "")
+		defer resp.Body.Close()
+		waitForSSEConn(t, handler.connChan)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	hub.BroadcastEvent("news", map[string]any{})
+
+	resp := connectSSEWithLastID(t, server.URL, "0")
+	defer resp.Body.Close()
+	conn := waitForSSEConn(t, handler.connChan)
+	conn.SendEvent("marker", map[string]any{})
+
+	reader := bufio.NewReader(resp.Body)
+	var events []string
+	for len(events) == 0 || events[len(events)-1] != "marker" {
+		ev, err := readSSEEvent(t, reader, 2*time.Second)
+		if err != nil {
+			t.Fatalf("read after %v: %v", events, err)
+		}
+		events = append(events, ev.Event)
+	}
+	if len(events) != 2 || events[0] != "news" {
+		t.Errorf("events = %v, want [news marker]", events)
+	}
+}
+
+// TestSSEServeRequiresStreamID verifies that an EventStore without a
+// StreamID is rejected when the handler is built.
+func TestSSEServeRequiresStreamID(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("SSEServe accepted EventStore without StreamID")
+		}
+	}()
+	SSEServe[any](&NotifierSSEHandler{}, &SSEConnConfig{EventStore: NewMemoryEventStore(10)})
+}
@@ -1,7 +1,11 @@
 package http
 
 import (
+	"fmt"
 	"log"
+	"net/http"
+	"reflect"
+	"strings"
 	"sync"
 )
 
@@ -18,10 +22,14 @@ import (
 //
 //	hub := gohttp.NewSSEHub[MyEvent]()
 //
-//	// In your SSEConn.OnStart:
-//	hub.Register(conn)
+//	// Let SSEServe register and unregister connections:
+//	router.HandleFunc("/events", gohttp.SSEServe[MyEvent](handler, &gohttp.SSEConnConfig{
+//	    KeepalivePeriod: 30 * time.Second,
+//	    Hub:             hub,
+//	}))
 //
-//	// In your SSEConn.OnClose:
+//	// Or manage registration yourself, e.g. in OnStart / OnClose:
+//	hub.Register(conn)
 //	hub.Unregister(conn.ConnId())
 //
 //	// From application code:
@@ -30,37 +38,181 @@ import (
 //
 //	// On graceful shutdown:
 //	hub.CloseAll()
+//
+// # Topics
+//
+// Connections can subscribe to topics, and Publish delivers only to
+// subscribers. Topics are dot-separated names such as "game.42.moves".
+// Subscription patterns may use wildcards (see MatchTopic), so a connection
+// subscribed to "game.*" receives events published to "game.42":
+//
+//	// In your SSEConn.OnStart:
+//	hub.Register(conn)
+//	hub.Subscribe(conn.ConnId(), TopicsFromRequest(r, "topic")...)
+//
+//	// From application code:
+//	hub.Publish("game.42", "move", MyEvent{...})
+//
+// A per-connection filter (SetFilter) can further drop published events
+// server-side, e.g. to hide events the user is not authorized to see.
+//
+// # Metadata
+//
+// Each connection carries SSEConnMeta (user, topics, remote IP, labels),
+// supplied via RegisterWithMeta or SSEConnConfig.Metadata. ConnsForUser and
+// FindConns look connections up by metadata, e.g. to notify every tab a
+// user has open.
 type SSEHub[O any] struct {
 	mu    sync.RWMutex
-	conns map[string]*BaseSSEConn[O]
+	conns map[string]*sseHubEntry[O]
+
+	// users maps SSEConnMeta.User to the IDs of that user's connections.
+	users map[string]map[string]struct{}
+
+	// exact maps a literal topic to the IDs of connections subscribed to it.
+	// patterns does the same for wildcard patterns, which are matched against
+	// each published topic. Keeping them apart means the common case (exact
+	// topics) is a map lookup rather than a scan.
+	exact    map[string]map[string]struct{}
+	patterns map[string]map[string]struct{}
+}
+
+// SSEFilter decides whether a published event should be delivered to a
+// connection. It is called with the topic the event was published to.
+// Return false to drop the event for that connection.
+type SSEFilter[O any] func(topic, event string, msg O) bool
+
+// SSEHubConn is the connection type an SSEHub stores: an SSEConn that can
+// deliver data events. Any type embedding BaseSSEConn[O] implements it, so
+// custom connection types can be registered directly without unwrapping.
+type SSEHubConn[O any] interface {
+	SSEConn[O]
+
+	// OutputCodec returns the Codec used to encode messages, so the hub can
+	// encode a broadcast once per codec (see SSEFrame).
+	OutputCodec() Codec[any, O]
+
+	SendOutput(msg O)
+	SendEvent(event string, msg O)
+	SendEventWithID(event, id string, msg O)
+	SendFrame(frame *SSEFrame)
+}
+
+// SSEConnMeta describes a registered connection. All fields are optional.
+type SSEConnMeta struct {
+	// User identifies the authenticated user that owns the connection.
+	User string
+
+	// Topics are subscribed when the connection is registered. When
+	// returned by Meta, Topics holds the current subscriptions instead.
+	Topics []string
+
+	// RemoteIP is the client address the connection was opened from.
+	RemoteIP string
+
+	// Labels holds application-defined key/value metadata.
+	Labels map[string]string
+}
+
+// SSEConnRegistry receives connections served by SSEServe when set as
+// SSEConnConfig.Hub. *SSEHub[O] implements it; conn is the value returned
+// by SSEHandler.Validate.
+type SSEConnRegistry interface {
+	// RegisterServed adds conn with its metadata. It returns an error if
+	// conn is not a connection type the registry can hold.
+	RegisterServed(conn any, meta SSEConnMeta) error
+
+	// UnregisterServed removes conn if it is still the connection
+	// registered under its ID.
+	UnregisterServed(conn any)
+}
+
+// sseHubEntry is a registered connection plus its subscription state.
+type sseHubEntry[O any] struct {
+	conn   SSEHubConn[O]
+	meta   SSEConnMeta
+	topics map[string]struct{}
+	filter SSEFilter[O]
 }
 
 // NewSSEHub creates a new SSEHub for managing SSE connections.
 func NewSSEHub[O any]() *SSEHub[O] {
 	return &SSEHub[O]{
-		conns: make(map[string]*BaseSSEConn[O]),
+		conns:    make(map[string]*sseHubEntry[O]),
+		users:    make(map[string]map[string]struct{}),
+		exact:    make(map[string]map[string]struct{}),
+		patterns: make(map[string]map[string]struct{}),
 	}
 }
 
 // Register adds an SSE connection to the hub, keyed by its ConnId.
 // If a connection with the same ID already exists, it is replaced (the old
-// connection is NOT closed — the caller is responsible for lifecycle management).
-func (h *SSEHub[O]) Register(conn *BaseSSEConn[O]) {
+// connection is NOT closed — the caller is responsible for lifecycle management)
+// and its subscriptions are dropped.
+func (h *SSEHub[O]) Register(conn SSEHubConn[O]) {
+	h.RegisterWithMeta(conn, SSEConnMeta{})
+}
+
+// RegisterWithMeta is like Register but attaches metadata to the
+// connection and subscribes it to meta.Topics.
+func (h *SSEHub[O]) RegisterWithMeta(conn SSEHubConn[O], meta SSEConnMeta) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := conn.ConnId()
+	h.removeLocked(id)
+	topics := meta.Topics
+	meta.Topics = nil
+	h.conns[id] = &sseHubEntry[O]{conn: conn, meta: meta, topics: make(map[string]struct{})}
+	if meta.User != "" {
+		ids := h.users[meta.User]
+		if ids == nil {
+			ids = make(map[string]struct{})
+			h.users[meta.User] = ids
+		}
+		ids[id] = struct{}{}
+	}
+	h.subscribeLocked(id, topics)
+	log.Printf("SSEHub: registered connection %s (total: %d)", id, len(h.conns))
+}
+
+// RegisterServed implements SSEConnRegistry for use as SSEConnConfig.Hub.
+func (h *SSEHub[O]) RegisterServed(conn any, meta SSEConnMeta) error {
+	c, ok := conn.(SSEHubConn[O])
+	if !ok {
+		var zero O
+		return fmt.Errorf("SSEHub[%T]: connection type %T does not implement SSEHubConn", zero, conn)
+	}
+	h.RegisterWithMeta(c, meta)
+	return nil
+}
+
+// UnregisterServed implements SSEConnRegistry. Unlike Unregister, it leaves
+// the hub untouched if another connection has since been registered under
+// the same ID.
+func (h *SSEHub[O]) UnregisterServed(conn any) {
+	c, ok := conn.(SSEHubConn[O])
+	if !ok {
+		return
+	}
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.conns[conn.ConnId()] = conn
-	log.Printf("SSEHub: registered connection %s (total: %d)", conn.ConnId(), len(h.conns))
+	id := c.ConnId()
+	if e, ok := h.conns[id]; ok && e.conn == c {
+		h.removeLocked(id)
+		log.Printf("SSEHub: unregistered connection %s (total: %d)", id, len(h.conns))
+	}
 }
 
 // Unregister removes an SSE connection from the hub by its ConnId.
 // The connection's OnClose is NOT called — the caller manages the connection
 // lifecycle (typically SSEServe handles OnClose via defer).
 //
-// Unregistering a nonexistent ID is a no-op.
+// Unregistering a nonexistent ID is a no-op. The connection's topic
+// subscriptions are removed along with it.
 func (h *SSEHub[O]) Unregister(connId string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	delete(h.conns, connId)
+	h.removeLocked(connId)
 	log.Printf("SSEHub: unregistered connection %s (total: %d)", connId, len(h.conns))
 }
 
@@ -68,9 +220,7 @@ func (h *SSEHub[O]) Unregister(connId string) {
 // Returns true if the connection was found and the message was queued.
 // Returns false if the connection ID does not exist (no error, no panic).
 func (h *SSEHub[O]) Send(connId string, msg O) bool {
-	h.mu.RLock()
-	conn, ok := h.conns[connId]
-	h.mu.RUnlock()
+	conn, ok := h.lookup(connId)
 	if !ok {
 		return false
 	}
@@ -83,9 +233,7 @@ func (h *SSEHub[O]) Send(connId string, msg O) bool {
 // Returns true if the connection was found and the message was queued.
 // Returns false if the connection ID does not exist.
 func (h *SSEHub[O]) SendEvent(connId string, event string, msg O) bool {
-	h.mu.RLock()
-	conn, ok := h.conns[connId]
-	h.mu.RUnlock()
+	conn, ok := h.lookup(connId)
 	if !ok {
 		return false
 	}
@@ -96,22 +244,18 @@ func (h *SSEHub[O]) SendEvent(connId string, event string, msg O) bool {
 // Broadcast sends a message to all registered connections. The message is
 // queued to each connection's Writer independently, so a slow connection
 // does not block others.
+//
+// The message is encoded and framed once per distinct Codec (see SSEFrame),
+// not once per connection. Connections should share a single Codec instance
+// to get the full benefit.
 func (h *SSEHub[O]) Broadcast(msg O) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	for _, conn := range h.conns {
-		conn.SendOutput(msg)
-	}
+	h.BroadcastEventWithID("", "", msg)
 }
 
 // BroadcastEvent sends a named event to all registered connections.
 // The event type is set via the SSE "event:" field.
 func (h *SSEHub[O]) BroadcastEvent(event string, msg O) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	for _, conn := range h.conns {
-		conn.SendEvent(event, msg)
-	}
+	h.BroadcastEventWithID(event, "", msg)
 }
 
 // SendEventWithID delivers a named event with an ID to a specific connection.
@@ -120,9 +264,7 @@ func (h *SSEHub[O]) BroadcastEvent(event string, msg O) {
 // Returns true if the connection was found and the message was queued.
 // Returns false if the connection ID does not exist.
 func (h *SSEHub[O]) SendEventWithID(connId, event, id string, msg O) bool {
-	h.mu.RLock()
-	conn, ok := h.conns[connId]
-	h.mu.RUnlock()
+	conn, ok := h.lookup(connId)
 	if !ok {
 		return false
 	}
@@ -133,10 +275,26 @@ func (h *SSEHub[O]) SendEventWithID(connId, event, id string, msg O) bool {
 // BroadcastEventWithID sends a named event with an ID to all registered
 // connections. The ID is set via the SSE "id:" field.
 func (h *SSEHub[O]) BroadcastEventWithID(event, id string, msg O) {
+	frames := newSSEFrameCache(event, id, msg)
+	broadcast := &sseBroadcast{}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, e := range h.conns {
+		if frame := frames.get(e.conn); frame != nil {
+			sendBroadcastFrame(e.conn, frame, broadcast)
+		}
+	}
+}
+
+// BroadcastFrame sends a pre-built frame to all registered connections.
+// Use this when the same event is broadcast repeatedly, or when the payload
+// was encoded elsewhere.
+func (h *SSEHub[O]) BroadcastFrame(frame *SSEFrame) {
+	broadcast := &sseBroadcast{}
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	for _, conn := range h.conns {
-		conn.SendEventWithID(event, id, msg)
+	for _, e := range h.conns {
+		sendBroadcastFrame(e.conn, frame, broadcast)
 	}
 }
 
@@ -154,9 +312,404 @@ func (h *SSEHub[O]) Count() int {
 func (h *SSEHub[O]) CloseAll() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	for id, conn := range h.conns {
-		conn.OnClose()
+	for id, e := range h.conns {
+		e.conn.OnClose()
 		delete(h.conns, id)
 	}
+	clear(h.users)
+	clear(h.exact)
+	clear(h.patterns)
 	log.Printf("SSEHub: closed all connections")
 }
+
+// Subscribe adds topics (or wildcard patterns) to a connection's
+// subscriptions. Subscribing to a topic the connection already has is a
+// no-op. Returns false if the connection ID does not exist.
+func (h *SSEHub[O]) Subscribe(connId string, topics ...string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.subscribeLocked(connId, topics)
+}
+
+// subscribeLocked implements Subscribe. Caller holds h.mu.
+func (h *SSEHub[O]) subscribeLocked(connId string, topics []string) bool {
+	e, ok := h.conns[connId]
+	if !ok {
+		return false
+	}
+	for _, topic := range topics {
+		if topic == "" {
+			continue
+		}
+		e.topics[topic] = struct{}{}
+		index := h.indexFor(topic)
+		subs := index[topic]
+		if subs == nil {
+			subs = make(map[string]struct{})
+			index[topic] = subs
+		}
+		subs[connId] = struct{}{}
+	}
+	return true
+}
+
+// Unsubscribe removes topics (or patterns) from a connection's
+// subscriptions. Topics must match exactly what was passed to Subscribe;
+// unsubscribing "game.*" does not remove a subscription to "game.42".
+// Returns false if the connection ID does not exist.
+func (h *SSEHub[O]) Unsubscribe(connId string, topics ...string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.conns[connId]
+	if !ok {
+		return false
+	}
+	for _, topic := range topics {
+		delete(e.topics, topic)
+		h.unindexLocked(connId, topic)
+	}
+	return true
+}
+
+// Topics returns the topics and patterns a connection is subscribed to, in
+// no particular order. Returns nil if the connection ID does not exist.
+func (h *SSEHub[O]) Topics(connId string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	e, ok := h.conns[connId]
+	if !ok {
+		return nil
+	}
+	topics := make([]string, 0, len(e.topics))
+	for topic := range e.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// SetFilter installs a filter that is consulted for every event published
+// to this connection; pass nil to remove it. Filters apply to Publish only;
+// Send and Broadcast are explicit and always deliver.
+// Returns false if the connection ID does not exist.
+func (h *SSEHub[O]) SetFilter(connId string, filter SSEFilter[O]) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.conns[connId]
+	if !ok {
+		return false
+	}
+	e.filter = filter
+	return true
+}
+
+// Publish delivers an event to every connection subscribed to topic, either
+// directly or through a matching wildcard pattern. Each subscriber receives
+// the event at most once, even if several of its subscriptions match, and
+// connections whose filter rejects the event are skipped. An empty event
+// name sends an unnamed event (like Broadcast). As with Broadcast, the
+// message is encoded once per distinct Codec.
+//
+// Returns the number of connections the event was queued to.
+func (h *SSEHub[O]) Publish(topic, event string, msg O) int {
+	frames := newSSEFrameCache(event, "", msg)
+	broadcast := &sseBroadcast{}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	delivered := 0
+	for id := range h.subscribersLocked(topic) {
+		e := h.conns[id]
+		if e.filter != nil && !e.filter(topic, event, msg) {
+			continue
+		}
+		if frame := frames.get(e.conn); frame != nil {
+			sendBroadcastFrame(e.conn, frame, broadcast)
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// SubscriberCount returns the number of connections that would receive an
+// event published to topic, before filters are applied.
+func (h *SSEHub[O]) SubscriberCount(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribersLocked(topic))
+}
+
+// subscribersLocked returns the set of connection IDs subscribed to topic
+// directly or via a matching pattern. Caller holds h.mu. The returned map
+// may be an index entry and must not be modified.
+func (h *SSEHub[O]) subscribersLocked(topic string) map[string]struct{} {
+	direct := h.exact[topic]
+	if len(h.patterns) == 0 {
+		return direct
+	}
+	targets := make(map[string]struct{}, len(direct))
+	for id := range direct {
+		targets[id] = struct{}{}
+	}
+	for pattern, subs := range h.patterns {
+		if MatchTopic(pattern, topic) {
+			for id := range subs {
+				targets[id] = struct{}{}
+			}
+		}
+	}
+	return targets
+}
+
+// Get returns the connection registered under connId.
+func (h *SSEHub[O]) Get(connId string) (SSEHubConn[O], bool) {
+	return h.lookup(connId)
+}
+
+// Meta returns the metadata of a registered connection, with Topics set to
+// its current subscriptions.
+func (h *SSEHub[O]) Meta(connId string) (SSEConnMeta, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	e, ok := h.conns[connId]
+	if !ok {
+		return SSEConnMeta{}, false
+	}
+	return e.metaLocked(), true
+}
+
+// ConnsForUser returns the connections registered with meta.User == user,
+// in no particular order.
+func (h *SSEHub[O]) ConnsForUser(user string) []SSEHubConn[O] {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var conns []SSEHubConn[O]
+	for id := range h.users[user] {
+		conns = append(conns, h.conns[id].conn)
+	}
+	return conns
+}
+
+// FindConns returns the connections whose metadata satisfies match, in no
+// particular order. match is called with the hub's lock held and must not
+// call back into the hub.
+func (h *SSEHub[O]) FindConns(match func(connId string, meta SSEConnMeta) bool) []SSEHubConn[O] {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var conns []SSEHubConn[O]
+	for id, e := range h.conns {
+		if match(id, e.metaLocked()) {
+			conns = append(conns, e.conn)
+		}
+	}
+	return conns
+}
+
+// metaLocked returns the entry's metadata with current subscriptions.
+// Caller holds the hub's lock.
+func (e *sseHubEntry[O]) metaLocked() SSEConnMeta {
+	meta := e.meta
+	meta.Topics = make([]string, 0, len(e.topics))
+	for topic := range e.topics {
+		meta.Topics = append(meta.Topics, topic)
+	}
+	return meta
+}
+
+// lookup returns the connection registered under connId.
+func (h *SSEHub[O]) lookup(connId string) (SSEHubConn[O], bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	e, ok := h.conns[connId]
+	if !ok {
+		return nil, false
+	}
+	return e.conn, true
+}
+
+// removeLocked deletes a connection, its subscriptions and its user index
+// entry. Caller holds h.mu.
+func (h *SSEHub[O]) removeLocked(connId string) {
+	e, ok := h.conns[connId]
+	if !ok {
+		return
+	}
+	for topic := range e.topics {
+		h.unindexLocked(connId, topic)
+	}
+	if ids, ok := h.users[e.meta.User]; ok {
+		delete(ids, connId)
+		if len(ids) == 0 {
+			delete(h.users, e.meta.User)
+		}
+	}
+	delete(h.conns, connId)
+}
+
+// unindexLocked removes connId from the subscriber set of topic, dropping the
+// set once it is empty. Caller holds h.mu.
+func (h *SSEHub[O]) unindexLocked(connId, topic string) {
+	index := h.indexFor(topic)
+	if subs, ok := index[topic]; ok {
+		delete(subs, connId)
+		if len(subs) == 0 {
+			delete(index, topic)
+		}
+	}
+}
+
+// indexFor returns the index a subscription belongs in: patterns for
+// anything containing a wildcard segment, exact otherwise.
+func (h *SSEHub[O]) indexFor(topic string) map[string]map[string]struct{} {
+	if isTopicPattern(topic) {
+		return h.patterns
+	}
+	return h.exact
+}
+
+// MatchTopic reports whether a dot-separated topic matches a subscription
+// pattern. In a pattern, a "*" segment matches exactly one topic segment and
+// a trailing "**" segment matches one or more remaining segments. Any other
+// segment must match literally.
+//
+//	MatchTopic("game.*", "game.42")             // true
+//	MatchTopic("game.*", "game.42.moves")       // false
+//	MatchTopic("game.**", "game.42.moves")      // true
+//	MatchTopic("game.*.moves", "game.42.moves") // true
+func MatchTopic(pattern, topic string) bool {
+	for {
+		pseg, prest, pmore := strings.Cut(pattern, ".")
+		if pseg == "**" && !pmore {
+			return topic != ""
+		}
+		tseg, trest, tmore := strings.Cut(topic, ".")
+		if pseg != "*" && pseg != tseg {
+			return false
+		}
+		if pmore != tmore {
+			return false
+		}
+		if !pmore {
+			return true
+		}
+		pattern, topic = prest, trest
+	}
+}
+
+// isTopicPattern reports whether topic contains a wildcard segment.
+func isTopicPattern(topic string) bool {
+	for seg := range strings.SplitSeq(topic, ".") {
+		if seg == "*" || seg == "**" {
+			return true
+		}
+	}
+	return false
+}
+
+// TopicsFromRequest extracts topic subscriptions from the query parameter
+// param, accepting both repeated parameters and comma-separated lists:
+// "?topic=a&topic=b" and "?topic=a,b" both yield ["a", "b"]. Empty entries
+// are skipped. Intended for use in SSEConn.Validate or OnStart.
+func TopicsFromRequest(r *http.Request, param string) []string {
+	var topics []string
+	for _, v := range r.URL.Query()[param] {
+		for topic := range strings.SplitSeq(v, ",") {
+			if topic = strings.TrimSpace(topic); topic != "" {
+				topics = append(topics, topic)
+			}
+		}
+	}
+	return topics
+}
+
+// sseFrameCache encodes a broadcast message at most once per distinct Codec.
+// Connections usually share one Codec instance (or use a comparable value
+// codec such as JSONCodec{}), in which case a broadcast costs one encode
+// regardless of the number of connections. Codecs whose dynamic type is not
+// comparable cannot be used as map keys and are encoded per connection.
+type sseFrameCache[O any] struct {
+	event  string
+	id     string
+	msg    O
+	frames map[any]*SSEFrame
+}
+
+func newSSEFrameCache[O any](event, id string, msg O) *sseFrameCache[O] {
+	return &sseFrameCache[O]{event: event, id: id, msg: msg}
+}
+
+// get returns the frame for conn's Codec, encoding it on first use. Returns
+// nil (after logging) if encoding fails, so the connection is skipped.
+func (c *sseFrameCache[O]) get(conn SSEHubConn[O]) *SSEFrame {
+	codec := conn.OutputCodec()
+	comparable := codec != nil && reflect.TypeOf(codec).Comparable()
+	if comparable {
+		if frame, ok := c.frames[codec]; ok {
+			return frame
+		}
+	}
+	frame, err := EncodeSSEFrame(codec, c.event, c.id, c.msg)
+	if err != nil {
+		log.Printf("SSEHub: failed to encode event for %s: %v", conn.ConnId(), err)
+		frame = nil
+	}
+	if comparable {
+		if c.frames == nil {
+			c.frames = make(map[any]*SSEFrame)
+		}
+		c.frames[codec] = frame
+	}
+	return frame
+}
+
+// sseBroadcast records, for one broadcast, the event stored in each
+// EventStore stream, so that connections sharing a stream store it once and
+// all write it with the same ID. A broadcast is delivered from a single
+// goroutine, so it needs no locking.
+type sseBroadcast struct {
+	stored map[sseStreamKey]StoredEvent
+}
+
+type sseStreamKey struct {
+	store    EventStore
+	streamID string
+}
+
+// lookup returns the event already stored in streamID for this broadcast.
+// A nil broadcast (a plain SendFrame) never has one.
+func (b *sseBroadcast) lookup(store EventStore, streamID string) (StoredEvent, bool) {
+	if b == nil || !reflect.TypeOf(store).Comparable() {
+		return StoredEvent{}, false
+	}
+	ev, ok := b.stored[sseStreamKey{store, streamID}]
+	return ev, ok
+}
+
+// record notes that ev was stored in streamID for this broadcast.
+func (b *sseBroadcast) record(store EventStore, streamID string, ev StoredEvent) {
+	if b == nil || !reflect.TypeOf(store).Comparable() {
+		return
+	}
+	if b.stored == nil {
+		b.stored = make(map[sseStreamKey]StoredEvent)
+	}
+	b.stored[sseStreamKey{store, streamID}] = ev
+}
+
+// sseSharedFrameSender is implemented by BaseSSEConn (and so by any type
+// embedding it). SSEHub uses it so a broadcast is stored once per stream.
+type sseSharedFrameSender interface {
+	sendSharedFrame(frame *SSEFrame, broadcast *sseBroadcast)
+}
+
+func sendBroadcastFrame[O any](conn SSEHubConn[O], frame *SSEFrame, broadcast *sseBroadcast) {
+	if shared, ok := conn.(sseSharedFrameSender); ok {
+		shared.sendSharedFrame(frame, broadcast)
+		return
+	}
+	conn.SendFrame(frame)
+}
+
+// Compile-time interface compliance checks
+var (
+	_ SSEHubConn[any] = (*BaseSSEConn[any])(nil)
+	_ SSEConnRegistry = (*SSEHub[any])(nil)
+)
@@ -1,11 +1,14 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -301,3 +304,490 @@ func TestSSEHubConcurrentAccess(t *testing.T) {
 	}
 }
 
+
+// ============================================================================
+// Topic subscription tests
+// ============================================================================
+
+// createCapturingSSEConn is like createTestSSEConn but also returns the mock
+// writer so tests can inspect what was written to the wire.
+func createCapturingSSEConn(t *testing.T, name string) (*BaseSSEConn[any], *mockResponseWriter) {
+	t.Helper()
+	conn := &BaseSSEConn[any]{Codec: &JSONCodec{}, NameStr: name, ConnIdStr: name}
+	w := newMockResponseWriter()
+	if err := conn.OnStart(w, httptest.NewRequest("GET", "/events", nil)); err != nil {
+		t.Fatalf("Failed to start SSE conn %q: %v", name, err)
+	}
+	return conn, w
+}
+
+// waitForOutput polls the mock writer until its output contains want.
+func waitForOutput(t *testing.T, w *mockResponseWriter, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		w.mu.Lock()
+		got := w.buf.String()
+		w.mu.Unlock()
+		if strings.Contains(got, want) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %q in output", want)
+}
+
+// outputOf returns everything written to the mock writer so far.
+func outputOf(w *mockResponseWriter) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+// TestMatchTopic covers exact, single-segment and trailing multi-segment
+// wildcard matching.
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"game.42", "game.42", true},
+		{"game.42", "game.43", false},
+		{"game", "game.42", false},
+		{"game.*", "game.42", true},
+		{"game.*", "game", false},
+		{"game.*", "game.42.moves", false},
+		{"game.*.moves", "game.42.moves", true},
+		{"game.*.moves", "game.42.chat", false},
+		{"*", "game", true},
+		{"game.**", "game.42", true},
+		{"game.**", "game.42.moves", true},
+		{"game.**", "game", false},
+		{"**", "anything.at.all", true},
+		{"chat.*", "game.42", false},
+	}
+	for _, tt := range tests {
+		if got := MatchTopic(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+// TestSSEHubPublish verifies that Publish delivers only to subscribers of
+// the topic, that wildcard subscribers receive matching topics, and that a
+// connection matched by several subscriptions receives the event once.
+func TestSSEHubPublish(t *testing.T) {
+	hub := NewSSEHub[any]()
+	game42, w42 := createCapturingSSEConn(t, "game42")
+	allGames, wAll := createCapturingSSEConn(t, "allGames")
+	chat, wChat := createCapturingSSEConn(t, "chat")
+	for _, c := range []*BaseSSEConn[any]{game42, allGames, chat} {
+		defer c.OnClose()
+		hub.Register(c)
+	}
+	hub.Subscribe("game42", "game.42")
+	hub.Subscribe("allGames", "game.*", "game.42")
+	hub.Subscribe("chat", "chat.*")
+
+	if n := hub.SubscriberCount("game.42"); n != 2 {
+		t.Errorf("SubscriberCount(game.42) = %d, want 2", n)
+	}
+	if n := hub.Publish("game.42", "move", map[string]any{"seq": 1}); n != 2 {
+		t.Errorf("Publish(game.42) delivered to %d, want 2", n)
+	}
+	if n := hub.Publish("game.7", "move", map[string]any{"seq": 2}); n != 1 {
+		t.Errorf("Publish(game.7) delivered to %d, want 1", n)
+	}
+	if n := hub.Publish("lobby", "", map[string]any{"seq": 3}); n != 0 {
+		t.Errorf("Publish(lobby) delivered to %d, want 0", n)
+	}
+
+	waitForOutput(t, wAll, `"seq":2`)
+	waitForOutput(t, w42, `"seq":1`)
+	if got := strings.Count(outputOf(wAll), `"seq":1`); got != 1 {
+		t.Errorf("allGames received seq 1 %d times, want 1", got)
+	}
+	if strings.Contains(outputOf(w42), `"seq":2`) {
+		t.Error("game42 should not receive game.7 events")
+	}
+	if strings.Contains(outputOf(wChat), "seq") {
+		t.Errorf("chat should receive nothing, got %q", outputOf(wChat))
+	}
+	if !strings.Contains(outputOf(w42), "event: move\n") {
+		t.Errorf("expected named event, got %q", outputOf(w42))
+	}
+}
+
+// TestSSEHubUnsubscribe verifies that Unsubscribe and Unregister remove
+// subscriptions so later publishes skip the connection.
+func TestSSEHubUnsubscribe(t *testing.T) {
+	hub := NewSSEHub[any]()
+	c1 := createTestSSEConn[any](t, &JSONCodec{}, "c1")
+	c2 := createTestSSEConn[any](t, &JSONCodec{}, "c2")
+	defer c1.OnClose()
+	defer c2.OnClose()
+	hub.Register(c1)
+	hub.Register(c2)
+	hub.Subscribe("c1", "a", "b.*")
+	hub.Subscribe("c2", "a")
+
+	hub.Unsubscribe("c1", "b.*")
+	if n := hub.SubscriberCount("b.x"); n != 0 {
+		t.Errorf("SubscriberCount(b.x) after Unsubscribe = %d, want 0", n)
+	}
+	if topics := hub.Topics("c1"); len(topics) != 1 || topics[0] != "a" {
+		t.Errorf("Topics(c1) = %v, want [a]", topics)
+	}
+
+	hub.Unregister("c2")
+	if n := hub.SubscriberCount("a"); n != 1 {
+		t.Errorf("SubscriberCount(a) after Unregister = %d, want 1", n)
+	}
+	if hub.Subscribe("c2", "a") {
+		t.Error("Subscribe should return false for unregistered connection")
+	}
+
+	// Re-registering under the same ID starts with no subscriptions.
+	hub.Register(c1)
+	if n := hub.SubscriberCount("a"); n != 0 {
+		t.Errorf("SubscriberCount(a) after re-register = %d, want 0", n)
+	}
+}
+
+// TestSSEHubFilter verifies that a per-connection filter can drop published
+// events, and that Broadcast bypasses filters.
+func TestSSEHubFilter(t *testing.T) {
+	hub := NewSSEHub[any]()
+	conn, w := createCapturingSSEConn(t, "filtered")
+	defer conn.OnClose()
+	hub.Register(conn)
+	hub.Subscribe("filtered", "game.*")
+	hub.SetFilter("filtered", func(topic, event string, msg any) bool {
+		return event != "secret"
+	})
+
+	if n := hub.Publish("game.1", "secret", map[string]any{"seq": 1}); n != 0 {
+		t.Errorf("filtered Publish delivered to %d, want 0", n)
+	}
+	hub.Publish("game.1", "public", map[string]any{"seq": 2})
+	hub.Broadcast(map[string]any{"seq": 3})
+
+	waitForOutput(t, w, `"seq":3`)
+	out := outputOf(w)
+	if strings.Contains(out, `"seq":1`) {
+		t.Errorf("filtered event was delivered: %q", out)
+	}
+	if !strings.Contains(out, `"seq":2`) {
+		t.Errorf("unfiltered event missing: %q", out)
+	}
+}
+
+// TestTopicsFromRequest verifies that repeated and comma-separated query
+// parameters are both accepted.
+func TestTopicsFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/events?topic=game.*,chat.1&topic=lobby&topic=", nil)
+	got := TopicsFromRequest(r, "topic")
+	if fmt.Sprint(got) != "[game.* chat.1 lobby]" {
+		t.Errorf("TopicsFromRequest = %v", got)
+	}
+}
+
+// ============================================================================
+// Pre-encoded broadcast tests
+// ============================================================================
+
+// countingCodec is a JSON codec that counts Encode calls.
+type countingCodec struct {
+	JSONCodec
+	encodes atomic.Int64
+}
+
+func (c *countingCodec) Encode(msg any) ([]byte, MessageType, error) {
+	c.encodes.Add(1)
+	return c.JSONCodec.Encode(msg)
+}
+
+// TestSSEFrameFormat verifies the wire format of a pre-built frame,
+// including multi-line data.
+func TestSSEFrameFormat(t *testing.T) {
+	frame := NewSSEFrame("update", "7", []byte("line1\nline2"))
+	want := "event: update\nid: 7\ndata: line1\ndata: line2\n\n"
+	if got := string(frame.Bytes()); got != want {
+		t.Errorf("frame = %q, want %q", got, want)
+	}
+	if frame.Event() != "update" || frame.ID() != "7" || string(frame.Data()) != "line1\nline2" {
+		t.Errorf("unexpected frame fields: %q %q %q", frame.Event(), frame.ID(), frame.Data())
+	}
+}
+
+// TestSSEHubBroadcastEncodesOnce verifies that a broadcast to many
+// connections sharing a Codec encodes the message exactly once, and every
+// connection receives identical bytes.
+func TestSSEHubBroadcastEncodesOnce(t *testing.T) {
+	hub := NewSSEHub[any]()
+	codec := &countingCodec{}
+	writers := make([]*mockResponseWriter, 5)
+	for i := range writers {
+		conn := &BaseSSEConn[any]{Codec: codec, ConnIdStr: fmt.Sprintf("c%d", i)}
+		writers[i] = newMockResponseWriter()
+		if err := conn.OnStart(writers[i], httptest.NewRequest("GET", "/events", nil)); err != nil {
+			t.Fatal(err)
+		}
+		defer conn.OnClose()
+		hub.Register(conn)
+		hub.Subscribe(conn.ConnId(), "news")
+	}
+
+	hub.BroadcastEvent("tick", map[string]any{"n": 1})
+	hub.Publish("news", "", map[string]any{"n": 2})
+
+	want := "event: tick\ndata: {\"n\":1}\n\ndata: {\"n\":2}\n\n"
+	for i, w := range writers {
+		waitForOutput(t, w, `{"n":2}`)
+		if got := outputOf(w); got != want {
+			t.Errorf("conn %d output = %q, want %q", i, got, want)
+		}
+	}
+	if n := codec.encodes.Load(); n != 2 {
+		t.Errorf("Encode called %d times, want 2 (once per broadcast)", n)
+	}
+}
+
+// TestSSEHubBroadcastWithEventStore verifies that connections with an
+// EventStore attached still get per-connection IDs and storage when sent a
+// shared frame, without re-encoding the payload.
+func TestSSEHubBroadcastWithEventStore(t *testing.T) {
+	hub := NewSSEHub[any]()
+	codec := &countingCodec{}
+	store := NewMemoryEventStore(10)
+	conn := &BaseSSEConn[any]{Codec: codec, ConnIdStr: "resumable"}
+	conn.attachEventStore(store, "s1", &AtomicIDGen{})
+	w := newMockResponseWriter()
+	if err := conn.OnStart(w, httptest.NewRequest("GET", "/events", nil)); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.OnClose()
+	conn.resume("")
+	hub.Register(conn)
+
+	hub.Broadcast(map[string]any{"n": 1})
+
+	waitForOutput(t, w, `{"n":1}`)
+	if got := outputOf(w); got != "id: 1\ndata: {\"n\":1}\n\n" {
+		t.Errorf("output = %q", got)
+	}
+	if stored, _ := store.Replay("s1", ""); len(stored) != 1 || stored[0].ID != "1" {
+		t.Errorf("stored = %+v", stored)
+	}
+	if n := codec.encodes.Load(); n != 1 {
+		t.Errorf("Encode called %d times, want 1", n)
+	}
+}
+
+// flushCountingWriter is a ResponseWriter that discards output and signals
+// once a target number of flushes (one per event) has been reached.
+type flushCountingWriter struct {
+	header  http.Header
+	flushes atomic.Int64
+	target  atomic.Int64
+	reached chan struct{}
+}
+
+func (w *flushCountingWriter) Header() http.Header         { return w.header }
+func (w *flushCountingWriter) WriteHeader(int)             {}
+func (w *flushCountingWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *flushCountingWriter) Flush() {
+	if w.flushes.Add(1) == w.target.Load() {
+		w.reached <- struct{}{}
+	}
+}
+
+// benchmarkSSEBroadcast broadcasts b.N messages to conns connections and
+// waits for every Writer to flush them. legacy selects the per-connection
+// encode path that Broadcast used before frames were introduced.
+func benchmarkSSEBroadcast(b *testing.B, conns int, legacy bool) {
+	hub := NewSSEHub[any]()
+	codec := &JSONCodec{}
+	writers := make([]*flushCountingWriter, conns)
+	all := make([]*BaseSSEConn[any], conns)
+	for i := range writers {
+		writers[i] = &flushCountingWriter{header: make(http.Header), reached: make(chan struct{}, 1)}
+		writers[i].target.Store(int64(b.N) + 1) // +1 for the header flush in OnStart
+		all[i] = &BaseSSEConn[any]{Codec: codec, ConnIdStr: fmt.Sprintf("c%d", i)}
+		if err := all[i].OnStart(writers[i], httptest.NewRequest("GET", "/events", nil)); err != nil {
+			b.Fatal(err)
+		}
+		defer all[i].OnClose()
+		hub.Register(all[i])
+	}
+	msg := map[string]any{
+		"type":    "game.update",
+		"players": []string{"alice", "bob", "carol", "dave"},
+		"board":   strings.Repeat("x.o.", 64),
+		"turn":    42,
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if legacy {
+			for _, c := range all {
+				c.SendOutput(msg)
+			}
+		} else {
+			hub.Broadcast(msg)
+		}
+	}
+	for _, w := range writers {
+		<-w.reached
+	}
+}
+
+// BenchmarkSSEHubBroadcast compares encoding once per connection (the old
+// Broadcast path) with encoding once per broadcast into a shared frame.
+func BenchmarkSSEHubBroadcast(b *testing.B) {
+	for _, conns := range []int{100, 1000} {
+		b.Run(fmt.Sprintf("PerConnEncode/conns=%d", conns), func(b *testing.B) {
+			benchmarkSSEBroadcast(b, conns, true)
+		})
+		b.Run(fmt.Sprintf("SharedFrame/conns=%d", conns), func(b *testing.B) {
+			benchmarkSSEBroadcast(b, conns, false)
+		})
+	}
+}
+
+// ============================================================================
+// Auto-registration and metadata tests
+// ============================================================================
+
+// waitForCount polls until the hub has n connections.
+func waitForCount[O any](t *testing.T, hub *SSEHub[O], n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Count() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("hub count = %d, want %d", hub.Count(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestSSEServeAutoRegistersWithHub verifies that SSEServe registers a custom
+// connection type (embedding BaseSSEConn) with the configured hub, applies
+// its metadata and topics, and unregisters it when the client disconnects.
+func TestSSEServeAutoRegistersWithHub(t *testing.T) {
+	hub := NewSSEHub[any]()
+	handler := &NotifierSSEHandler{connChan: make(chan *NotifierSSEConn, 1)}
+	config := &SSEConnConfig{
+		Hub: hub,
+		Metadata: func(r *http.Request) SSEConnMeta {
+			return SSEConnMeta{
+				User:   r.Header.Get("X-User"),
+				Topics: TopicsFromRequest(r, "topic"),
+			}
+		},
+	}
+	server := httptest.NewServer(SSEServe[any](handler, config))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"?topic=game.*", nil)
+	req.Header.Set("X-User", "alice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	conn := waitForSSEConn(t, handler.connChan)
+	waitForCount(t, hub, 1)
+
+	meta, ok := hub.Meta(conn.ConnId())
+	if !ok {
+		t.Fatal("connection not registered under its ConnId")
+	}
+	if meta.User != "alice" || meta.RemoteIP != "127.0.0.1" || fmt.Sprint(meta.Topics) != "[game.*]" {
+		t.Errorf("meta = %+v", meta)
+	}
+	if got, _ := hub.Get(conn.ConnId()); got != SSEHubConn[any](conn) {
+		t.Errorf("Get returned %v, want the NotifierSSEConn itself", got)
+	}
+
+	hub.Publish("game.1", "move", map[string]any{"n": 1})
+	ev, err := readSSEEvent(t, bufio.NewReader(resp.Body), 2*time.Second)
+	if err != nil || ev.Event != "move" {
+		t.Fatalf("read = %+v, %v", ev, err)
+	}
+
+	resp.Body.Close()
+	<-conn.closedChan
+	waitForCount(t, hub, 0)
+	if conns := hub.ConnsForUser("alice"); len(conns) != 0 {
+		t.Errorf("ConnsForUser after disconnect = %v", conns)
+	}
+}
+
+// TestSSEServeHubTypeMismatch verifies that a hub whose output type does not
+// match the connection type is reported and the connection is closed rather
+// than silently left unregistered.
+func TestSSEServeHubTypeMismatch(t *testing.T) {
+	hub := NewSSEHub[string]()
+	handler := &NotifierSSEHandler{connChan: make(chan *NotifierSSEConn, 1)}
+	server := httptest.NewServer(SSEServe[any](handler, &SSEConnConfig{Hub: hub}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer resp.Body.Close()
+	conn := waitForSSEConn(t, handler.connChan)
+	select {
+	case <-conn.closedChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection not closed after failed registration")
+	}
+	if hub.Count() != 0 {
+		t.Errorf("hub count = %d, want 0", hub.Count())
+	}
+}
+
+// TestSSEHubLookupByMeta verifies ConnsForUser and FindConns, and that
+// replacing a connection under the same ID updates the user index.
+func TestSSEHubLookupByMeta(t *testing.T) {
+	hub := NewSSEHub[any]()
+	a1 := createTestSSEConn[any](t, &JSONCodec{}, "a1")
+	a2 := createTestSSEConn[any](t, &JSONCodec{}, "a2")
+	b1 := createTestSSEConn[any](t, &JSONCodec{}, "b1")
+	for _, c := range []*BaseSSEConn[any]{a1, a2, b1} {
+		defer c.OnClose()
+	}
+	hub.RegisterWithMeta(a1, SSEConnMeta{User: "alice", RemoteIP: "10.0.0.1"})
+	hub.RegisterWithMeta(a2, SSEConnMeta{User: "alice", RemoteIP: "10.0.0.2"})
+	hub.RegisterWithMeta(b1, SSEConnMeta{User: "bob", Labels: map[string]string{"plan": "pro"}})
+
+	if n := len(hub.ConnsForUser("alice")); n != 2 {
+		t.Errorf("ConnsForUser(alice) = %d conns, want 2", n)
+	}
+	pro := hub.FindConns(func(id string, meta SSEConnMeta) bool { return meta.Labels["plan"] == "pro" })
+	if len(pro) != 1 || pro[0].ConnId() != "b1" {
+		t.Errorf("FindConns(plan=pro) = %v", pro)
+	}
+
+	// Re-registering a2 as bob moves it between users.
+	hub.RegisterWithMeta(a2, SSEConnMeta{User: "bob"})
+	if n := len(hub.ConnsForUser("alice")); n != 1 {
+		t.Errorf("ConnsForUser(alice) after re-register = %d, want 1", n)
+	}
+	if n := len(hub.ConnsForUser("bob")); n != 2 {
+		t.Errorf("ConnsForUser(bob) after re-register = %d, want 2", n)
+	}
+
+	// UnregisterServed ignores a stale connection with a reused ID.
+	stale := &BaseSSEConn[any]{Codec: &JSONCodec{}, ConnIdStr: "b1"}
+	hub.UnregisterServed(stale)
+	if _, ok := hub.Get("b1"); !ok {
+		t.Error("UnregisterServed removed a different connection with the same ID")
+	}
+	hub.UnregisterServed(b1)
+	if _, ok := hub.Get("b1"); ok {
+		t.Error("UnregisterServed did not remove the registered connection")
+	}
+}
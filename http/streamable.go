@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 )
 
 // ============================================================================
@@ -29,8 +31,9 @@ type StreamableResponse interface {
 //
 // If StatusCode is 0, it defaults to 200.
 type SingleResponse struct {
-	StatusCode int // HTTP status code (default 200)
-	Body       any // JSON-marshaled response body
+	StatusCode int         // HTTP status code (default 200)
+	Header     http.Header // extra response headers (optional)
+	Body       any         // JSON-marshaled response body
 }
 
 func (SingleResponse) isStreamable() {}
@@ -44,9 +47,26 @@ func (SingleResponse) isStreamable() {}
 // and closes the channel when done. StreamableServe handles SSE formatting,
 // flushing, and client disconnect detection.
 //
+// To end the stream with an error, set Err: it is called once Events is
+// closed, and a non-nil result is sent as a final event (named by
+// StreamableConfig.ErrorEvent) whose data is {"error": "<message>"}.
+//
+// If the client does not accept text/event-stream, the events are collected
+// and sent as a single JSON response instead (see
+// StreamableConfig.CollectStream); an error then becomes a 500 response.
+//
 // Per WHATWG SSE spec: https://html.spec.whatwg.org/multipage/server-sent-events.html
 type StreamResponse struct {
 	Events <-chan SSEEvent
+
+	// StatusCode is the HTTP status of the stream (default 200).
+	StatusCode int
+
+	// Header holds extra response headers (optional).
+	Header http.Header
+
+	// Err, if set, reports how the producer finished (optional).
+	Err func() error
 }
 
 func (StreamResponse) isStreamable() {}
@@ -107,15 +127,65 @@ type StreamableConfig struct {
 	// Codec for serializing SSE event Data fields.
 	// Only Encode() is used. Default: JSONCodec.
 	Codec Codec[any, any]
+
+	// Sessions, when set, enables Mcp-Session-Id session management, the
+	// standalone GET stream and DELETE termination. See StreamableSessions.
+	// Default: nil (stateless; every request goes to the handler).
+	Sessions *StreamableSessions
+
+	// EventStore, when set, makes StreamResponse streams resumable. Each
+	// event gets a stream-scoped ID ("<streamID>_<id>") and is stored, and
+	// the producer keeps running if the client disconnects. A GET carrying
+	// Last-Event-ID replays the events the client missed and, if the
+	// producer is still running, continues with live events.
+	// Default: nil (streams end when the client disconnects).
+	EventStore EventStore
+
+	// IDGen generates the per-stream part of event IDs for events whose ID
+	// is empty. Only used with EventStore. Default: AtomicIDGen.
+	IDGen IDGen
+
+	// ResumeRetention is how long a finished stream's events are kept in
+	// EventStore for clients to resume before they are trimmed. Streams of
+	// a session are trimmed when the session closes. Default: 5 minutes.
+	ResumeRetention time.Duration
+
+	// KeepalivePeriod is how often an SSE comment (": keepalive") is sent on
+	// an idle stream, so proxies do not close it. Zero disables keepalives.
+	KeepalivePeriod time.Duration
+
+	// ErrorEvent is the event name of the terminal error event sent when a
+	// StreamResponse's Err reports an error. Default: "error".
+	ErrorEvent string
+
+	// CollectStream builds the JSON body sent when a client that does not
+	// accept text/event-stream gets a StreamResponse. Default: a JSON array
+	// of the events' Data.
+	CollectStream func(events []SSEEvent) any
 }
 
 // DefaultStreamableConfig returns a StreamableConfig with sensible defaults.
 func DefaultStreamableConfig() *StreamableConfig {
 	return &StreamableConfig{
-		Codec: &JSONCodec{},
+		Codec:           &JSONCodec{},
+		KeepalivePeriod: 30 * time.Second,
 	}
 }
 
+func (c *StreamableConfig) resumeRetention() time.Duration {
+	if c.ResumeRetention <= 0 {
+		return 5 * time.Minute
+	}
+	return c.ResumeRetention
+}
+
+func (c *StreamableConfig) errorEvent() string {
+	if c.ErrorEvent == "" {
+		return "error"
+	}
+	return c.ErrorEvent
+}
+
 // ============================================================================
 // StreamableServe
 // ============================================================================
@@ -126,7 +196,12 @@ func DefaultStreamableConfig() *StreamableConfig {
 //
 // The handler function decides per-request whether to return a SingleResponse
 // (JSON) or StreamResponse (SSE stream). StreamableServe handles content-type
-// negotiation, SSE formatting, flushing, and client disconnect detection.
+// negotiation, SSE formatting, flushing, and client disconnect detection:
+//
+//   - a request whose Accept header allows neither application/json nor
+//     text/event-stream gets 406 Not Acceptable (no Accept header allows both)
+//   - a StreamResponse for a client that does not accept text/event-stream is
+//     collected into a single JSON response
 //
 // Example:
 //
@@ -140,15 +215,68 @@ func StreamableServe(handler StreamableHandlerFunc, config *StreamableConfig) ht
 	if config == nil {
 		config = DefaultStreamableConfig()
 	}
+	codec := config.Codec
+	if codec == nil {
+		codec = &JSONCodec{}
+	}
+	var streams *streamableStreams
+	if config.EventStore != nil {
+		streams = newStreamableStreams(config, codec)
+		if config.Sessions != nil {
+			config.Sessions.onClose(streams.trimSession)
+		}
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if lastEventID := r.Header.Get("Last-Event-ID"); streams != nil && r.Method == http.MethodGet && lastEventID != "" {
+			if config.Sessions != nil {
+				var ok bool
+				if r, ok = config.Sessions.validate(w, r, r.Header.Get(config.Sessions.header())); !ok {
+					return
+				}
+			}
+			streams.resume(w, r, lastEventID)
+			return
+		}
+
+		commit := func(bool) {}
+		if config.Sessions != nil {
+			var proceed bool
+			if r, commit, proceed = config.Sessions.serve(w, r, codec, config.KeepalivePeriod); !proceed {
+				return
+			}
+		}
+
+		acceptsJSON, acceptsSSE := true, true
+		if accept := r.Header.Get("Accept"); accept != "" {
+			acceptsJSON, acceptsSSE = ParseAcceptTypes(accept)
+		}
+		if !acceptsJSON && !acceptsSSE {
+			commit(false)
+			http.Error(w, "Accept must allow application/json or text/event-stream", http.StatusNotAcceptable)
+			return
+		}
+
 		resp := handler(r.Context(), r)
 
 		switch v := resp.(type) {
 		case SingleResponse:
+			commit(v.StatusCode < 400)
 			writeSingleResponse(w, v)
 		case StreamResponse:
-			writeStreamResponse(w, r, v, config.Codec)
+			if !acceptsSSE {
+				single := collectStreamResponse(r.Context(), v, config)
+				commit(single.StatusCode < 400)
+				writeSingleResponse(w, single)
+				return
+			}
+			commit(true)
+			if streams != nil {
+				streams.serve(w, r, v)
+			} else {
+				writeStreamResponse(w, r, v, codec, config)
+			}
 		default:
+			commit(false)
 			http.Error(w, "internal error: unknown response type", http.StatusInternalServerError)
 		}
 	}
@@ -157,6 +285,7 @@ func StreamableServe(handler StreamableHandlerFunc, config *StreamableConfig) ht
 // writeSingleResponse marshals the body as JSON and writes it with
 // Content-Type: application/json.
 func writeSingleResponse(w http.ResponseWriter, resp SingleResponse) {
+	copyHeader(w.Header(), resp.Header)
 	w.Header().Set("Content-Type", "application/json")
 	status := resp.StatusCode
 	if status == 0 {
@@ -168,29 +297,61 @@ func writeSingleResponse(w http.ResponseWriter, resp SingleResponse) {
 	}
 }
 
+// collectStreamResponse drains a StreamResponse into a SingleResponse for
+// clients that cannot receive SSE.
+func collectStreamResponse(ctx context.Context, resp StreamResponse, config *StreamableConfig) SingleResponse {
+	var events []SSEEvent
+collect:
+	for {
+		select {
+		case <-ctx.Done():
+			return SingleResponse{StatusCode: http.StatusServiceUnavailable}
+		case event, ok := <-resp.Events:
+			if !ok {
+				break collect
+			}
+			events = append(events, event)
+		}
+	}
+	if err := streamErr(resp); err != nil {
+		return SingleResponse{StatusCode: http.StatusInternalServerError, Header: resp.Header, Body: streamErrorData(err)}
+	}
+	var body any
+	if config.CollectStream != nil {
+		body = config.CollectStream(events)
+	} else {
+		data := make([]any, len(events))
+		for i, event := range events {
+			data[i] = event.Data
+		}
+		body = data
+	}
+	return SingleResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+}
+
 // writeStreamResponse sets SSE headers and streams events from the channel
 // until it is closed or the client disconnects.
-func writeStreamResponse(w http.ResponseWriter, r *http.Request, resp StreamResponse, codec Codec[any, any]) {
-	flusher, ok := w.(http.Flusher)
+func writeStreamResponse(w http.ResponseWriter, r *http.Request, resp StreamResponse, codec Codec[any, any], config *StreamableConfig) {
+	copyHeader(w.Header(), resp.Header)
+	flusher, ok := startSSEStream(w, resp.StatusCode)
 	if !ok {
-		http.Error(w, "streaming not supported", http.StatusInternalServerError)
 		return
 	}
-
-	// Set SSE headers
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("X-Accel-Buffering", "no")
-	flusher.Flush()
+	keepalive, stop := keepaliveTicker(config.KeepalivePeriod)
+	defer stop()
 
 	for {
 		select {
 		case <-r.Context().Done():
 			return
+		case <-keepalive:
+			writeSSEKeepalive(w, flusher)
 		case event, ok := <-resp.Events:
 			if !ok {
 				// Channel closed — stream complete
+				if err := streamErr(resp); err != nil {
+					writeSSEEvent(w, flusher, SSEEvent{Event: config.errorEvent(), Data: streamErrorData(err)}, codec)
+				}
 				return
 			}
 			writeSSEEvent(w, flusher, event, codec)
@@ -198,6 +359,65 @@ func writeStreamResponse(w http.ResponseWriter, r *http.Request, resp StreamResp
 	}
 }
 
+// streamErr returns the producer's final error, if it reports one.
+func streamErr(resp StreamResponse) error {
+	if resp.Err == nil {
+		return nil
+	}
+	return resp.Err()
+}
+
+// streamErrorData is the payload of the terminal error event.
+func streamErrorData(err error) map[string]string {
+	return map[string]string{"error": err.Error()}
+}
+
+// keepaliveTicker returns a channel that fires every period, or a nil
+// channel (which never fires) if period is zero.
+func keepaliveTicker(period time.Duration) (<-chan time.Time, func()) {
+	if period <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(period)
+	return ticker.C, ticker.Stop
+}
+
+// writeSSEKeepalive writes a keepalive comment, which EventSource clients
+// ignore.
+func writeSSEKeepalive(w http.ResponseWriter, flusher http.Flusher) {
+	io.WriteString(w, ": keepalive\n\n")
+	flusher.Flush()
+}
+
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		dst[name] = append([]string(nil), values...)
+	}
+}
+
+// startSSEStream sets SSE response headers, writes status (0 means 200)
+// and flushes. If the ResponseWriter cannot stream, it writes a 500 and
+// returns false.
+func startSSEStream(w http.ResponseWriter, status int) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Set SSE headers
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	flusher.Flush()
+	return flusher, true
+}
+
 // writeSSEEvent formats and writes a single SSE event to the ResponseWriter.
 // Uses the same wire format as BaseSSEConn.OnStart callback.
 func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, event SSEEvent, codec Codec[any, any]) {
@@ -0,0 +1,321 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamableStreams tracks the StreamResponse streams of one StreamableServe
+// handler when StreamableConfig.EventStore is set, so a client whose stream
+// dropped can resume it with a GET carrying Last-Event-ID.
+//
+// Each stream is drained by a pump goroutine that is independent of the
+// HTTP request: events are encoded once, given a stream-scoped ID, stored,
+// and forwarded to whichever request is currently attached. When the
+// client disconnects, the pump keeps storing events for as long as the
+// producer keeps sending them, and a resuming GET picks up from the store
+// and then continues live.
+//
+// Event IDs have the form "<streamID>_<n>", so the stream can be found from
+// Last-Event-ID alone. The store key is scoped to the Streamable session
+// (if any), so one session cannot resume another session's stream.
+type streamableStreams struct {
+	store  EventStore
+	idgen  IDGen
+	codec  Codec[any, any]
+	config *StreamableConfig
+
+	mu    sync.Mutex
+	pumps map[string]*streamPump
+	// keys holds each session's store keys that have not been trimmed
+	// yet, so they can be trimmed when the session closes.
+	keys map[string]map[string]bool
+}
+
+// streamPump drains one StreamResponse into the EventStore.
+type streamPump struct {
+	key string // EventStore stream key
+
+	// mu orders Store against the replay taken by attach, so a resuming
+	// request sees every event exactly once: either in its replay or on its
+	// live channel. publish holds it while handing an event over.
+	mu sync.Mutex
+
+	// subMu guards attached and finished. It is never held while blocking,
+	// so a request can always be detached, even while publish is waiting
+	// for it.
+	subMu    sync.Mutex
+	attached *streamSubscriber
+	finished bool
+}
+
+// streamSubscriber is the request currently receiving a stream's events.
+type streamSubscriber struct {
+	events chan StoredEvent // closed when the producer finishes
+	gone   chan struct{}    // closed when the request goes away
+	once   sync.Once
+}
+
+func (s *streamSubscriber) stop() {
+	s.once.Do(func() { close(s.gone) })
+}
+
+func newStreamableStreams(config *StreamableConfig, codec Codec[any, any]) *streamableStreams {
+	idgen := config.IDGen
+	if idgen == nil {
+		idgen = &AtomicIDGen{}
+	}
+	return &streamableStreams{store: config.EventStore, idgen: idgen, codec: codec, config: config, pumps: make(map[string]*streamPump), keys: make(map[string]map[string]bool)}
+}
+
+// storeKey scopes a stream's events to the request's session.
+func storeKey(r *http.Request, streamID string) string {
+	if session := StreamableSessionID(r.Context()); session != "" {
+		return session + "/" + streamID
+	}
+	return streamID
+}
+
+// serve starts pumping resp and streams it to the requesting client.
+func (s *streamableStreams) serve(w http.ResponseWriter, r *http.Request, resp StreamResponse) {
+	streamID := GenerateSessionID()
+	session := StreamableSessionID(r.Context())
+	pump := &streamPump{key: storeKey(r, streamID)}
+	sub := pump.attach(nil)
+
+	s.mu.Lock()
+	s.pumps[pump.key] = pump
+	if s.keys[session] == nil {
+		s.keys[session] = make(map[string]bool)
+	}
+	s.keys[session][pump.key] = true
+	s.mu.Unlock()
+	go s.run(pump, session, streamID, resp)
+
+	copyHeader(w.Header(), resp.Header)
+	s.deliver(w, r, resp.StatusCode, nil, sub, pump)
+}
+
+// resume replays the events after lastEventID and, if the producer is still
+// running, continues with live events. The previously attached request (if
+// any) is detached.
+func (s *streamableStreams) resume(w http.ResponseWriter, r *http.Request, lastEventID string) {
+	if _, acceptsSSE := ParseAcceptTypes(r.Header.Get("Accept")); !acceptsSSE {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	streamID, _, ok := strings.Cut(lastEventID, "_")
+	if !ok || streamID == "" {
+		http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+		return
+	}
+	key := storeKey(r, streamID)
+
+	s.mu.Lock()
+	pump := s.pumps[key]
+	s.mu.Unlock()
+
+	var replay []StoredEvent
+	var err error
+	var sub *streamSubscriber
+	if pump != nil {
+		sub = pump.attach(func() {
+			replay, err = s.store.Replay(key, lastEventID)
+		})
+	} else {
+		replay, err = s.store.Replay(key, lastEventID)
+	}
+	if err != nil {
+		log.Printf("Streamable: replay of %s failed: %v", key, err)
+	}
+	s.deliver(w, r, http.StatusOK, replay, sub, pump)
+}
+
+// run drains the producer's channel, storing each event and forwarding it
+// to the attached request. The terminal error event, if any, is stored too,
+// so a client resuming after the failure still sees it. The stored events
+// are trimmed ResumeRetention after the producer finishes.
+func (s *streamableStreams) run(pump *streamPump, session, streamID string, resp StreamResponse) {
+	for ev := range resp.Events {
+		s.publish(pump, streamID, ev)
+	}
+	if err := streamErr(resp); err != nil {
+		s.publish(pump, streamID, SSEEvent{Event: s.config.errorEvent(), Data: streamErrorData(err)})
+	}
+	pump.finish()
+	s.mu.Lock()
+	if s.pumps[pump.key] == pump {
+		delete(s.pumps, pump.key)
+	}
+	s.mu.Unlock()
+	time.AfterFunc(s.config.resumeRetention(), func() { s.trim(session, pump.key) })
+}
+
+// trim removes a stream's events from the store.
+func (s *streamableStreams) trim(session, key string) {
+	s.mu.Lock()
+	delete(s.keys[session], key)
+	if len(s.keys[session]) == 0 {
+		delete(s.keys, session)
+	}
+	s.mu.Unlock()
+	if err := s.store.Trim(key); err != nil {
+		log.Printf("Streamable: failed to trim %s: %v", key, err)
+	}
+}
+
+// trimSession removes the events of every stream of a closed session.
+func (s *streamableStreams) trimSession(session string) {
+	s.mu.Lock()
+	keys := s.keys[session]
+	delete(s.keys, session)
+	s.mu.Unlock()
+	for key := range keys {
+		if err := s.store.Trim(key); err != nil {
+			log.Printf("Streamable: failed to trim %s: %v", key, err)
+		}
+	}
+}
+
+// publish encodes ev once, assigns its stream-scoped ID and hands it to the
+// pump.
+func (s *streamableStreams) publish(pump *streamPump, streamID string, ev SSEEvent) {
+	var data []byte
+	if ev.Data != nil {
+		var err error
+		if data, _, err = s.codec.Encode(ev.Data); err != nil {
+			log.Printf("Streamable: failed to encode event on %s: %v", pump.key, err)
+			return
+		}
+	}
+	id := ev.ID
+	if id == "" {
+		id = s.idgen.Next()
+	}
+	stored := StoredEvent{ID: streamID + "_" + id, Event: ev.Event, Data: data}
+	pump.publish(func() {
+		if err := s.store.Store(pump.key, stored); err != nil {
+			log.Printf("Streamable: failed to store event %s: %v", stored.ID, err)
+		}
+	}, stored)
+}
+
+// deliver writes replayed events and then live events from sub (if any)
+// until the stream finishes or the client disconnects.
+func (s *streamableStreams) deliver(w http.ResponseWriter, r *http.Request, status int, replay []StoredEvent, sub *streamSubscriber, pump *streamPump) {
+	if sub != nil {
+		defer pump.detach(sub)
+	}
+	flusher, ok := startSSEStream(w, status)
+	if !ok {
+		return
+	}
+	for _, ev := range replay {
+		writeStoredSSEEvent(w, flusher, ev)
+	}
+	if sub == nil {
+		return
+	}
+	keepalive, stop := keepaliveTicker(s.config.KeepalivePeriod)
+	defer stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive:
+			writeSSEKeepalive(w, flusher)
+		case <-sub.gone:
+			return // replaced by a newer resume
+		case ev, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			writeStoredSSEEvent(w, flusher, ev)
+		}
+	}
+}
+
+// attach makes a new subscriber the stream's live destination, replacing
+// any previous one. before runs under the pump lock, so a replay taken
+// there and the live events that follow neither overlap nor leave a gap.
+// Returns nil if the producer has already finished.
+func (p *streamPump) attach(before func()) *streamSubscriber {
+	// Stop the previous subscriber first, so a publish blocked on it
+	// gives up and releases mu.
+	p.subMu.Lock()
+	if p.attached != nil {
+		p.attached.stop()
+		p.attached = nil
+	}
+	p.subMu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if before != nil {
+		before()
+	}
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	if p.finished {
+		return nil
+	}
+	p.attached = &streamSubscriber{events: make(chan StoredEvent, 16), gone: make(chan struct{})}
+	return p.attached
+}
+
+// detach removes sub if it is still the attached subscriber.
+func (p *streamPump) detach(sub *streamSubscriber) {
+	sub.stop()
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	if p.attached == sub {
+		p.attached = nil
+	}
+}
+
+// publish stores an event and hands it to the attached subscriber. Waiting
+// for the subscriber to take the event preserves the original backpressure:
+// a connected but slow client slows the producer, while a disconnected one
+// does not.
+func (p *streamPump) publish(store func(), ev StoredEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	store()
+	p.subMu.Lock()
+	sub := p.attached
+	p.subMu.Unlock()
+	if sub != nil {
+		select {
+		case sub.events <- ev:
+		case <-sub.gone:
+		}
+	}
+}
+
+// finish marks the producer as done and ends the attached request's stream.
+func (p *streamPump) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	p.finished = true
+	if p.attached != nil {
+		close(p.attached.events)
+		p.attached = nil
+	}
+}
+
+// writeStoredSSEEvent writes an already-encoded event. Like writeSSEEvent,
+// it writes no data line for an event without data, so replayed and live
+// events are byte-identical.
+func writeStoredSSEEvent(w http.ResponseWriter, flusher http.Flusher, ev StoredEvent) {
+	if len(ev.Data) == 0 {
+		writeSSEEvent(w, flusher, SSEEvent{Event: ev.Event, ID: ev.ID}, nil)
+		return
+	}
+	writeSSEFrame(w, ev.Event, ev.ID, 0, ev.Data)
+	flusher.Flush()
+}
@@ -0,0 +1,294 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newResumableStreamableServer serves a handler that streams whatever is
+// sent on the returned channel, with an EventStore attached.
+func newResumableStreamableServer(t *testing.T, store EventStore) (*httptest.Server, chan SSEEvent) {
+	t.Helper()
+	events := make(chan SSEEvent)
+	handler := func(ctx context.Context, r *http.Request) StreamableResponse {
+		return StreamResponse{Events: events}
+	}
+	server := httptest.NewServer(StreamableServe(handler, &StreamableConfig{
+		Codec:      &JSONCodec{},
+		EventStore: store,
+	}))
+	t.Cleanup(server.Close)
+	return server, events
+}
+
+// resumeStream issues a GET with Last-Event-ID.
+func resumeStream(t *testing.T, url, lastEventID string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", lastEventID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	return resp
+}
+
+// TestStreamableResume_ContinuesLive verifies that events sent while the
+// client was disconnected are replayed on resume, and that the resumed
+// stream continues with live events until the producer finishes.
+func TestStreamableResume_ContinuesLive(t *testing.T) {
+	store := NewMemoryEventStore(100)
+	server, events := newResumableStreamableServer(t, store)
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events <- SSEEvent{Data: 1}
+	first, err := readSSEEvent(t, bufio.NewReader(resp.Body), 2*time.Second)
+	if err != nil || first.Data != "1" {
+		t.Fatalf("first event = %+v, %v", first, err)
+	}
+	streamID, n, ok := strings.Cut(first.ID, "_")
+	if !ok || len(streamID) != 32 || n != "1" {
+		t.Fatalf("event ID %q is not stream-scoped", first.ID)
+	}
+	resp.Body.Close()
+
+	// The producer keeps running while the client is away.
+	events <- SSEEvent{Data: 2}
+	events <- SSEEvent{Event: "progress", Data: 3, ID: "custom"}
+
+	resumed := resumeStream(t, server.URL, first.ID)
+	defer resumed.Body.Close()
+	if ct := resumed.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("resume Content-Type = %q", ct)
+	}
+	reader := bufio.NewReader(resumed.Body)
+	for _, want := range []sseEvent{
+		{Data: "2", ID: streamID + "_2"},
+		{Event: "progress", Data: "3", ID: streamID + "_custom"},
+	} {
+		ev, err := readSSEEvent(t, reader, 2*time.Second)
+		if err != nil || ev.Data != want.Data || ev.ID != want.ID || ev.Event != want.Event {
+			t.Fatalf("replayed event = %+v, %v; want %+v", ev, err, want)
+		}
+	}
+
+	events <- SSEEvent{Data: 4}
+	if ev, err := readSSEEvent(t, reader, 2*time.Second); err != nil || ev.Data != "4" {
+		t.Fatalf("live event = %+v, %v", ev, err)
+	}
+	close(events)
+	if _, err := readSSEEvent(t, reader, 2*time.Second); err == nil {
+		t.Error("expected resumed stream to end with the producer")
+	}
+}
+
+// TestStreamableResume_AfterProducerDone verifies that resuming a finished
+// stream replays the remaining events and ends, and that malformed
+// Last-Event-ID values are rejected.
+func TestStreamableResume_AfterProducerDone(t *testing.T) {
+	store := NewMemoryEventStore(100)
+	server, events := newResumableStreamableServer(t, store)
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(resp.Body)
+	events <- SSEEvent{Data: "a"}
+	first, err := readSSEEvent(t, reader, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events <- SSEEvent{Data: "b"}
+	close(events)
+	resp.Body.Close()
+
+	// Wait for the pump to finish storing.
+	streamID, _, _ := strings.Cut(first.ID, "_")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stored, _ := store.Replay(streamID, first.ID)
+		if len(stored) == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	resumed := resumeStream(t, server.URL, first.ID)
+	defer resumed.Body.Close()
+	reader = bufio.NewReader(resumed.Body)
+	if ev, err := readSSEEvent(t, reader, 2*time.Second); err != nil || ev.Data != `"b"` {
+		t.Fatalf("replayed event = %+v, %v", ev, err)
+	}
+	if _, err := readSSEEvent(t, reader, 2*time.Second); err == nil {
+		t.Error("expected stream to end after replay")
+	}
+
+	bad := resumeStream(t, server.URL, "no-stream")
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("malformed Last-Event-ID status = %d, want 400", bad.StatusCode)
+	}
+}
+
+// TestStreamableResume_ReplayMatchesLive verifies that a stored event is
+// written with the same bytes as the live, non-resumable encoding,
+// including events without data.
+func TestStreamableResume_ReplayMatchesLive(t *testing.T) {
+	codec := &JSONCodec{}
+	for _, ev := range []SSEEvent{
+		{Event: "ping", ID: "1"},
+		{ID: "2"},
+		{Event: "progress", ID: "3", Data: map[string]int{"n": 1}},
+		{ID: "4", Data: "two\nlines"},
+	} {
+		live := httptest.NewRecorder()
+		writeSSEEvent(live, live, ev, codec)
+
+		stored := StoredEvent{ID: ev.ID, Event: ev.Event}
+		if ev.Data != nil {
+			stored.Data, _, _ = codec.Encode(ev.Data)
+		}
+		store := NewMemoryEventStore(10)
+		store.Store("s", stored)
+		replay, err := store.Replay("s", "")
+		if err != nil || len(replay) != 1 {
+			t.Fatalf("replay = %v, %v", replay, err)
+		}
+		replayed := httptest.NewRecorder()
+		writeStoredSSEEvent(replayed, replayed, replay[0])
+
+		if live.Body.String() != replayed.Body.String() {
+			t.Errorf("event %+v: replayed %q, live %q", ev, replayed.Body.String(), live.Body.String())
+		}
+	}
+}
+
+// TestStreamableResume_SessionScoped verifies that with sessions enabled a
+// stream can only be resumed from the session that created it.
+func TestStreamableResume_SessionScoped(t *testing.T) {
+	events := make(chan SSEEvent)
+	handler := func(ctx context.Context, r *http.Request) StreamableResponse {
+		if r.URL.Query().Get("stream") == "" {
+			return SingleResponse{Body: "ok"}
+		}
+		return StreamResponse{Events: events}
+	}
+	server := httptest.NewServer(StreamableServe(handler, &StreamableConfig{
+		Sessions:   NewStreamableSessions(nil),
+		EventStore: NewMemoryEventStore(100),
+	}))
+	defer server.Close()
+	owner := initSession(t, server.URL)
+	other := initSession(t, server.URL)
+
+	resp := sessionRequest(t, "POST", server.URL+"?stream=1", owner)
+	events <- SSEEvent{Data: 1}
+	first, err := readSSEEvent(t, bufio.NewReader(resp.Body), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	events <- SSEEvent{Data: 2}
+	close(events)
+
+	resume := func(session string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Last-Event-ID", first.ID)
+		req.Header.Set(MCPSessionHeader, session)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := resume("unknown"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown session resume status = %d, want 404", resp.StatusCode)
+	} else {
+		resp.Body.Close()
+	}
+
+	foreign := resume(other)
+	if _, err := readSSEEvent(t, bufio.NewReader(foreign.Body), 2*time.Second); err == nil {
+		t.Error("another session must not see the stream's events")
+	}
+	foreign.Body.Close()
+
+	mine := resume(owner)
+	defer mine.Body.Close()
+	if ev, err := readSSEEvent(t, bufio.NewReader(mine.Body), 2*time.Second); err != nil || ev.Data != "2" {
+		t.Fatalf("owner resume event = %+v, %v", ev, err)
+	}
+}
+
+// waitStoredStreams polls until store holds want streams.
+func waitStoredStreams(t *testing.T, store *MemoryEventStore, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for store.Stats().Streams != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("stored streams = %d, want %d", store.Stats().Streams, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestStreamableResume_TrimsFinishedStreams verifies that a finished
+// stream's events are trimmed after ResumeRetention.
+func TestStreamableResume_TrimsFinishedStreams(t *testing.T) {
+	store := NewMemoryEventStore(100)
+	events := make(chan SSEEvent)
+	server := httptest.NewServer(StreamableServe(func(ctx context.Context, r *http.Request) StreamableResponse {
+		return StreamResponse{Events: events}
+	}, &StreamableConfig{EventStore: store, ResumeRetention: 50 * time.Millisecond}))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events <- SSEEvent{Data: 1}
+	close(events)
+	waitStoredStreams(t, store, 1)
+	waitStoredStreams(t, store, 0)
+}
+
+// TestStreamableResume_TrimsOnSessionClose verifies that closing a session
+// trims its streams without waiting for ResumeRetention.
+func TestStreamableResume_TrimsOnSessionClose(t *testing.T) {
+	store := NewMemoryEventStore(100)
+	events := make(chan SSEEvent)
+	server := httptest.NewServer(StreamableServe(func(ctx context.Context, r *http.Request) StreamableResponse {
+		if r.URL.Query().Get("stream") == "" {
+			return SingleResponse{Body: "ok"}
+		}
+		return StreamResponse{Events: events}
+	}, &StreamableConfig{
+		Sessions:        NewStreamableSessions(nil),
+		EventStore:      store,
+		ResumeRetention: time.Hour,
+	}))
+	defer server.Close()
+	session := initSession(t, server.URL)
+
+	resp := sessionRequest(t, "POST", server.URL+"?stream=1", session)
+	events <- SSEEvent{Data: 1}
+	close(events)
+	resp.Body.Close()
+	waitStoredStreams(t, store, 1)
+
+	sessionRequest(t, "DELETE", server.URL, session).Body.Close()
+	waitStoredStreams(t, store, 0)
+}
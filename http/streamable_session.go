@@ -0,0 +1,306 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MCPSessionHeader is the header that carries the session ID in the MCP
+// Streamable HTTP transport.
+//
+// See: https://modelcontextprotocol.io/specification/2025-03-26/basic/transports#session-management
+const MCPSessionHeader = "Mcp-Session-Id"
+
+// ErrNoSessionStream is returned by StreamableSessions.Send when the session
+// has no standalone GET stream open.
+var ErrNoSessionStream = errors.New("streamable: session has no open stream")
+
+// sessionStreamTouchInterval is how often, at most, an open standalone
+// stream marks its session active, so that sessions with a listening client
+// do not expire while idle on the POST side. Stores with a shorter idle
+// timeout are touched every third of it.
+const sessionStreamTouchInterval = 15 * time.Second
+
+// sessionIdleTimeouter is implemented by stores that report their idle
+// timeout (MemorySessionStore).
+type sessionIdleTimeouter interface {
+	idleTimeout() time.Duration
+}
+
+// touchInterval returns how often an open stream touches its session.
+func (s *StreamableSessions) touchInterval() time.Duration {
+	if store, ok := s.store().(sessionIdleTimeouter); ok {
+		if idle := store.idleTimeout(); idle > 0 {
+			return max(min(sessionStreamTouchInterval, idle/3), time.Millisecond)
+		}
+	}
+	return sessionStreamTouchInterval
+}
+
+// StreamableSessions adds session management to StreamableServe, covering
+// the rest of the MCP Streamable HTTP transport:
+//
+//   - POST without a session header that IsInitialize accepts creates a
+//     session (ID from GenerateSessionID) and returns it in Mcp-Session-Id
+//   - every other request must carry a live session ID: missing → 400,
+//     unknown or expired → 404
+//   - GET opens the session's standalone SSE stream for server-initiated
+//     messages, sent with Send (one stream per session; a second → 409)
+//   - DELETE terminates the session
+//
+// Handlers can read the session ID with StreamableSessionID(ctx).
+//
+// Usage:
+//
+//	sessions := gohttp.NewStreamableSessions(gohttp.NewMemorySessionStore(30 * time.Minute))
+//	router.HandleFunc("/mcp", gohttp.StreamableServe(handler, &gohttp.StreamableConfig{
+//	    Codec:    &gohttp.JSONCodec{},
+//	    Sessions: sessions,
+//	}))
+//
+//	// Later, push a server-initiated message:
+//	sessions.Send(ctx, sessionID, gohttp.SSEEvent{Data: notification})
+type StreamableSessions struct {
+	// Store records live sessions. Default: a MemorySessionStore that never
+	// expires sessions.
+	Store SessionStore
+
+	// Header is the session header name. Default: MCPSessionHeader.
+	Header string
+
+	// IsInitialize reports whether a request without a session header
+	// starts a new session. If nil, every such POST does. MCP servers
+	// typically check for a JSON-RPC "initialize" request.
+	IsInitialize func(r *http.Request) bool
+
+	// OnClose is called after a session is terminated by DELETE or Close,
+	// or expires in a Store that implements SessionExpiryNotifier.
+	OnClose func(sessionID string)
+
+	mu      sync.Mutex
+	streams map[string]*sessionStream
+	hooks   []func(sessionID string) // internal cleanup run before OnClose
+	watched bool                     // registered with Store's expiry notifier
+}
+
+// sessionStream is the standalone GET stream of one session.
+type sessionStream struct {
+	events chan SSEEvent
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (s *sessionStream) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// NewStreamableSessions creates session management backed by store
+// (nil for an in-memory store without expiry).
+func NewStreamableSessions(store SessionStore) *StreamableSessions {
+	return &StreamableSessions{Store: store}
+}
+
+type streamableSessionKey struct{}
+
+// StreamableSessionID returns the session ID of the request being handled,
+// or "" if sessions are not enabled.
+func StreamableSessionID(ctx context.Context) string {
+	id, _ := ctx.Value(streamableSessionKey{}).(string)
+	return id
+}
+
+// Send delivers a server-initiated event on the session's standalone GET
+// stream. It blocks until the event is queued, the stream closes, or ctx
+// is done. Returns ErrNoSessionStream if the client has no stream open.
+func (s *StreamableSessions) Send(ctx context.Context, sessionID string, event SSEEvent) error {
+	s.mu.Lock()
+	stream := s.streams[sessionID]
+	s.mu.Unlock()
+	if stream == nil {
+		return ErrNoSessionStream
+	}
+	select {
+	case stream.events <- event:
+		return nil
+	case <-stream.done:
+		return ErrNoSessionStream
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close terminates a session: it is removed from the store, its standalone
+// stream (if any) is closed, and OnClose is called.
+func (s *StreamableSessions) Close(sessionID string) error {
+	err := s.store().Delete(sessionID)
+	s.closed(sessionID)
+	return err
+}
+
+// closed releases what is held for a session that has left the store and
+// calls OnClose.
+func (s *StreamableSessions) closed(sessionID string) {
+	s.mu.Lock()
+	stream := s.streams[sessionID]
+	delete(s.streams, sessionID)
+	hooks := s.hooks
+	s.mu.Unlock()
+	if stream != nil {
+		stream.close()
+	}
+	for _, hook := range hooks {
+		hook(sessionID)
+	}
+	if s.OnClose != nil {
+		s.OnClose(sessionID)
+	}
+}
+
+// onClose registers cleanup to run when a session is closed, e.g. trimming
+// its resumable streams.
+func (s *StreamableSessions) onClose(hook func(sessionID string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+func (s *StreamableSessions) store() SessionStore {
+	s.mu.Lock()
+	if s.Store == nil {
+		s.Store = &MemorySessionStore{}
+	}
+	store := s.Store
+	watch := !s.watched
+	s.watched = true
+	s.mu.Unlock()
+	if notifier, ok := store.(SessionExpiryNotifier); ok && watch {
+		notifier.OnExpire(s.closed)
+	}
+	return store
+}
+
+func (s *StreamableSessions) header() string {
+	if s.Header == "" {
+		return MCPSessionHeader
+	}
+	return s.Header
+}
+
+// serve handles session bookkeeping for one request. It returns the request
+// to pass to the handler (with the session ID in its context), a commit
+// func for a newly created session, and false if the request was fully
+// handled here (GET, DELETE or an error response).
+func (s *StreamableSessions) serve(w http.ResponseWriter, r *http.Request, codec Codec[any, any], keepalivePeriod time.Duration) (*http.Request, func(ok bool), bool) {
+	id := r.Header.Get(s.header())
+	if id == "" {
+		if r.Method != http.MethodPost || (s.IsInitialize != nil && !s.IsInitialize(r)) {
+			http.Error(w, "missing "+s.header()+" header", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		id = GenerateSessionID()
+		if err := s.store().Create(id); err != nil {
+			http.Error(w, "failed to create session", http.StatusInternalServerError)
+			return nil, nil, false
+		}
+		w.Header().Set(s.header(), id)
+		r = r.WithContext(context.WithValue(r.Context(), streamableSessionKey{}, id))
+		// Drop the session again if initialization fails.
+		commit := func(ok bool) {
+			if !ok {
+				s.store().Delete(id)
+			}
+		}
+		return r, commit, true
+	}
+
+	r, ok := s.validate(w, r, id)
+	if !ok {
+		return nil, nil, false
+	}
+	switch r.Method {
+	case http.MethodDelete:
+		s.Close(id)
+		w.WriteHeader(http.StatusNoContent)
+		return nil, nil, false
+	case http.MethodGet:
+		s.serveStream(w, r, id, codec, keepalivePeriod)
+		return nil, nil, false
+	}
+	return r, func(bool) {}, true
+}
+
+// validate checks that id names a live session, writing 404 (or 500) if
+// not, and returns r with the session ID in its context.
+func (s *StreamableSessions) validate(w http.ResponseWriter, r *http.Request, id string) (*http.Request, bool) {
+	if id == "" {
+		http.Error(w, "missing "+s.header()+" header", http.StatusBadRequest)
+		return nil, false
+	}
+	live, err := s.store().Touch(id)
+	if err != nil {
+		http.Error(w, "failed to validate session", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !live {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return nil, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), streamableSessionKey{}, id)), true
+}
+
+// serveStream runs the standalone GET stream for a session until the client
+// disconnects or the session is closed, sending keepalives while it is idle.
+func (s *StreamableSessions) serveStream(w http.ResponseWriter, r *http.Request, id string, codec Codec[any, any], keepalivePeriod time.Duration) {
+	if _, acceptsSSE := ParseAcceptTypes(r.Header.Get("Accept")); !acceptsSSE {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	stream := &sessionStream{events: make(chan SSEEvent, 16), done: make(chan struct{})}
+	s.mu.Lock()
+	if s.streams == nil {
+		s.streams = make(map[string]*sessionStream)
+	}
+	if _, busy := s.streams[id]; busy {
+		s.mu.Unlock()
+		http.Error(w, "session already has an open stream", http.StatusConflict)
+		return
+	}
+	s.streams[id] = stream
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.streams[id] == stream {
+			delete(s.streams, id)
+		}
+		s.mu.Unlock()
+		stream.close()
+	}()
+
+	flusher, ok := startSSEStream(w, http.StatusOK)
+	if !ok {
+		return
+	}
+	touch := time.NewTicker(s.touchInterval())
+	defer touch.Stop()
+	keepalive, stop := keepaliveTicker(keepalivePeriod)
+	defer stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-stream.done:
+			return
+		case <-keepalive:
+			writeSSEKeepalive(w, flusher)
+		case <-touch.C:
+			if live, _ := s.store().Touch(id); !live {
+				return
+			}
+		case event := <-stream.events:
+			writeSSEEvent(w, flusher, event, codec)
+		}
+	}
+}
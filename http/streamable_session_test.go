@@ -0,0 +1,240 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSessionStreamableServer serves a handler that echoes the session ID,
+// with session management enabled.
+func newSessionStreamableServer(t *testing.T, sessions *StreamableSessions) *httptest.Server {
+	t.Helper()
+	handler := func(ctx context.Context, r *http.Request) StreamableResponse {
+		if r.URL.Query().Get("fail") != "" {
+			return SingleResponse{StatusCode: http.StatusBadRequest, Body: map[string]any{"error": "bad init"}}
+		}
+		return SingleResponse{Body: map[string]any{"session": StreamableSessionID(ctx)}}
+	}
+	server := httptest.NewServer(StreamableServe(handler, &StreamableConfig{
+		Codec:    &JSONCodec{},
+		Sessions: sessions,
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sessionRequest sends a request with an optional session header.
+func sessionRequest(t *testing.T, method, url, sessionID string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(`{}`))
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if sessionID != "" {
+		req.Header.Set(MCPSessionHeader, sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp
+}
+
+// initSession performs the initializing POST and returns the session ID.
+func initSession(t *testing.T, url string) string {
+	t.Helper()
+	resp := sessionRequest(t, "POST", url, "")
+	resp.Body.Close()
+	id := resp.Header.Get(MCPSessionHeader)
+	if resp.StatusCode != http.StatusOK || len(id) != 32 {
+		t.Fatalf("init: status %d, session %q", resp.StatusCode, id)
+	}
+	return id
+}
+
+// TestStreamableSessions_Lifecycle verifies session creation on the first
+// POST, validation on later requests, and termination via DELETE.
+func TestStreamableSessions_Lifecycle(t *testing.T) {
+	var closed []string
+	sessions := NewStreamableSessions(nil)
+	sessions.OnClose = func(id string) { closed = append(closed, id) }
+	server := newSessionStreamableServer(t, sessions)
+
+	id := initSession(t, server.URL)
+
+	resp := sessionRequest(t, "POST", server.URL, id)
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	resp.Body.Close()
+	if body["session"] != id {
+		t.Errorf("handler saw session %v, want %s", body["session"], id)
+	}
+	if resp.Header.Get(MCPSessionHeader) != "" {
+		t.Error("session header should only be returned on initialization")
+	}
+
+	resp = sessionRequest(t, "POST", server.URL, "unknown")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown session status = %d, want 404", resp.StatusCode)
+	}
+
+	resp = sessionRequest(t, "DELETE", server.URL, id)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want 204", resp.StatusCode)
+	}
+	if len(closed) != 1 || closed[0] != id {
+		t.Errorf("OnClose calls = %v", closed)
+	}
+	resp = sessionRequest(t, "POST", server.URL, id)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted session status = %d, want 404", resp.StatusCode)
+	}
+}
+
+// TestStreamableSessions_InitializeRules verifies that only initialization
+// requests may omit the session header, and that a failed initialization
+// does not leave a session behind.
+func TestStreamableSessions_InitializeRules(t *testing.T) {
+	store := &MemorySessionStore{}
+	sessions := NewStreamableSessions(store)
+	sessions.IsInitialize = func(r *http.Request) bool { return r.URL.Query().Get("init") != "" }
+	server := newSessionStreamableServer(t, sessions)
+
+	resp := sessionRequest(t, "POST", server.URL, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("non-init POST without session status = %d, want 400", resp.StatusCode)
+	}
+
+	resp = sessionRequest(t, "POST", server.URL+"?init=1&fail=1", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || store.Len() != 0 {
+		t.Errorf("failed init: status %d, %d sessions left", resp.StatusCode, store.Len())
+	}
+
+	initSession(t, server.URL+"?init=1")
+	if store.Len() != 1 {
+		t.Errorf("sessions after init = %d, want 1", store.Len())
+	}
+}
+
+// TestStreamableSessions_StandaloneStream verifies the GET stream: it
+// delivers server-initiated events from Send, allows only one stream per
+// session, and ends when the session is deleted.
+func TestStreamableSessions_StandaloneStream(t *testing.T) {
+	sessions := NewStreamableSessions(nil)
+	server := newSessionStreamableServer(t, sessions)
+	id := initSession(t, server.URL)
+
+	if err := sessions.Send(context.Background(), id, SSEEvent{Data: 1}); !errors.Is(err, ErrNoSessionStream) {
+		t.Errorf("Send without stream = %v, want ErrNoSessionStream", err)
+	}
+
+	stream := sessionRequest(t, "GET", server.URL, id)
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("GET Content-Type = %q", ct)
+	}
+
+	second := sessionRequest(t, "GET", server.URL, id)
+	second.Body.Close()
+	if second.StatusCode != http.StatusConflict {
+		t.Errorf("second GET status = %d, want 409", second.StatusCode)
+	}
+
+	if err := sessions.Send(context.Background(), id, SSEEvent{Event: "notify", Data: map[string]any{"n": 1}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	reader := bufio.NewReader(stream.Body)
+	ev, err := readSSEEvent(t, reader, 2*time.Second)
+	if err != nil || ev.Event != "notify" || ev.Data != `{"n":1}` {
+		t.Fatalf("stream event = %+v, %v", ev, err)
+	}
+
+	sessionRequest(t, "DELETE", server.URL, id).Body.Close()
+	if _, err := readSSEEvent(t, reader, 2*time.Second); err == nil {
+		t.Error("expected stream to end after DELETE")
+	}
+}
+
+// TestStreamableSessions_StandaloneStreamKeepalive verifies that an idle
+// GET stream sends keepalive comments.
+func TestStreamableSessions_StandaloneStreamKeepalive(t *testing.T) {
+	server := httptest.NewServer(StreamableServe(func(ctx context.Context, r *http.Request) StreamableResponse {
+		return SingleResponse{Body: "ok"}
+	}, &StreamableConfig{Sessions: NewStreamableSessions(nil), KeepalivePeriod: 20 * time.Millisecond}))
+	defer server.Close()
+	id := initSession(t, server.URL)
+
+	stream := sessionRequest(t, "GET", server.URL, id)
+	defer stream.Body.Close()
+	got := make(chan SSEReadEvent, 1)
+	go func() {
+		ev, _ := NewSSEEventReader(stream.Body).ReadEvent()
+		got <- ev
+	}()
+	select {
+	case ev := <-got:
+		if ev.Comment != "keepalive" {
+			t.Errorf("first event = %+v, want a keepalive comment", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no keepalive on idle stream")
+	}
+}
+
+// TestStreamableSessions_StreamKeepsShortSessionAlive verifies that an
+// open GET stream touches its session often enough to outlive an idle
+// timeout shorter than the default touch interval.
+func TestStreamableSessions_StreamKeepsShortSessionAlive(t *testing.T) {
+	store := NewMemorySessionStore(time.Second)
+	t.Cleanup(func() { store.Close() })
+	server := newSessionStreamableServer(t, NewStreamableSessions(store))
+	id := initSession(t, server.URL)
+
+	stream := sessionRequest(t, "GET", server.URL, id)
+	defer stream.Body.Close()
+	time.Sleep(1500 * time.Millisecond)
+
+	resp := sessionRequest(t, "POST", server.URL, id)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST after 1.5s with an open stream: status = %d, want 200", resp.StatusCode)
+	}
+}
+
+// TestStreamableSessions_IdleExpiry verifies that an expired session is
+// rejected with 404 and reported to OnClose.
+func TestStreamableSessions_IdleExpiry(t *testing.T) {
+	store := NewMemorySessionStore(50 * time.Millisecond)
+	sessions := NewStreamableSessions(store)
+	closed := make(chan string, 1)
+	sessions.OnClose = func(id string) { closed <- id }
+	server := newSessionStreamableServer(t, sessions)
+	id := initSession(t, server.URL)
+
+	time.Sleep(100 * time.Millisecond)
+	resp := sessionRequest(t, "POST", server.URL, id)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expired session status = %d, want 404", resp.StatusCode)
+	}
+	select {
+	case got := <-closed:
+		if got != id {
+			t.Errorf("OnClose(%q), want %q", got, id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("OnClose not called for the expired session")
+	}
+}
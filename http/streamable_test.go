@@ -337,3 +337,133 @@ func TestStreamable_POSTMethod(t *testing.T) {
 		t.Errorf("Expected method=POST, got %v", body["method"])
 	}
 }
+
+// streamOf returns a handler that streams the given values, then reports
+// err (if any) as the stream's final error.
+func streamOf(err error, values ...any) StreamableHandlerFunc {
+	return func(ctx context.Context, r *http.Request) StreamableResponse {
+		ch := make(chan SSEEvent, len(values))
+		for _, v := range values {
+			ch <- SSEEvent{Data: v}
+		}
+		close(ch)
+		return StreamResponse{
+			Events:     ch,
+			StatusCode: http.StatusCreated,
+			Header:     http.Header{"X-Stream": {"yes"}},
+			Err:        func() error { return err },
+		}
+	}
+}
+
+func postWithAccept(t *testing.T, url, accept string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url, strings.NewReader(`{}`))
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp
+}
+
+// TestStreamable_NotAcceptable verifies that a client accepting neither
+// JSON nor SSE gets 406 and the handler is not called.
+func TestStreamable_NotAcceptable(t *testing.T) {
+	called := false
+	server := httptest.NewServer(StreamableServe(func(ctx context.Context, r *http.Request) StreamableResponse {
+		called = true
+		return SingleResponse{Body: "ok"}
+	}, nil))
+	defer server.Close()
+
+	resp := postWithAccept(t, server.URL, "text/html")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotAcceptable || called {
+		t.Errorf("status = %d, handler called = %v; want 406 without calling the handler", resp.StatusCode, called)
+	}
+}
+
+// TestStreamable_CollectsStreamForJSONClients verifies that a client that
+// only accepts JSON gets the stream's events as one JSON array, with the
+// handler's status and headers, and a 500 if the stream ends with an error.
+func TestStreamable_CollectsStreamForJSONClients(t *testing.T) {
+	server := httptest.NewServer(StreamableServe(streamOf(nil, 1, "two", map[string]any{"n": 3}), nil))
+	defer server.Close()
+
+	resp := postWithAccept(t, server.URL, "application/json")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("X-Stream") != "yes" || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("collected response = %d %v", resp.StatusCode, resp.Header)
+	}
+	if strings.TrimSpace(string(body)) != `[1,"two",{"n":3}]` {
+		t.Errorf("collected body = %s", body)
+	}
+
+	failing := httptest.NewServer(StreamableServe(streamOf(io.ErrUnexpectedEOF, 1), nil))
+	defer failing.Close()
+	resp = postWithAccept(t, failing.URL, "application/json")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(string(body), "unexpected EOF") {
+		t.Errorf("failed collected response = %d %s", resp.StatusCode, body)
+	}
+
+	last := httptest.NewServer(StreamableServe(streamOf(nil, 1, 2), &StreamableConfig{
+		CollectStream: func(events []SSEEvent) any { return events[len(events)-1].Data },
+	}))
+	defer last.Close()
+	resp = postWithAccept(t, last.URL, "application/json")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.TrimSpace(string(body)) != `2` {
+		t.Errorf("custom collected body = %s", body)
+	}
+}
+
+// TestStreamable_StreamHeadersAndErrorEvent verifies handler-set status
+// and headers on a stream, and the terminal error event.
+func TestStreamable_StreamHeadersAndErrorEvent(t *testing.T) {
+	server := httptest.NewServer(StreamableServe(streamOf(io.ErrUnexpectedEOF, "a"), &StreamableConfig{ErrorEvent: "failed"}))
+	defer server.Close()
+
+	resp := postWithAccept(t, server.URL, "application/json, text/event-stream")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("X-Stream") != "yes" || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("stream response = %d %v", resp.StatusCode, resp.Header)
+	}
+	reader := bufio.NewReader(resp.Body)
+	if ev, err := readSSEEvent(t, reader, 2*time.Second); err != nil || ev.Data != `"a"` {
+		t.Fatalf("event = %+v, %v", ev, err)
+	}
+	ev, err := readSSEEvent(t, reader, 2*time.Second)
+	if err != nil || ev.Event != "failed" || ev.Data != `{"error":"unexpected EOF"}` {
+		t.Errorf("error event = %+v, %v", ev, err)
+	}
+}
+
+// TestStreamable_Keepalive verifies that idle streams get keepalive
+// comments.
+func TestStreamable_Keepalive(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(StreamableServe(func(ctx context.Context, r *http.Request) StreamableResponse {
+		ch := make(chan SSEEvent)
+		go func() {
+			<-release
+			close(ch)
+		}()
+		return StreamResponse{Events: ch}
+	}, &StreamableConfig{KeepalivePeriod: 20 * time.Millisecond}))
+	defer server.Close()
+	defer close(release)
+
+	resp := postWithAccept(t, server.URL, "")
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != ": keepalive\n" {
+		t.Errorf("first line = %q, %v", line, err)
+	}
+}
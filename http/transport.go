@@ -0,0 +1,227 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/panyam/servicekit/middleware"
+)
+
+// RoundTripperFunc adapts a function to http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// ClientMiddleware wraps an outbound http.RoundTripper, the client-side
+// counterpart of func(http.Handler) http.Handler.
+//
+// Middleware must not modify the request it is given; clone it first
+// (req.Clone) to change headers.
+type ClientMiddleware func(next http.RoundTripper) http.RoundTripper
+
+// TransportChain composes client middleware into a single RoundTripper,
+// like middleware.Guard does for handlers. The first middleware added is
+// the outermost (sees the request first and the response last).
+//
+// Usage:
+//
+//	chain := &TransportChain{}
+//	chain.Use(PropagateRequestID(""), SetUserAgent("myapp/1.0"), LogClientRequests(nil))
+//	client := &http.Client{Transport: chain.Wrap(nil)}
+type TransportChain struct {
+	middlewares []ClientMiddleware
+}
+
+// Use adds middleware to the chain. Nil middleware are silently skipped.
+func (c *TransportChain) Use(mw ...ClientMiddleware) {
+	for _, m := range mw {
+		if m != nil {
+			c.middlewares = append(c.middlewares, m)
+		}
+	}
+}
+
+// Wrap applies all configured middleware to rt (http.DefaultTransport if
+// nil). On a nil receiver, returns rt unchanged.
+func (c *TransportChain) Wrap(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	if c == nil {
+		return rt
+	}
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		rt = c.middlewares[i](rt)
+	}
+	return rt
+}
+
+// ClientBuilder produces *http.Client values with a shared transport and
+// middleware chain.
+//
+// Usage:
+//
+//	client := NewClientBuilder().
+//	    Timeout(5 * time.Second).
+//	    Use(PropagateRequestID(""), SetUserAgent("myapp/1.0")).
+//	    Build()
+type ClientBuilder struct {
+	timeout   time.Duration
+	transport http.RoundTripper
+	chain     TransportChain
+}
+
+// NewClientBuilder returns a builder for clients with a 10s timeout (like
+// DefaultHttpClient) over a fresh http.Transport.
+func NewClientBuilder() *ClientBuilder {
+	return &ClientBuilder{timeout: 10 * time.Second, transport: &http.Transport{}}
+}
+
+// Timeout sets the client timeout. 0 means no timeout.
+func (b *ClientBuilder) Timeout(d time.Duration) *ClientBuilder {
+	b.timeout = d
+	return b
+}
+
+// Transport sets the innermost RoundTripper, e.g. a tuned *http.Transport
+// or another wrapper such as CircuitBreaker.RoundTripper.
+func (b *ClientBuilder) Transport(rt http.RoundTripper) *ClientBuilder {
+	b.transport = rt
+	return b
+}
+
+// Use appends middleware to the chain.
+func (b *ClientBuilder) Use(mw ...ClientMiddleware) *ClientBuilder {
+	b.chain.Use(mw...)
+	return b
+}
+
+// Build returns a new client. Clients built by the same builder share
+// the transport, and so its connection pool.
+func (b *ClientBuilder) Build() *http.Client {
+	return &http.Client{Timeout: b.timeout, Transport: b.chain.Wrap(b.transport)}
+}
+
+// WithClientMiddleware wraps the call's client transport (DefaultHttpClient
+// unless WithClient is given) with extra middleware for this call only.
+// Later options add inner middleware.
+func WithClientMiddleware(mw ...ClientMiddleware) CallOption {
+	return func(cfg *callConfig) { cfg.chain.Use(mw...) }
+}
+
+// PropagateRequestID copies the request ID stored by middleware.RequestID
+// in the request context into the header (X-Request-Id if empty) of
+// outbound requests that do not already set it, so a handler's downstream
+// calls carry the ID of the request that caused them.
+func PropagateRequestID(header string) ClientMiddleware {
+	if header == "" {
+		header = "X-Request-Id"
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if id := middleware.RequestIDFromContext(req.Context()); id != "" && req.Header.Get(header) == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set(header, id)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// SetUserAgent sets the User-Agent header on requests that do not set one.
+func SetUserAgent(userAgent string) ClientMiddleware {
+	return SetHeaders(http.Header{"User-Agent": {userAgent}})
+}
+
+// SetHeaders adds the given headers to requests that do not already set
+// them.
+func SetHeaders(headers http.Header) ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			cloned := false
+			for k, v := range headers {
+				if req.Header.Get(k) != "" {
+					continue
+				}
+				if !cloned {
+					req, cloned = req.Clone(req.Context()), true
+				}
+				req.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// BearerAuth sets "Authorization: Bearer <token>" on requests without an
+// Authorization header. token is called per request, so it can return a
+// cached, refreshed token; an error fails the request.
+func BearerAuth(token func(ctx context.Context) (string, error)) ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "" {
+				return next.RoundTrip(req)
+			}
+			tok, err := token(req.Context())
+			if err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer "+tok)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// LogClientRequests logs each outbound request with method, host, path,
+// status (or error) and duration, plus "request_id" when the context
+// carries one. A nil logger uses slog.Default().
+func LogClientRequests(logger *slog.Logger) ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			attrs := []any{
+				"component", "http-client",
+				"method", req.Method, "host", req.URL.Host, "path", req.URL.Path,
+				"duration", time.Since(start).Round(time.Millisecond).String(),
+			}
+			if err != nil {
+				attrs = append(attrs, "error", err.Error())
+			} else {
+				attrs = append(attrs, "status", resp.StatusCode)
+			}
+			if rid := middleware.RequestIDFromContext(req.Context()); rid != "" {
+				attrs = append(attrs, "request_id", rid)
+			}
+			l := logger
+			if l == nil {
+				l = slog.Default()
+			}
+			l.Info("HTTP client request", attrs...)
+			return resp, err
+		})
+	}
+}
+
+// ClientMetrics calls observe after each outbound request with its
+// response or error and the time until headers arrived. Use it to feed
+// counters and latency histograms.
+func ClientMetrics(observe func(req *http.Request, resp *http.Response, err error, d time.Duration)) ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			observe(req, resp, err, time.Since(start))
+			return resp, err
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/panyam/servicekit/middleware"
+)
+
+// headerEchoServer answers with the named request headers as JSON.
+func headerEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"rid":"` + r.Header.Get("X-Request-Id") + `","ua":"` + r.Header.Get("User-Agent") +
+			`","auth":"` + r.Header.Get("Authorization") + `","team":"` + r.Header.Get("X-Team") + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTransportChain_Order(t *testing.T) {
+	var order []string
+	tag := func(name string) ClientMiddleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+">")
+				resp, err := next.RoundTrip(req)
+				order = append(order, "<"+name)
+				return resp, err
+			})
+		}
+	}
+	chain := &TransportChain{}
+	chain.Use(tag("a"), nil, tag("b"))
+	rt := chain.Wrap(RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+		order = append(order, "transport")
+		return &http.Response{StatusCode: 204, Body: http.NoBody}, nil
+	}))
+	req, _ := http.NewRequest("GET", "http://example.test/", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, " "); got != "a> b> transport <b <a" {
+		t.Errorf("order = %s", got)
+	}
+
+	var nilChain *TransportChain
+	if nilChain.Wrap(nil) != http.DefaultTransport {
+		t.Error("nil chain should return the default transport")
+	}
+}
+
+func TestClientBuilder_Headers(t *testing.T) {
+	srv := headerEchoServer(t)
+	client := NewClientBuilder().
+		Timeout(time.Second).
+		Use(
+			PropagateRequestID(""),
+			SetUserAgent("servicekit-test/1"),
+			SetHeaders(http.Header{"X-Team": {"infra"}}),
+			BearerAuth(func(ctx context.Context) (string, error) { return "tok", nil }),
+		).
+		Build()
+	if client.Timeout != time.Second {
+		t.Errorf("Timeout = %v", client.Timeout)
+	}
+
+	ctx := middleware.ContextWithRequestID(context.Background(), "rid-123")
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	got, err := Call[map[string]string](ctx, req, WithClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"rid": "rid-123", "ua": "servicekit-test/1", "auth": "Bearer tok", "team": "infra"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if req.Header.Get("Authorization") != "" || req.Header.Get("X-Request-Id") != "" {
+		t.Error("middleware modified the caller's request")
+	}
+
+	// Headers already set by the caller win.
+	req, _ = http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("User-Agent", "custom")
+	req.Header.Set("Authorization", "Basic x")
+	got, _ = Call[map[string]string](ctx, req, WithClient(client))
+	if got["ua"] != "custom" || got["auth"] != "Basic x" {
+		t.Errorf("caller headers overridden: %v", got)
+	}
+}
+
+func TestBearerAuth_Error(t *testing.T) {
+	srv := headerEchoServer(t)
+	client := NewClientBuilder().Use(BearerAuth(func(ctx context.Context) (string, error) {
+		return "", errors.New("no token")
+	})).Build()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if err := CallVoid(context.Background(), req, WithClient(client)); err == nil || !strings.Contains(err.Error(), "no token") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestWithClientMiddleware_PerCall(t *testing.T) {
+	srv := headerEchoServer(t)
+	var observed []int
+	metrics := ClientMetrics(func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+		observed = append(observed, resp.StatusCode)
+	})
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	got, err := Call[map[string]string](context.Background(), req,
+		WithClientMiddleware(SetUserAgent("per-call"), metrics))
+	if err != nil || got["ua"] != "per-call" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if len(observed) != 1 || observed[0] != 200 {
+		t.Errorf("observed = %v", observed)
+	}
+
+	// The shared default client is untouched.
+	req, _ = http.NewRequest("GET", srv.URL, nil)
+	got, _ = Call[map[string]string](context.Background(), req)
+	if got["ua"] == "per-call" {
+		t.Error("per-call middleware leaked into DefaultHttpClient")
+	}
+}
+
+func TestLogClientRequests(t *testing.T) {
+	srv := headerEchoServer(t)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	ctx := middleware.ContextWithRequestID(context.Background(), "rid-9")
+	req, _ := http.NewRequest("GET", srv.URL+"/items", nil)
+	if err := CallVoid(ctx, req, WithClientMiddleware(LogClientRequests(logger))); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"method=GET", "path=/items", "status=200", "request_id=rid-9"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log %q missing %q", out, want)
+		}
+	}
+}
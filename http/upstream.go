@@ -0,0 +1,514 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoHealthyUpstream is returned by an UpstreamPool when every upstream
+// is ejected or failing its health check.
+var ErrNoHealthyUpstream = errors.New("no healthy upstream")
+
+// BalanceStrategy selects how an UpstreamPool spreads requests.
+type BalanceStrategy int
+
+const (
+	// RoundRobin cycles through the available upstreams in order.
+	RoundRobin BalanceStrategy = iota
+	// LeastOutstanding picks the available upstream with the fewest
+	// requests in flight, breaking ties round-robin.
+	LeastOutstanding
+	// ConsistentHash maps each request's HashKey to an upstream on a hash
+	// ring, so the same key keeps going to the same upstream while it is
+	// available and only its keys move when it is not.
+	ConsistentHash
+)
+
+func (s BalanceStrategy) String() string {
+	switch s {
+	case RoundRobin:
+		return "round-robin"
+	case LeastOutstanding:
+		return "least-outstanding"
+	case ConsistentHash:
+		return "consistent-hash"
+	}
+	return fmt.Sprintf("BalanceStrategy(%d)", int(s))
+}
+
+// hashRingReplicas is the number of points each upstream has on the
+// ConsistentHash ring.
+const hashRingReplicas = 100
+
+// UpstreamPoolConfig controls how an UpstreamPool balances requests and
+// tracks upstream health.
+type UpstreamPoolConfig struct {
+	Strategy BalanceStrategy
+
+	// HashKey maps a request to its ConsistentHash key. Default: the
+	// request path and query.
+	HashKey func(req *http.Request) string
+
+	// MaxFailures ejects an upstream after this many failed requests in a
+	// row (passive health tracking). 0 disables ejection.
+	MaxFailures int
+
+	// EjectionTime is how long an ejected upstream is skipped before it
+	// gets requests again. Default: 30s.
+	EjectionTime time.Duration
+
+	// IsFailure classifies a completed request for passive health
+	// tracking; err is a transport error and resp is nil when it is set.
+	// Default: transport errors and 5xx responses. Cancelled requests are
+	// never counted.
+	IsFailure func(resp *http.Response, err error) bool
+
+	// HealthCheck, if set, actively probes an upstream by its base URL;
+	// upstreams whose last probe failed are skipped until one succeeds.
+	// Probes run from CheckHealth and RunHealthChecks. See HTTPHealthCheck.
+	HealthCheck func(ctx context.Context, baseURL string) error
+
+	// HealthCheckInterval is the delay between RunHealthChecks rounds.
+	// Default: 10s.
+	HealthCheckInterval time.Duration
+
+	// HedgeAfter, if positive, sends a second copy of an idempotent
+	// request to another upstream when the first has not responded within
+	// this time. The first response wins and the other is cancelled.
+	// Requests with a body are only hedged when GetBody is set.
+	HedgeAfter time.Duration
+}
+
+// DefaultUpstreamPoolConfig returns a round-robin config that ejects an
+// upstream for 30s after 5 consecutive failures, without health checks or
+// hedging.
+func DefaultUpstreamPoolConfig() UpstreamPoolConfig {
+	return UpstreamPoolConfig{
+		Strategy:     RoundRobin,
+		MaxFailures:  5,
+		EjectionTime: 30 * time.Second,
+	}
+}
+
+// UpstreamStatus is a snapshot of one upstream of an UpstreamPool.
+type UpstreamStatus struct {
+	URL string
+	// Outstanding is the number of requests in flight, counting a request
+	// until its response body is closed.
+	Outstanding int
+	// Failures is the current run of consecutive failures.
+	Failures int
+	// EjectedUntil is set while the upstream is passively ejected.
+	EjectedUntil time.Time
+	// Healthy is false while the last active health check failed.
+	Healthy bool
+}
+
+// UpstreamPool balances requests across several base URLs of a replicated
+// service, so clients inside a cluster need no load balancer in front of
+// it. Requests are built against any host, or just a path; the pool
+// replaces their scheme and host with the chosen upstream's and prefixes
+// the upstream's path:
+//
+//	pool, err := gohttp.NewUpstreamPool(
+//		[]string{"http://users-0:8080", "http://users-1:8080"},
+//		gohttp.DefaultUpstreamPoolConfig())
+//	req, _ := http.NewRequest("GET", "/v1/users/42", nil)
+//	user, err := gohttp.Call[User](ctx, req, gohttp.WithUpstreamPool(pool))
+//
+// Combined with WithRetry, a retried request goes to the next upstream.
+type UpstreamPool struct {
+	Config UpstreamPoolConfig
+
+	mu        sync.Mutex
+	upstreams []*upstream
+	ring      []ringPoint // sorted by hash
+	next      int
+	now       func() time.Time
+}
+
+type upstream struct {
+	base         *url.URL
+	outstanding  int
+	failures     int
+	ejectedUntil time.Time
+	down         bool // last active health check failed
+}
+
+type ringPoint struct {
+	hash uint64
+	u    *upstream
+}
+
+// NewUpstreamPool creates a pool over baseURLs, which must be absolute
+// URLs, filling zero durations with their defaults.
+func NewUpstreamPool(baseURLs []string, cfg UpstreamPoolConfig) (*UpstreamPool, error) {
+	if len(baseURLs) == 0 {
+		return nil, errors.New("upstream pool: no upstreams")
+	}
+	if cfg.EjectionTime <= 0 {
+		cfg.EjectionTime = 30 * time.Second
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = 10 * time.Second
+	}
+	p := &UpstreamPool{Config: cfg, now: time.Now}
+	for _, raw := range baseURLs {
+		base, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("upstream pool: %w", err)
+		}
+		if base.Scheme == "" || base.Host == "" {
+			return nil, fmt.Errorf("upstream pool: %q is not an absolute URL", raw)
+		}
+		base.Path = strings.TrimSuffix(base.Path, "/")
+		base.RawPath = ""
+		u := &upstream{base: base}
+		p.upstreams = append(p.upstreams, u)
+		for i := range hashRingReplicas {
+			p.ring = append(p.ring, ringPoint{hash: hashString(base.String() + "#" + strconv.Itoa(i)), u: u})
+		}
+	}
+	slices.SortFunc(p.ring, func(a, b ringPoint) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return 0
+	})
+	return p, nil
+}
+
+// WithUpstreamPool sends the call to an upstream of pool.
+func WithUpstreamPool(pool *UpstreamPool) CallOption {
+	return WithClientMiddleware(pool.RoundTripper)
+}
+
+// RoundTripper wraps next (http.DefaultTransport if nil) so every request
+// goes to an upstream of the pool.
+func (p *UpstreamPool) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return p.roundTrip(req, next)
+	})
+}
+
+// Upstreams returns the state of each upstream, in the order given to
+// NewUpstreamPool.
+func (p *UpstreamPool) Upstreams() []UpstreamStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	out := make([]UpstreamStatus, len(p.upstreams))
+	for i, u := range p.upstreams {
+		out[i] = UpstreamStatus{
+			URL:         u.base.String(),
+			Outstanding: u.outstanding,
+			Failures:    u.failures,
+			Healthy:     !u.down,
+		}
+		if u.ejectedUntil.After(now) {
+			out[i].EjectedUntil = u.ejectedUntil
+		}
+	}
+	return out
+}
+
+// CheckHealth probes every upstream once with Config.HealthCheck,
+// concurrently, and updates which upstreams are healthy. It does nothing
+// without a HealthCheck.
+func (p *UpstreamPool) CheckHealth(ctx context.Context) {
+	if p.Config.HealthCheck == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		wg.Go(func() {
+			err := p.Config.HealthCheck(ctx, u.base.String())
+			if ctx.Err() != nil {
+				return
+			}
+			p.mu.Lock()
+			u.down = err != nil
+			p.mu.Unlock()
+		})
+	}
+	wg.Wait()
+}
+
+// RunHealthChecks calls CheckHealth every Config.HealthCheckInterval until
+// ctx is done. Run it in its own goroutine.
+func (p *UpstreamPool) RunHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(p.Config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		p.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HTTPHealthCheck returns a health check for UpstreamPoolConfig that GETs
+// path on the upstream with client (a default client if nil) and expects
+// a 2xx or 3xx response.
+func HTTPHealthCheck(path string, client *http.Client) func(ctx context.Context, baseURL string) error {
+	return func(ctx context.Context, baseURL string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, MakeUrl(baseURL, path, ""), nil)
+		if err != nil {
+			return err
+		}
+		opts := []CallOption{}
+		if client != nil {
+			opts = append(opts, WithClient(client))
+		}
+		resp, err := CallRaw(ctx, req, opts...)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, resp.Body)
+		return resp.Body.Close()
+	}
+}
+
+func (p *UpstreamPool) roundTrip(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	if p.Config.HedgeAfter <= 0 || !isIdempotent(req) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		u, err := p.pick(req, nil)
+		if err != nil {
+			return nil, err
+		}
+		return p.send(u, req, next)
+	}
+	return p.hedge(req, next)
+}
+
+type hedgeResult struct {
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// hedge sends req to one upstream and, if it has not answered within
+// HedgeAfter, a copy to another. The first response wins; the other
+// attempt is cancelled and its response discarded.
+func (p *UpstreamPool) hedge(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	results := make(chan hedgeResult, 2)
+	launch := func(u *upstream) error {
+		ctx, cancel := context.WithCancel(req.Context())
+		r := req.Clone(ctx)
+		if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return err
+			}
+			r.Body = body
+		}
+		go func() {
+			resp, err := p.send(u, r, next)
+			results <- hedgeResult{resp, err, cancel}
+		}()
+		return nil
+	}
+
+	first, err := p.pick(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := launch(first); err != nil {
+		return nil, err
+	}
+	pending := 1
+	timer := time.NewTimer(p.Config.HedgeAfter)
+	defer timer.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-timer.C:
+			if second, err := p.pick(req, first); err == nil && launch(second) == nil {
+				pending++
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: res.cancel}
+				go discardHedges(results, pending)
+				return res.resp, nil
+			}
+			res.cancel()
+			lastErr = res.err
+			if pending == 0 {
+				return nil, lastErr
+			}
+		}
+	}
+}
+
+// discardHedges cancels and drains the n losing attempts of a hedge.
+func discardHedges(results <-chan hedgeResult, n int) {
+	for range n {
+		res := <-results
+		res.cancel()
+		if res.err == nil {
+			res.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose releases a hedged attempt's context with its body.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// send rewrites req for u, sends it and records the outcome.
+func (p *UpstreamPool) send(u *upstream, req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = u.base.Scheme
+	r.URL.Host = u.base.Host
+	r.URL.Path = u.base.Path + "/" + strings.TrimPrefix(req.URL.Path, "/")
+	r.URL.RawPath = ""
+	r.Host = ""
+
+	resp, err := next.RoundTrip(r)
+	p.record(req.Context(), u, resp, err)
+	if err != nil {
+		p.release(u)
+		return nil, err
+	}
+	resp.Body = &upstreamBody{ReadCloser: resp.Body, release: func() { p.release(u) }}
+	return resp, nil
+}
+
+// upstreamBody counts its request as outstanding until it is closed.
+type upstreamBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *upstreamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func (p *UpstreamPool) release(u *upstream) {
+	p.mu.Lock()
+	u.outstanding--
+	p.mu.Unlock()
+}
+
+func (p *UpstreamPool) record(ctx context.Context, u *upstream, resp *http.Response, err error) {
+	if p.Config.MaxFailures <= 0 || ctx.Err() != nil {
+		return
+	}
+	var failed bool
+	if p.Config.IsFailure != nil {
+		failed = p.Config.IsFailure(resp, err)
+	} else {
+		failed = err != nil || resp.StatusCode >= 500
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !failed {
+		u.failures = 0
+		return
+	}
+	if u.failures++; u.failures >= p.Config.MaxFailures {
+		u.failures = 0
+		u.ejectedUntil = p.now().Add(p.Config.EjectionTime)
+	}
+}
+
+// pick chooses an available upstream other than exclude per the strategy
+// and counts a request as outstanding on it.
+func (p *UpstreamPool) pick(req *http.Request, exclude *upstream) (*upstream, error) {
+	var key string
+	if p.Config.Strategy == ConsistentHash {
+		if p.Config.HashKey != nil {
+			key = p.Config.HashKey(req)
+		} else {
+			key = req.URL.RequestURI()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	available := func(u *upstream) bool {
+		return u != exclude && !u.down && !u.ejectedUntil.After(now)
+	}
+	n := len(p.upstreams)
+	var chosen *upstream
+	switch p.Config.Strategy {
+	case ConsistentHash:
+		h := hashString(key)
+		start, _ := slices.BinarySearchFunc(p.ring, h, func(pt ringPoint, h uint64) int {
+			switch {
+			case pt.hash < h:
+				return -1
+			case pt.hash > h:
+				return 1
+			}
+			return 0
+		})
+		for i := range p.ring {
+			if pt := p.ring[(start+i)%len(p.ring)]; available(pt.u) {
+				chosen = pt.u
+				break
+			}
+		}
+	case LeastOutstanding:
+		start := p.next
+		p.next = (p.next + 1) % n
+		for i := range n {
+			if u := p.upstreams[(start+i)%n]; available(u) && (chosen == nil || u.outstanding < chosen.outstanding) {
+				chosen = u
+			}
+		}
+	default:
+		for i := range n {
+			idx := (p.next + i) % n
+			if u := p.upstreams[idx]; available(u) {
+				chosen = u
+				p.next = (idx + 1) % n
+				break
+			}
+		}
+	}
+	if chosen == nil {
+		return nil, ErrNoHealthyUpstream
+	}
+	chosen.outstanding++
+	return chosen, nil
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
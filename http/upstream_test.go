@@ -0,0 +1,276 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// namedUpstream answers with its name and the request path, or with
+// status when it is non-zero.
+type namedUpstream struct {
+	*httptest.Server
+	hits   atomic.Int32
+	status atomic.Int32
+	delay  atomic.Int64
+}
+
+func newUpstreams(t *testing.T, n int) []*namedUpstream {
+	t.Helper()
+	ups := make([]*namedUpstream, n)
+	for i := range ups {
+		u := &namedUpstream{}
+		name := "u" + strconv.Itoa(i)
+		u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u.hits.Add(1)
+			if d := time.Duration(u.delay.Load()); d > 0 {
+				select {
+				case <-time.After(d):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			if s := u.status.Load(); s != 0 {
+				w.WriteHeader(int(s))
+				return
+			}
+			w.Write([]byte(name + " " + r.URL.Path))
+		}))
+		t.Cleanup(u.Close)
+		ups[i] = u
+	}
+	return ups
+}
+
+func upstreamURLs(ups []*namedUpstream, suffix string) []string {
+	urls := make([]string, len(ups))
+	for i, u := range ups {
+		urls[i] = u.URL + suffix
+	}
+	return urls
+}
+
+func poolGet(t *testing.T, pool *UpstreamPool, path string) (string, error) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", path, nil)
+	resp, err := (&http.Client{Transport: pool.RoundTripper(nil)}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body), nil
+}
+
+func TestUpstreamPool_RoundRobin(t *testing.T) {
+	ups := newUpstreams(t, 3)
+	pool, err := NewUpstreamPool(upstreamURLs(ups, "/base/"), DefaultUpstreamPoolConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for range 4 {
+		body, err := poolGet(t, pool, "/users/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, body)
+	}
+	want := []string{"u0 /base/users/1", "u1 /base/users/1", "u2 /base/users/1", "u0 /base/users/1"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("responses = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestUpstreamPool_LeastOutstanding(t *testing.T) {
+	ups := newUpstreams(t, 2)
+	cfg := DefaultUpstreamPoolConfig()
+	cfg.Strategy = LeastOutstanding
+	pool, _ := NewUpstreamPool(upstreamURLs(ups, ""), cfg)
+
+	// Hold a response open on one upstream; later requests avoid it.
+	req, _ := http.NewRequest("GET", "/held", nil)
+	held, err := (&http.Client{Transport: pool.RoundTripper(nil)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heldBody, _ := io.ReadAll(held.Body)
+	for range 3 {
+		body, _ := poolGet(t, pool, "/x")
+		if body[:2] == string(heldBody[:2]) {
+			t.Fatalf("request went to busy upstream %s", body[:2])
+		}
+	}
+	held.Body.Close()
+	for _, s := range pool.Upstreams() {
+		if s.Outstanding != 0 {
+			t.Errorf("%s outstanding = %d after close", s.URL, s.Outstanding)
+		}
+	}
+}
+
+func TestUpstreamPool_ConsistentHash(t *testing.T) {
+	ups := newUpstreams(t, 3)
+	cfg := DefaultUpstreamPoolConfig()
+	cfg.Strategy = ConsistentHash
+	cfg.MaxFailures = 1
+	pool, _ := NewUpstreamPool(upstreamURLs(ups, ""), cfg)
+
+	owner := map[string]string{}
+	for i := range 30 {
+		path := "/k" + strconv.Itoa(i)
+		body, _ := poolGet(t, pool, path)
+		again, _ := poolGet(t, pool, path)
+		if body != again {
+			t.Fatalf("%s moved from %q to %q", path, body, again)
+		}
+		owner[path] = body[:2]
+	}
+
+	// Ejecting u0 only moves u0's keys.
+	ups[0].status.Store(500)
+	for path, name := range owner {
+		if name == "u0" {
+			poolGet(t, pool, path)
+			break
+		}
+	}
+	ups[0].status.Store(0)
+	for path, name := range owner {
+		body, _ := poolGet(t, pool, path)
+		if name != "u0" && body[:2] != name {
+			t.Errorf("%s moved from %s to %s", path, name, body[:2])
+		}
+		if name == "u0" && body[:2] == "u0" {
+			t.Errorf("%s still on ejected u0", path)
+		}
+	}
+}
+
+func TestUpstreamPool_PassiveEjection(t *testing.T) {
+	ups := newUpstreams(t, 2)
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	cfg := DefaultUpstreamPoolConfig()
+	cfg.MaxFailures = 2
+	cfg.EjectionTime = time.Minute
+	pool, _ := NewUpstreamPool(upstreamURLs(ups, ""), cfg)
+	pool.now = clock.Now
+
+	ups[0].status.Store(503)
+	for range 4 {
+		poolGet(t, pool, "/")
+	}
+	if s := pool.Upstreams()[0]; s.EjectedUntil.IsZero() {
+		t.Fatalf("u0 not ejected: %+v", s)
+	}
+	before := ups[0].hits.Load()
+	for range 4 {
+		if body, _ := poolGet(t, pool, "/"); body != "u1 /" {
+			t.Fatalf("body = %q during ejection", body)
+		}
+	}
+	if ups[0].hits.Load() != before {
+		t.Error("ejected upstream received requests")
+	}
+
+	clock.Advance(time.Minute)
+	ups[0].status.Store(0)
+	poolGet(t, pool, "/")
+	poolGet(t, pool, "/")
+	if ups[0].hits.Load() == before {
+		t.Error("upstream not readmitted after EjectionTime")
+	}
+
+	// With both ejected the pool fails fast.
+	ups[0].status.Store(503)
+	ups[1].status.Store(503)
+	for range 4 {
+		poolGet(t, pool, "/")
+	}
+	if _, err := poolGet(t, pool, "/"); !errors.Is(err, ErrNoHealthyUpstream) {
+		t.Errorf("err = %v, want ErrNoHealthyUpstream", err)
+	}
+}
+
+func TestUpstreamPool_ActiveHealthCheck(t *testing.T) {
+	ups := newUpstreams(t, 2)
+	cfg := DefaultUpstreamPoolConfig()
+	cfg.HealthCheck = HTTPHealthCheck("/healthz", nil)
+	pool, _ := NewUpstreamPool(upstreamURLs(ups, ""), cfg)
+
+	ups[1].status.Store(503)
+	pool.CheckHealth(context.Background())
+	if st := pool.Upstreams(); !st[0].Healthy || st[1].Healthy {
+		t.Fatalf("status = %+v", st)
+	}
+	for range 3 {
+		if body, _ := poolGet(t, pool, "/"); body != "u0 /" {
+			t.Fatalf("body = %q, want only u0", body)
+		}
+	}
+
+	ups[1].status.Store(0)
+	pool.CheckHealth(context.Background())
+	if !pool.Upstreams()[1].Healthy {
+		t.Error("u1 not healthy after passing check")
+	}
+}
+
+func TestUpstreamPool_Hedging(t *testing.T) {
+	ups := newUpstreams(t, 2)
+	ups[0].delay.Store(int64(2 * time.Second))
+	cfg := DefaultUpstreamPoolConfig()
+	cfg.HedgeAfter = 20 * time.Millisecond
+	pool, _ := NewUpstreamPool(upstreamURLs(ups, ""), cfg)
+
+	start := time.Now()
+	body, err := poolGet(t, pool, "/slow")
+	if err != nil || body != "u1 /slow" {
+		t.Fatalf("body = %q, err = %v", body, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("hedge did not cut latency")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.Upstreams()[0].Outstanding != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := pool.Upstreams()[0].Outstanding; n != 0 {
+		t.Errorf("losing attempt still outstanding: %d", n)
+	}
+}
+
+func TestCall_WithUpstreamPool(t *testing.T) {
+	ups := newUpstreams(t, 2)
+	ups[0].status.Store(502)
+	pool, _ := NewUpstreamPool(upstreamURLs(ups, ""), DefaultUpstreamPoolConfig())
+	policy := fastRetry()
+	policy.MaxAttempts = 2
+
+	req, _ := http.NewRequest("GET", "/v1", nil)
+	resp, err := CallRaw(context.Background(), req, WithUpstreamPool(pool), WithRetry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "u1 /v1" {
+		t.Errorf("body = %q, want the retry on u1", body)
+	}
+}
+
+func TestNewUpstreamPool_Invalid(t *testing.T) {
+	if _, err := NewUpstreamPool(nil, DefaultUpstreamPoolConfig()); err == nil {
+		t.Error("empty pool accepted")
+	}
+	if _, err := NewUpstreamPool([]string{"users:8080"}, DefaultUpstreamPoolConfig()); err == nil {
+		t.Error("relative URL accepted")
+	}
+}
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+// PreparedSender is implemented by connections that accept pre-encoded
+// WebSocket messages. BaseConn (and any type embedding it) implements it.
+type PreparedSender interface {
+	SendPrepared(pm *websocket.PreparedMessage)
+}
+
+// PrepareOutput encodes msg once with codec and wraps the result in a
+// websocket.PreparedMessage. The message type (text or binary) comes from
+// the codec, so the same prepared message is valid for every connection
+// that uses an equivalent codec.
+//
+// Gorilla caches the wire frame of a PreparedMessage for each combination of
+// client/server role and compression setting it is written with, so sending
+// it to thousands of connections costs one encode and (typically) one frame.
+func PrepareOutput[I any, O any](codec Codec[I, O], msg O) (*websocket.PreparedMessage, error) {
+	data, msgType, err := codec.Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	return websocket.NewPreparedMessage(int(msgType), data)
+}
+
+// PrepareOutgoing is like PrepareOutput but returns an OutgoingMessage ready
+// to be sent to a Writer or a FanOut of Writer input channels:
+//
+//	out, err := gohttp.PrepareOutgoing(codec, msg)
+//	if err == nil {
+//	    fanout.Send(out)
+//	}
+func PrepareOutgoing[I any, O any](codec Codec[I, O], msg O) (OutgoingMessage[O], error) {
+	pm, err := PrepareOutput(codec, msg)
+	if err != nil {
+		return OutgoingMessage[O]{}, err
+	}
+	return OutgoingMessage[O]{Prepared: pm}, nil
+}
+
+// WSBroadcast encodes msg once with codec and queues the prepared message to
+// every connection. Each connection still writes through its own Writer, so
+// the single-writer guarantee per connection is preserved; only the encoding
+// and framing work is shared.
+//
+// All connections must expect the same encoding as codec (e.g. all JSON).
+// Returns the encoding error, if any, without sending anything.
+//
+// Example:
+//
+//	room.mu.RLock()
+//	err := gohttp.WSBroadcast(codec, state, slices.Collect(maps.Values(room.conns))...)
+//	room.mu.RUnlock()
+func WSBroadcast[I any, O any, S PreparedSender](codec Codec[I, O], msg O, conns ...S) error {
+	pm, err := PrepareOutput(codec, msg)
+	if err != nil {
+		return err
+	}
+	for _, conn := range conns {
+		conn.SendPrepared(pm)
+	}
+	return nil
+}
+
+// Compile-time interface compliance check
+var _ PreparedSender = (*BaseConn[any, any])(nil)
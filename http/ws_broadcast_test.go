@@ -0,0 +1,122 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// broadcastConn is a JSONConn that announces itself once its Writer exists.
+type broadcastConn struct {
+	JSONConn
+	started chan *broadcastConn
+}
+
+func (c *broadcastConn) OnStart(conn *websocket.Conn) error {
+	if err := c.JSONConn.OnStart(conn); err != nil {
+		return err
+	}
+	c.started <- c
+	return nil
+}
+
+type broadcastHandler struct {
+	codec   Codec[any, any]
+	started chan *broadcastConn
+}
+
+func (h *broadcastHandler) Validate(w http.ResponseWriter, r *http.Request) (*broadcastConn, bool) {
+	return &broadcastConn{JSONConn: JSONConn{Codec: h.codec}, started: h.started}, true
+}
+
+// binaryCodec is a JSON codec that reports its output as binary frames.
+type binaryCodec struct{ JSONCodec }
+
+func (c *binaryCodec) Encode(msg any) ([]byte, MessageType, error) {
+	data, _, err := c.JSONCodec.Encode(msg)
+	return data, BinaryMessage, err
+}
+
+// dialBroadcastClients starts a WebSocket server and connects n clients,
+// returning the client sockets and the server-side connections.
+func dialBroadcastClients(t *testing.T, codec Codec[any, any], n int) ([]*websocket.Conn, []*broadcastConn) {
+	t.Helper()
+	handler := &broadcastHandler{codec: codec, started: make(chan *broadcastConn, n)}
+	server := httptest.NewServer(WSServe(handler, nil))
+	t.Cleanup(server.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	clients := make([]*websocket.Conn, n)
+	conns := make([]*broadcastConn, n)
+	for i := range clients {
+		c, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		clients[i] = c
+		select {
+		case conns[i] = <-handler.started:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for server connection")
+		}
+	}
+	return clients, conns
+}
+
+// TestWSBroadcastEncodesOnce verifies that WSBroadcast encodes a message
+// once and every connection receives it through its own Writer.
+func TestWSBroadcastEncodesOnce(t *testing.T) {
+	codec := &countingCodec{}
+	clients, conns := dialBroadcastClients(t, codec, 3)
+
+	if err := WSBroadcast[any, any](codec, map[string]any{"tick": 1}, conns...); err != nil {
+		t.Fatalf("WSBroadcast: %v", err)
+	}
+
+	for i, c := range clients {
+		msg, err := receiveJSONMessage(c, 2*time.Second)
+		if err != nil {
+			t.Fatalf("client %d: %v", i, err)
+		}
+		if msg["tick"] != float64(1) {
+			t.Errorf("client %d received %v", i, msg)
+		}
+	}
+	if n := codec.encodes.Load(); n != 1 {
+		t.Errorf("Encode called %d times, want 1", n)
+	}
+}
+
+// TestPrepareOutgoingMessageType verifies that the frame type comes from
+// the codec and that prepared messages interleave correctly with regular
+// Data messages on the same Writer.
+func TestPrepareOutgoingMessageType(t *testing.T) {
+	codec := &binaryCodec{}
+	clients, conns := dialBroadcastClients(t, codec, 1)
+
+	out, err := PrepareOutgoing[any, any](codec, map[string]any{"seq": 1})
+	if err != nil {
+		t.Fatalf("PrepareOutgoing: %v", err)
+	}
+	conns[0].Writer.Send(out)
+	conns[0].SendOutput(map[string]any{"seq": 2})
+
+	for _, want := range []string{`{"seq":1}`, `{"seq":2}`} {
+		clients[0].SetReadDeadline(time.Now().Add(2 * time.Second))
+		msgType, data, err := clients[0].ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if msgType != websocket.BinaryMessage {
+			t.Errorf("message type = %d, want binary", msgType)
+		}
+		if string(data) != want {
+			t.Errorf("data = %s, want %s", data, want)
+		}
+	}
+}
@@ -1,6 +1,183 @@
 package http
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
+
+// AuthParam is one name=value parameter of an AuthChallenge.
+type AuthParam struct {
+	Name  string
+	Value string
+}
+
+// AuthChallenge is one challenge from a WWW-Authenticate or
+// Proxy-Authenticate header (RFC 7235 §2.1): an auth scheme followed by
+// either a token68 or a list of parameters.
+//
+// Servers build challenges and format them with FormatWWWAuthenticate:
+//
+//	ch := &gohttp.AuthChallenge{Scheme: "Bearer"}
+//	ch.Set("realm", "api").Set("error", "invalid_token")
+//	w.Header().Set("WWW-Authenticate", gohttp.FormatWWWAuthenticate(*ch))
+//
+// BearerVerifier emits its 401 and 403 challenges this way.
+type AuthChallenge struct {
+	// Scheme is the auth scheme as sent, e.g. "Bearer", "Basic", "DPoP".
+	// Compare it case-insensitively. Empty for a parameter list sent
+	// without a scheme, which some servers do.
+	Scheme string
+
+	// Token68 is the token68 form of the challenge, if used instead of
+	// parameters.
+	Token68 string
+
+	// Params are the auth parameters in header order, unquoted.
+	Params []AuthParam
+}
+
+// Param returns the value of the named parameter, matching the name
+// case-insensitively, or "" if absent.
+func (c *AuthChallenge) Param(name string) string {
+	for _, p := range c.Params {
+		if strings.EqualFold(p.Name, name) {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// Set sets the named parameter, replacing an existing one. It returns c
+// for chaining.
+func (c *AuthChallenge) Set(name, value string) *AuthChallenge {
+	for i, p := range c.Params {
+		if strings.EqualFold(p.Name, name) {
+			c.Params[i].Value = value
+			return c
+		}
+	}
+	c.Params = append(c.Params, AuthParam{Name: name, Value: value})
+	return c
+}
+
+// Realm returns the "realm" parameter (RFC 7235 §2.2).
+func (c *AuthChallenge) Realm() string { return c.Param("realm") }
+
+// ErrorCode returns the "error" parameter, e.g. "invalid_token" or
+// "insufficient_scope" (RFC 6750 §3.1).
+func (c *AuthChallenge) ErrorCode() string { return c.Param("error") }
+
+// ErrorDescription returns the "error_description" parameter.
+func (c *AuthChallenge) ErrorDescription() string { return c.Param("error_description") }
+
+// Scopes returns the space-separated "scope" parameter as a slice.
+func (c *AuthChallenge) Scopes() []string { return strings.Fields(c.Param("scope")) }
+
+// HasScheme reports whether the challenge uses scheme, case-insensitively.
+func (c *AuthChallenge) HasScheme(scheme string) bool { return strings.EqualFold(c.Scheme, scheme) }
+
+// String formats the challenge for a header. Parameter values are always
+// sent as quoted-strings, which every parameter accepts.
+func (c AuthChallenge) String() string {
+	var b strings.Builder
+	b.WriteString(c.Scheme)
+	if c.Token68 != "" {
+		b.WriteByte(' ')
+		b.WriteString(c.Token68)
+		return b.String()
+	}
+	for i, p := range c.Params {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(p.Name)
+		b.WriteString(`="`)
+		for j := 0; j < len(p.Value); j++ {
+			if ch := p.Value[j]; ch == '"' || ch == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(p.Value[j])
+		}
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// FormatWWWAuthenticate formats challenges as one WWW-Authenticate value.
+func FormatWWWAuthenticate(challenges ...AuthChallenge) string {
+	parts := make([]string, len(challenges))
+	for i, c := range challenges {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseAuthChallenges parses a WWW-Authenticate (or Proxy-Authenticate)
+// header value into its challenges, per RFC 7235 §4.1:
+//
+//	Basic realm="simple", Bearer realm="api", error="invalid_token",
+//	    error_description="The token \"abc\" expired", Negotiate dGVzdA==
+//
+// gives three challenges. Quoted-string escapes are resolved. Parameters
+// before any scheme are returned in a challenge with an empty Scheme.
+// Values from several header lines can be joined with ", " first.
+func ParseAuthChallenges(header string) ([]AuthChallenge, error) {
+	return parseAuthChallenges(header, false)
+}
+
+func parseAuthChallenges(header string, lenient bool) ([]AuthChallenge, error) {
+	p := authParser{s: header, lenient: lenient}
+	var challenges []AuthChallenge
+	for {
+		p.skipSeparators()
+		if p.done() {
+			return challenges, nil
+		}
+		start := p.pos
+		name := p.token()
+		if name == "" {
+			return nil, fmt.Errorf("www-authenticate: unexpected %q at offset %d", p.s[p.pos], p.pos)
+		}
+		p.skipSpace()
+
+		if p.peek() == '=' {
+			// An auth-param of the current challenge.
+			p.pos++
+			p.skipSpace()
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if len(challenges) == 0 {
+				challenges = append(challenges, AuthChallenge{})
+			}
+			c := &challenges[len(challenges)-1]
+			if c.Token68 != "" {
+				return nil, fmt.Errorf("www-authenticate: parameter %q after token68 at offset %d", name, start)
+			}
+			if c.Param(name) == "" {
+				c.Params = append(c.Params, AuthParam{Name: name, Value: value})
+			}
+			continue
+		}
+
+		// A new challenge; it may be followed by a token68.
+		challenges = append(challenges, AuthChallenge{Scheme: name})
+		if p.pos > start+len(name) && !p.done() && p.peek() != ',' {
+			save := p.pos
+			if t68 := p.token68(); t68 != "" {
+				p.skipSpace()
+				if p.done() || p.peek() == ',' {
+					challenges[len(challenges)-1].Token68 = t68
+					continue
+				}
+			}
+			p.pos = save
+		}
+	}
+}
 
 // ParseWWWAuthenticate extracts the resource_metadata URL and scopes from a
 // WWW-Authenticate: Bearer header value per RFC 6750 §3.
@@ -9,28 +186,46 @@ import "strings"
 //   - Discover the Protected Resource Metadata (PRM) endpoint from a 401 response
 //   - Parse required scopes from a 403 insufficient_scope response
 //
-// Handles both quoted ("value") and unquoted (value) parameter formats.
+// Handles both quoted and unquoted parameter formats. Unlike
+// ParseAuthChallenges, an unquoted value runs to the next comma or
+// whitespace, so values that are not RFC 9110 tokens, such as
+// resource_metadata=https://api.example/.well-known/oauth-protected-resource,
+// are accepted as servers send them.
+//
+// The Bearer challenge is used when the header has several; otherwise the
+// first one, so a bare parameter list without a scheme also works. See
+// ParseAuthChallenges for the full parse.
+//
+// Malformed headers (e.g. an unterminated quoted-string) do not fail: the
+// parameters are then extracted best-effort by name, so scopes a server
+// sent are not lost to a syntax slip.
 //
 // See: https://www.rfc-editor.org/rfc/rfc6750#section-3
 func ParseWWWAuthenticate(header string) (resourceMetadata string, scopes []string, err error) {
-	header = strings.TrimSpace(header)
-	if strings.HasPrefix(header, "Bearer ") {
-		header = header[len("Bearer "):]
+	challenges, err := parseAuthChallenges(header, true)
+	if err != nil {
+		if scope := extractWWWAuthParam(header, "scope"); scope != "" {
+			scopes = strings.Fields(scope)
+		}
+		return extractWWWAuthParam(header, "resource_metadata"), scopes, nil
 	}
-
-	resourceMetadata = extractWWWAuthParam(header, "resource_metadata")
-	scopeStr := extractWWWAuthParam(header, "scope")
-	if scopeStr != "" {
-		scopes = strings.Fields(scopeStr)
+	if len(challenges) == 0 {
+		return "", nil, nil
 	}
-
-	return resourceMetadata, scopes, nil
+	c := &challenges[0]
+	for i := range challenges {
+		if challenges[i].HasScheme("Bearer") {
+			c = &challenges[i]
+			break
+		}
+	}
+	return c.Param("resource_metadata"), c.Scopes(), nil
 }
 
-// extractWWWAuthParam extracts a named parameter value from a WWW-Authenticate
-// header. Handles both quoted ("value") and unquoted (value) parameter formats.
-// Ensures the match is a full parameter name (not a suffix like "noscope" when
-// searching for "scope").
+// extractWWWAuthParam finds a named parameter anywhere in a header,
+// without parsing its structure. It handles quoted and unquoted values and
+// only matches a full parameter name (not "noscope" when searching for
+// "scope"). An unterminated quoted value runs to the end of the header.
 func extractWWWAuthParam(header, name string) string {
 	search := name + "="
 	idx := strings.Index(header, search)
@@ -63,3 +258,106 @@ func extractWWWAuthParam(header, name string) string {
 	}
 	return rest[:end]
 }
+
+// authParser scans a header value. Offsets are in bytes. A lenient parser
+// reads unquoted values up to the next comma or whitespace instead of
+// requiring a token.
+type authParser struct {
+	s       string
+	pos     int
+	lenient bool
+}
+
+func (p *authParser) done() bool { return p.pos >= len(p.s) }
+
+func (p *authParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *authParser) skipSpace() {
+	for !p.done() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *authParser) skipSeparators() {
+	for !p.done() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == ',') {
+		p.pos++
+	}
+}
+
+// token reads an RFC 9110 token.
+func (p *authParser) token() string {
+	start := p.pos
+	for !p.done() && isTokenChar(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// token68 reads 1*(ALPHA / DIGIT / "-" / "." / "_" / "~" / "+" / "/") *"=".
+func (p *authParser) token68() string {
+	start := p.pos
+	for !p.done() && isToken68Char(p.s[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return ""
+	}
+	for !p.done() && p.s[p.pos] == '=' {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// value reads a token or a quoted-string, resolving quoted-pairs.
+func (p *authParser) value() (string, error) {
+	if p.peek() != '"' {
+		if !p.lenient {
+			return p.token(), nil
+		}
+		start := p.pos
+		for !p.done() && p.s[p.pos] != ',' && p.s[p.pos] != ' ' && p.s[p.pos] != '\t' {
+			p.pos++
+		}
+		return p.s[start:p.pos], nil
+	}
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for !p.done() {
+		ch := p.s[p.pos]
+		p.pos++
+		switch ch {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.done() {
+				return "", fmt.Errorf("www-authenticate: unterminated quoted-string at offset %d", start)
+			}
+			ch = p.s[p.pos]
+			p.pos++
+		}
+		b.WriteByte(ch)
+	}
+	return "", fmt.Errorf("www-authenticate: unterminated quoted-string at offset %d", start)
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+func isToken68Char(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~+/", c) >= 0
+}
@@ -45,6 +45,23 @@ func TestParseWWWAuthenticate_Both(t *testing.T) {
 	}
 }
 
+// TestParseWWWAuthenticate_UnquotedURL verifies that unquoted values that
+// are not tokens, such as URLs, are still accepted, as before the strict
+// challenge parser, while ParseAuthChallenges rejects them.
+func TestParseWWWAuthenticate_UnquotedURL(t *testing.T) {
+	header := `Bearer resource_metadata=https://ex.com/.well-known/oauth-protected-resource, scope=read`
+	rm, scopes, err := ParseWWWAuthenticate(header)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rm != "https://ex.com/.well-known/oauth-protected-resource" || len(scopes) != 1 || scopes[0] != "read" {
+		t.Errorf("resource_metadata = %q, scopes = %v", rm, scopes)
+	}
+	if _, err := ParseAuthChallenges(header); err == nil {
+		t.Error("ParseAuthChallenges accepted an unquoted URL")
+	}
+}
+
 // TestParseWWWAuthenticate_Empty verifies that an empty header returns
 // empty values without error.
 func TestParseWWWAuthenticate_Empty(t *testing.T) {
@@ -80,3 +97,103 @@ func TestParseWWWAuthenticate_UnquotedScope(t *testing.T) {
 		t.Errorf("scopes = %v, want [read]", scopes)
 	}
 }
+
+// TestParseAuthChallenges_Multiple verifies the RFC 7235 §4.1 example with
+// several schemes, quoted-string escapes and a token68 challenge.
+func TestParseAuthChallenges_Multiple(t *testing.T) {
+	header := `Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple",` +
+		` Negotiate dGVzdA==, DPoP algs="ES256 PS256", Bearer realm="api", error="invalid_token", error_description="expired"`
+	challenges, err := ParseAuthChallenges(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(challenges) != 5 {
+		t.Fatalf("got %d challenges: %+v", len(challenges), challenges)
+	}
+	newauth := challenges[0]
+	if newauth.Scheme != "Newauth" || newauth.Realm() != "apps" || newauth.Param("TYPE") != "1" || newauth.Param("title") != `Login to "apps"` {
+		t.Errorf("Newauth = %+v", newauth)
+	}
+	if !challenges[1].HasScheme("basic") || challenges[1].Realm() != "simple" {
+		t.Errorf("Basic = %+v", challenges[1])
+	}
+	if challenges[2].Scheme != "Negotiate" || challenges[2].Token68 != "dGVzdA==" || len(challenges[2].Params) != 0 {
+		t.Errorf("Negotiate = %+v", challenges[2])
+	}
+	if challenges[3].Param("algs") != "ES256 PS256" {
+		t.Errorf("DPoP = %+v", challenges[3])
+	}
+	bearer := challenges[4]
+	if bearer.ErrorCode() != "invalid_token" || bearer.ErrorDescription() != "expired" || bearer.Realm() != "api" {
+		t.Errorf("Bearer = %+v", bearer)
+	}
+}
+
+// TestParseAuthChallenges_Errors verifies malformed headers are rejected.
+func TestParseAuthChallenges_Errors(t *testing.T) {
+	for _, header := range []string{
+		`Bearer realm="unterminated`,
+		`Bearer realm="x", @bad`,
+		`Basic abc==, realm="x"`,
+	} {
+		if _, err := ParseAuthChallenges(header); err == nil {
+			t.Errorf("ParseAuthChallenges(%q) succeeded", header)
+		}
+	}
+	if c, err := ParseAuthChallenges(" , "); err != nil || len(c) != 0 {
+		t.Errorf("empty list = %v, %v", c, err)
+	}
+}
+
+// TestParseWWWAuthenticate_PrefersBearer verifies the Bearer challenge is
+// used when a header also offers other schemes.
+func TestParseWWWAuthenticate_PrefersBearer(t *testing.T) {
+	_, scopes, err := ParseWWWAuthenticate(`Basic realm="x", scope="wrong", Bearer scope="read"`)
+	if err != nil || len(scopes) != 1 || scopes[0] != "read" {
+		t.Errorf("scopes = %v, %v", scopes, err)
+	}
+	// Substrings of other parameter names are not matched.
+	_, scopes, _ = ParseWWWAuthenticate(`Bearer noscope="x", scope="y"`)
+	if len(scopes) != 1 || scopes[0] != "y" {
+		t.Errorf("scopes = %v", scopes)
+	}
+}
+
+// TestParseWWWAuthenticate_Malformed verifies that headers the strict
+// parser rejects still yield their parameters, as the original extractor
+// did, so AuthRetryError keeps RequiredScopes.
+func TestParseWWWAuthenticate_Malformed(t *testing.T) {
+	rm, scopes, err := ParseWWWAuthenticate(`Bearer resource_metadata="https://api.example/prm", scope="read write`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rm != "https://api.example/prm" || len(scopes) != 2 || scopes[1] != "write" {
+		t.Errorf("resource_metadata = %q, scopes = %v", rm, scopes)
+	}
+	if _, scopes, err := ParseWWWAuthenticate(`Bearer scope="admin", @bad`); err != nil || len(scopes) != 1 || scopes[0] != "admin" {
+		t.Errorf("scopes = %v, %v", scopes, err)
+	}
+}
+
+// TestFormatWWWAuthenticate verifies the builder escapes values and
+// round-trips through the parser.
+func TestFormatWWWAuthenticate(t *testing.T) {
+	bearer := &AuthChallenge{Scheme: "Bearer"}
+	bearer.Set("realm", "api").Set("error", "insufficient_scope").Set("scope", "read write")
+	bearer.Set("error_description", `needs "write" \ admin`)
+	basic := AuthChallenge{Scheme: "Basic"}
+	basic.Set("realm", "simple")
+	header := FormatWWWAuthenticate(*bearer, basic, AuthChallenge{Scheme: "Negotiate", Token68: "abc="})
+
+	want := `Bearer realm="api", error="insufficient_scope", scope="read write", error_description="needs \"write\" \\ admin", Basic realm="simple", Negotiate abc=`
+	if header != want {
+		t.Errorf("header = %s\nwant     %s", header, want)
+	}
+	parsed, err := ParseAuthChallenges(header)
+	if err != nil || len(parsed) != 3 {
+		t.Fatalf("round trip = %+v, %v", parsed, err)
+	}
+	if parsed[0].ErrorDescription() != `needs "write" \ admin` || len(parsed[0].Scopes()) != 2 || parsed[2].Token68 != "abc=" {
+		t.Errorf("round trip = %+v", parsed)
+	}
+}